@@ -0,0 +1,175 @@
+// Package api of the wire types of the gridfan daemon API, for clients which
+// decode its replies and events.
+package api
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Daemon states
+const (
+	// Fans follow their zones
+	StateOK = "ok"
+
+	// A zone failed, and runs its fans at 100
+	StateFailsafe = "failsafe"
+
+	// The last fan speed change failed to reach the controller
+	StateControllerLost = "controller_lost"
+)
+
+// Status of the last daemon cycle. DiskStatus, Temperature, HottestDisk and
+// TargetRPM are those of the disks zone.
+type Status struct {
+	Time        time.Time       `json:"time"`
+	Uptime      int             `json:"uptime_seconds"`
+	Config      ConfigStatus    `json:"config"`
+	State       string          `json:"state"`
+	DiskStatus  DiskStatus      `json:"disk_status"`
+	Temperature *int            `json:"temperature,omitempty"`
+	HottestDisk string          `json:"hottest_disk,omitempty"`
+	TargetRPM   int             `json:"target_rpm"`
+	SensorOnly  bool            `json:"sensor_only"`
+	Zones       []ZoneStatus    `json:"zones,omitempty"`
+	Sensors     []SensorReading `json:"sensors,omitempty"`
+	Fans        []FanStatus     `json:"fans,omitempty"`
+	Override    *Override       `json:"override,omitempty"`
+	Wakeups     map[string]int  `json:"wakeups,omitempty"`
+
+	// Error of the controller, while the state is controller_lost
+	ControllerError string `json:"controller_error,omitempty"`
+
+	// Power state of each disk
+	Disks map[string]DiskStatus `json:"disks,omitempty"`
+
+	// Model, serial, firmware and capacity of each disk, read on start
+	Identities map[string]DiskIdentity `json:"identities,omitempty"`
+
+	// Temperature limits of each disk with limits
+	DiskLimits map[string]DiskLimit `json:"disk_limits,omitempty"`
+
+	// Identity and quirks of each controller, as of its last open
+	Controllers []ControllerStatus `json:"controllers,omitempty"`
+
+	// Subprocesses run during the cycle, such as hdparm and smartctl
+	CycleCommands int `json:"cycle_commands"`
+
+	// Seconds each fan spent at each duty range since start
+	DutySeconds map[int]map[string]float64 `json:"duty_seconds,omitempty"`
+}
+
+// ControllerStatus of the identity of a controller, and the quirks applied
+type ControllerStatus struct {
+	DevicePath        string             `json:"device_path"`
+	Identity          ControllerIdentity `json:"identity"`
+	QuirksProfile     string             `json:"quirks_profile,omitempty"`
+	CommandDelay      int                `json:"command_delay_ms"`
+	SkipPing          bool               `json:"skip_ping"`
+	ReadbackTolerance int                `json:"readback_tolerance"`
+}
+
+// ControllerIdentity of a controller, from the USB device of its serial
+// adapter
+type ControllerIdentity struct {
+	VendorID  string `json:"vendor_id"`
+	ProductID string `json:"product_id"`
+	Product   string `json:"product,omitempty"`
+}
+
+// ConfigStatus of the loaded config file
+type ConfigStatus struct {
+	Path    string     `json:"path,omitempty"`
+	SHA256  string     `json:"sha256,omitempty"`
+	Profile string     `json:"profile,omitempty"`
+	Loaded  *time.Time `json:"loaded,omitempty"`
+}
+
+// ZoneStatus of a temperature zone, with the curve input temperature, and
+// the rpm decided for it. A disabled zone holds its fans at their last rpm,
+// until DisabledUntil, if set.
+type ZoneStatus struct {
+	Name          string      `json:"name"`
+	DiskStatus    *DiskStatus `json:"disk_status,omitempty"`
+	Temperature   *int        `json:"temperature,omitempty"`
+	Input         *int        `json:"input,omitempty"`
+	HottestDisk   string      `json:"hottest_disk,omitempty"`
+	TargetRPM     int         `json:"target_rpm"`
+	Reason        string      `json:"reason"`
+	Thresholds    []string    `json:"thresholds,omitempty"`
+	Point         *int        `json:"point,omitempty"`
+	Disabled      bool        `json:"disabled,omitempty"`
+	DisabledUntil *time.Time  `json:"disabled_until,omitempty"`
+
+	// Temperature still rising with all zone fans at 100
+	ThermalRunaway bool `json:"thermal_runaway,omitempty"`
+
+	// Since when the zone is at or above its critical temperature
+	CriticalSince *time.Time `json:"critical_since,omitempty"`
+}
+
+// SensorReading of a sensor temperature
+type SensorReading struct {
+	Name        string `json:"name"`
+	Temperature int    `json:"temperature"`
+}
+
+// FanStatus of a fan, with the reason for its rpm. With read_speeds, Speed
+// is the filtered speed reading, and RawSpeed the unfiltered one.
+type FanStatus struct {
+	Fan      int    `json:"fan"`
+	RPM      int    `json:"rpm"`
+	Reason   string `json:"reason"`
+	Speed    *int   `json:"speed,omitempty"`
+	RawSpeed *int   `json:"raw_speed,omitempty"`
+}
+
+// DiskLimit of a disk: its rated maximum temperature and where it is from,
+// the warning temperature derived from it, and the level of its last
+// temperature, if it reached either
+type DiskLimit struct {
+	Max     int    `json:"max"`
+	Source  string `json:"source"`
+	Warning int    `json:"warning"`
+	Level   string `json:"level,omitempty"`
+}
+
+// Health of the daemon, served on /health
+type Health struct {
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Sample of a series at a time
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value int       `json:"value"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// String of identity, such as 1a86:7523 USB Serial
+func (identity ControllerIdentity) String() string {
+	if len(identity.VendorID) == 0 {
+		return "unknown"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s:%s %s", identity.VendorID,
+		identity.ProductID, identity.Product))
+}
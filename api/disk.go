@@ -0,0 +1,146 @@
+package api
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DiskStatus of a disk
+type DiskStatus int
+
+// Disk status, ordered by activity. Sleep and standby are the ATA power
+// states, where the disk is spun down. Unknown is reported by some drives and
+// controllers which do not support power state checks. Idle is a spun up, but
+// idle disk. Active is an active, or idle disk, when the drive does not
+// differentiate. NVMe disks are active in power state 0, and idle otherwise.
+const (
+	DiskStatusSleep DiskStatus = iota
+	DiskStatusStandby
+	DiskStatusUnknown
+	DiskStatusIdle
+	DiskStatusActive
+)
+
+// DiskStatuses from least to most active
+var DiskStatuses = []DiskStatus{DiskStatusSleep, DiskStatusStandby,
+	DiskStatusUnknown, DiskStatusIdle, DiskStatusActive}
+
+// DiskIdentity of a disk, to tell which physical drive a device is. Capacity
+// is in bytes.
+type DiskIdentity struct {
+	Model    string `json:"model,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	Capacity int64  `json:"capacity,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// String of status
+func (status DiskStatus) String() string {
+	switch status {
+	case DiskStatusSleep:
+		return "Sleeping"
+
+	case DiskStatusStandby:
+		return "Standby"
+
+	case DiskStatusUnknown:
+		return "Unknown"
+
+	case DiskStatusIdle:
+		return "Idle"
+
+	case DiskStatusActive:
+		return "Active"
+
+	default:
+		return fmt.Sprintf("Status(%d)", int(status))
+	}
+}
+
+// ParseDiskStatus from its case insensitive string
+func ParseDiskStatus(value string) (DiskStatus, error) {
+	for _, status := range DiskStatuses {
+		if strings.EqualFold(value, status.String()) {
+			return status, nil
+		}
+	}
+
+	return 0, fmt.Errorf("ParseStatus: Unknown status: [%s]", value)
+}
+
+// MarshalJSON as lowercase string
+func (status DiskStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.ToLower(status.String()))
+}
+
+// UnmarshalJSON from string
+func (status *DiskStatus) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := ParseDiskStatus(value)
+	if err != nil {
+		return err
+	}
+
+	*status = parsed
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// String of identity, such as "WDC WD40EFRX serial WD-WCC7K1234567 firmware
+// 82.00A82 4.0 TB", of its known fields
+func (identity DiskIdentity) String() string {
+	parts := []string{}
+	if len(identity.Model) != 0 {
+		parts = append(parts, identity.Model)
+	}
+	if len(identity.Serial) != 0 {
+		parts = append(parts, "serial "+identity.Serial)
+	}
+	if len(identity.Firmware) != 0 {
+		parts = append(parts, "firmware "+identity.Firmware)
+	}
+	if identity.Capacity > 0 {
+		parts = append(parts, FormatCapacity(identity.Capacity))
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatCapacity of bytes in decimal units, as drives are labeled, such as
+// 4.0 TB
+func FormatCapacity(bytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
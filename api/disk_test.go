@@ -0,0 +1,66 @@
+package api
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiskStatusJSON(t *testing.T) {
+	for _, status := range DiskStatuses {
+		encoded, err := json.Marshal(status)
+		if err != nil {
+			t.Errorf("%s: Marshal error: %v", status, err)
+			continue
+		}
+
+		var decoded DiskStatus
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Errorf("%s: Unmarshal(%s) error: %v", status, encoded, err)
+		} else if decoded != status {
+			t.Errorf("%s: Unmarshal(%s) = %s, expected %s", status, encoded,
+				decoded, status)
+		}
+	}
+
+	var decoded DiskStatus
+	if err := json.Unmarshal([]byte(`"spinning"`), &decoded); err == nil {
+		t.Errorf("Unmarshal(spinning) = %s, expected error", decoded)
+	}
+}
+
+func TestDiskIdentityString(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity DiskIdentity
+		expected string
+	}{
+		{"empty", DiskIdentity{}, ""},
+		{"full", DiskIdentity{Model: "WDC WD40EFRX", Serial: "WD-1",
+			Firmware: "82.00A82", Capacity: 4000787030016},
+			"WDC WD40EFRX serial WD-1 firmware 82.00A82 4.0 TB"},
+		{"bytes", DiskIdentity{Model: "tiny", Capacity: 512}, "tiny 512 B"},
+	}
+
+	for _, test := range tests {
+		if value := test.identity.String(); value != test.expected {
+			t.Errorf("%s: String() = %q, expected %q", test.name, value,
+				test.expected)
+		}
+	}
+}
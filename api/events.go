@@ -0,0 +1,83 @@
+package api
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// Event types
+const (
+	// Fan rpm set
+	EventRPM = "rpm"
+
+	// Zone disk status changed
+	EventStatus = "status"
+
+	// Preset override applied or ended
+	EventOverride = "override"
+
+	// Fan duty changed by something else than the daemon
+	EventExternal = "external"
+
+	// Zone disabled or enabled at runtime
+	EventZone = "zone"
+
+	// Zone threshold reached or left, with the alert action
+	EventThreshold = "threshold"
+
+	// Zone temperature still rising with all of its fans at 100
+	EventRunaway = "thermal_runaway"
+
+	// Zone critical temperature action run
+	EventCritical = "critical"
+
+	// Disk reached or left the warning or critical level of its limits
+	EventLimit = "disk_limit"
+
+	// smartd warning of a disk
+	EventSmartd = "smartd"
+
+	// Cycle error
+	EventError = "error"
+)
+
+// Event of the daemon, for external tools
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Zone    string    `json:"zone,omitempty"`
+	Disk    string    `json:"disk,omitempty"`
+	Fan     int       `json:"fan,omitempty"`
+	RPM     *int      `json:"rpm,omitempty"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to,omitempty"`
+	Preset  string    `json:"preset,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Change of a fan speed, with the zone and its curve input temperature which
+// triggered it, if any. From is unset if the previous speed is unknown.
+type Change struct {
+	Time        time.Time `json:"time"`
+	Fan         int       `json:"fan"`
+	From        *int      `json:"from,omitempty"`
+	To          int       `json:"to"`
+	Zone        string    `json:"zone,omitempty"`
+	Temperature *int      `json:"temperature,omitempty"`
+	Reason      string    `json:"reason"`
+}
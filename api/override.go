@@ -0,0 +1,64 @@
+package api
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Override of fan rpms by a preset, until it expires
+type Override struct {
+	Preset string      `json:"preset"`
+	Fans   map[int]int `json:"fans"`
+	Until  *time.Time  `json:"until,omitempty"`
+}
+
+// PushedTarget rpm of a zone, pushed through the API, until it expires
+type PushedTarget struct {
+	RPM   int       `json:"rpm"`
+	Until time.Time `json:"until"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Apply override to fan statuses
+func (override *Override) Apply(fans []FanStatus) []FanStatus {
+	reason := "preset " + override.Preset
+	if override.Until != nil {
+		reason = fmt.Sprintf("%s until %s", reason,
+			override.Until.Format("15:04:05"))
+	}
+
+	result := []FanStatus{}
+	for _, fan := range fans {
+		if _, ok := override.Fans[fan.Fan]; !ok {
+			result = append(result, fan)
+		}
+	}
+
+	for fan, rpm := range override.Fans {
+		result = append(result, FanStatus{Fan: fan, RPM: rpm, Reason: reason})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Fan < result[j].Fan
+	})
+
+	return result
+}
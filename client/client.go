@@ -0,0 +1,265 @@
+// Package client of the gridfan daemon API, for tools which read the daemon
+// status, or control it, without implementing the wire format.
+package client
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cybojanek/gridfan/api"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client of the API of a daemon at URL, such as http://127.0.0.1:9470, with
+// the api_token of the daemon, if any
+type Client struct {
+	URL   string
+	Token string
+	HTTP  *http.Client
+}
+
+// Timeout of requests, besides streams
+const requestTimeout = 10 * time.Second
+
+////////////////////////////////////////////////////////////////////////////////
+
+// New client of the daemon with listen address, as in its config. Daemons
+// listening on all addresses are reached over loopback.
+func New(address string) *Client {
+	return &Client{URL: daemonURL(address),
+		HTTP: &http.Client{Timeout: requestTimeout}}
+}
+
+// Get URL of the daemon API at listen address
+func daemonURL(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "http://" + address
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// Send request with method to path and values, and decode its JSON reply
+// into value, if not nil. Replies with another status than OK are errors,
+// unless their status is in accept.
+func (client *Client) do(method string, path string, values url.Values,
+	value interface{}, accept ...int) error {
+
+	target := client.URL + path
+	if len(values) != 0 {
+		target += "?" + values.Encode()
+	}
+	request, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return err
+	}
+	client.authorize(request)
+
+	response, err := client.HTTP.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	accepted := response.StatusCode == http.StatusOK
+	for _, status := range accept {
+		accepted = accepted || response.StatusCode == status
+	}
+	if !accepted {
+		return fmt.Errorf("%s %s: %s: %s", method, path, response.Status,
+			bytes.TrimSpace(body))
+	}
+
+	if value == nil {
+		return nil
+	}
+	return json.Unmarshal(body, value)
+}
+
+// Authorize request with the token, if any, and the header the daemon
+// requires of requests changing fan state
+func (client *Client) authorize(request *http.Request) {
+	request.Header.Set("X-Gridfan-Request", "1")
+	if len(client.Token) != 0 {
+		request.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// GetStatus of the last daemon cycle
+func (client *Client) GetStatus() (api.Status, error) {
+	status := api.Status{}
+	err := client.do(http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+// GetHealth of the daemon, which is also returned while it is unhealthy
+func (client *Client) GetHealth() (api.Health, error) {
+	health := api.Health{}
+	err := client.do(http.MethodGet, "/health", nil, &health,
+		http.StatusServiceUnavailable)
+	return health, err
+}
+
+// GetHistory of the last samples of each series
+func (client *Client) GetHistory() (map[string][]api.Sample, error) {
+	history := map[string][]api.Sample{}
+	err := client.do(http.MethodGet, "/history", nil, &history)
+	return history, err
+}
+
+// GetChanges of the last fan speeds
+func (client *Client) GetChanges() ([]api.Change, error) {
+	changes := []api.Change{}
+	err := client.do(http.MethodGet, "/changes", nil, &changes)
+	return changes, err
+}
+
+// GetOverride of the current preset, or nil if none
+func (client *Client) GetOverride() (*api.Override, error) {
+	var override *api.Override
+	err := client.do(http.MethodGet, "/preset", nil, &override)
+	return override, err
+}
+
+// SetOverride to preset, until its ttl passes
+func (client *Client) SetOverride(preset string) (*api.Override, error) {
+	var override *api.Override
+	err := client.do(http.MethodPost, "/preset", url.Values{
+		"name": {preset}}, &override)
+	return override, err
+}
+
+// ClearOverride of the current preset, if any
+func (client *Client) ClearOverride() error {
+	return client.do(http.MethodDelete, "/preset", nil, nil)
+}
+
+// GetProfile of the current config
+func (client *Client) GetProfile() (api.ConfigStatus, error) {
+	status := api.ConfigStatus{}
+	err := client.do(http.MethodGet, "/profile", nil, &status)
+	return status, err
+}
+
+// SwitchProfile of the daemon to name, rereading its config file, or to the
+// profile matching its hostname with an empty name. The daemon goes back to
+// its startup profile when restarted.
+func (client *Client) SwitchProfile(name string) (api.ConfigStatus, error) {
+	status := api.ConfigStatus{}
+	err := client.do(http.MethodPost, "/profile", url.Values{
+		"name": {name}}, &status)
+	return status, err
+}
+
+// DisableZone until duration passes, or the override ttl without duration.
+// Returns the disabled zones, with when they are enabled again.
+func (client *Client) DisableZone(name string,
+	duration time.Duration) (map[string]*time.Time, error) {
+
+	values := url.Values{"name": {name}, "action": {"disable"}}
+	if duration > 0 {
+		values.Set("for", duration.String())
+	}
+	disabled := map[string]*time.Time{}
+	err := client.do(http.MethodPost, "/zone", values, &disabled)
+	return disabled, err
+}
+
+// EnableZone disabled at runtime. Returns the zones still disabled.
+func (client *Client) EnableZone(name string) (map[string]*time.Time, error) {
+	disabled := map[string]*time.Time{}
+	err := client.do(http.MethodPost, "/zone", url.Values{"name": {name},
+		"action": {"enable"}}, &disabled)
+	return disabled, err
+}
+
+// PushTarget rpm of zone, which the daemon applies until push_timeout
+func (client *Client) PushTarget(zone string,
+	rpm int) (api.PushedTarget, error) {
+
+	target := api.PushedTarget{}
+	err := client.do(http.MethodPost, "/zones/"+url.PathEscape(zone)+"/target",
+		url.Values{"rpm": {strconv.Itoa(rpm)}}, &target)
+	return target, err
+}
+
+// ClearTarget pushed for zone
+func (client *Client) ClearTarget(zone string) error {
+	return client.do(http.MethodDelete,
+		"/zones/"+url.PathEscape(zone)+"/target", nil, nil)
+}
+
+// StreamEvents of the daemon to handler as they happen, until ctx is done,
+// or the stream fails. Events written while the client is not connected, or
+// falls behind, are missed.
+func (client *Client) StreamEvents(ctx context.Context,
+	handler func(api.Event)) error {
+
+	request, err := http.NewRequest(http.MethodGet, client.URL+"/events", nil)
+	if err != nil {
+		return err
+	}
+	client.authorize(request)
+
+	// Streams last longer than the request timeout
+	stream := *client.HTTP
+	stream.Timeout = 0
+	response, err := stream.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /events: %s", response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		event := api.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("GET /events: bad event: %v", err)
+		}
+		handler(event)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,200 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/daemon"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Benchmark the curve of a zone against a recorded temperature trace, with
+// args: [--zone NAME] [--input FILE] [--loud RPM]. The trace is the csv of
+// history export, read from FILE, or from the daemon history. Prints the rpm
+// at every sample, and a summary of the time spent at or above the loud rpm.
+func benchCurve(config config.Config, args []string) error {
+	flags := flag.NewFlagSet("bench-curve", flag.ContinueOnError)
+	zone := flags.String("zone", "disks", "zone whose curve to run")
+	input := flags.String("input", "", "history export csv, instead of the daemon history")
+	loud := flags.Int("loud", 70, "rpm at or above which fans count as loud")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+	}
+
+	// Curve of zone, and the history series of its temperature
+	curve := config.DiskCurve.Curve
+	series := "disks"
+	panicTemp := config.DiskCurve.PanicTemp
+	if *zone != "disks" {
+		found := false
+		for _, zoneConfig := range config.Zones {
+			if zoneConfig.Name == *zone && len(zoneConfig.Points) != 0 {
+				curve = zoneConfig.Curve
+				series = "sensor/" + zoneConfig.Sensor
+				if zoneConfig.Sensor == "disks" {
+					series = "disks"
+				}
+				panicTemp = 0
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown zone, or zone without curve: %s", *zone)
+		}
+	}
+
+	var samples []daemon.Sample
+	var err error
+	if len(*input) != 0 {
+		samples, err = readHistoryCSV(*input, series)
+	} else {
+		samples, err = daemonHistory(config, series)
+	}
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no samples of series %s", series)
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+
+	return printBench(os.Stdout, *zone, curve, panicTemp, samples, *loud)
+}
+
+// Print the rpm of curve at every sample, with hysteresis and panic
+// temperature, and a summary weighing each rpm by the time until the next
+// sample
+func printBench(w io.Writer, name string, curve config.Curve, panicTemp int,
+	samples []daemon.Sample, loud int) error {
+
+	writer := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "TIME\tTEMP\tRPM\n")
+	var total, loudTime time.Duration
+	weighted, peak, changes, last, lastRPM := 0.0, 0, 0, 0, 0
+	for i, sample := range samples {
+		last = curve.EvaluateFrom(sample.Value, last)
+		rpm := last
+		if curve.Relative() {
+			rpm = config.Resolve(rpm, 20, 100)
+		}
+		if panicTemp != 0 && sample.Value >= panicTemp {
+			rpm = 100
+		}
+		if i > 0 && rpm != lastRPM {
+			changes++
+		}
+		lastRPM = rpm
+		if rpm > peak {
+			peak = rpm
+		}
+
+		if i+1 < len(samples) {
+			duration := samples[i+1].Time.Sub(sample.Time)
+			total += duration
+			weighted += float64(rpm) * duration.Seconds()
+			if rpm >= loud {
+				loudTime += duration
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%d\t%d\n",
+			sample.Time.Local().Format("2006-01-02 15:04:05"), sample.Value, rpm)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	average := 0.0
+	if total > 0 {
+		average = weighted / total.Seconds()
+	}
+	fmt.Fprintf(w, "zone %s: %d samples over %v, average rpm %.1f, peak rpm %d, %d changes\n",
+		name, len(samples), total.Round(time.Second), average, peak, changes)
+	fmt.Fprintf(w, "noise minutes at or above %d: %.1f\n", loud,
+		loudTime.Minutes())
+
+	return nil
+}
+
+// Read samples of series from the daemon history
+func daemonHistory(config config.Config, series string) ([]daemon.Sample,
+	error) {
+
+	api, err := daemonClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := api.GetHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	return history[series], nil
+}
+
+// Read samples of series from a history export csv
+func readHistoryCSV(path string, series string) ([]daemon.Sample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	samples := []daemon.Sample{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return samples, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) != 3 {
+			return nil, fmt.Errorf("line %d: expected time,series,value", line)
+		}
+		if line == 1 && record[0] == "time" {
+			continue
+		}
+		if record[1] != series {
+			continue
+		}
+
+		sampleTime, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		value, err := strconv.Atoi(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		samples = append(samples, daemon.Sample{Time: sampleTime, Value: value})
+	}
+}
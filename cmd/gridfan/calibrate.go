@@ -0,0 +1,88 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"time"
+)
+
+// Time for a fan to settle after a duty change
+const calibrateSettle = 5 * time.Second
+
+// Calibrate the stall duty of a fan, by lowering its duty until it stops.
+// Restores the fan duty afterwards.
+func calibrateFan(config config.Config, fan int) (err error) {
+	controller := config.Controller()
+
+	if !controller.IsValidFan(fan) {
+		return fmt.Errorf("bad fan index: %d", fan)
+	}
+
+	if err := controller.Open(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := controller.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	duty, err := controller.GetDuty(fan)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if restoreErr := controller.SetSpeed(fan, duty); restoreErr != nil &&
+			err == nil {
+			err = restoreErr
+		}
+	}()
+
+	// Start from full speed, and step down until the fan stops
+	stallDuty := 0
+	for rpm := 100; rpm >= 20; rpm -= 5 {
+		if err := controller.SetSpeed(fan, rpm); err != nil {
+			return err
+		}
+		time.Sleep(calibrateSettle)
+
+		speed, err := controller.GetSpeed(fan)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fan %d duty %d: %d rpm\n", fan, rpm, speed)
+
+		if speed == 0 {
+			stallDuty = rpm + 5
+			break
+		}
+	}
+
+	if stallDuty == 0 {
+		fmt.Printf("fan %d does not stall\n", fan)
+	} else if stallDuty > 100 {
+		fmt.Printf("fan %d does not spin\n", fan)
+	} else {
+		fmt.Printf("stall_duty:\n  %d: %d\n", fan, stallDuty)
+	}
+
+	return nil
+}
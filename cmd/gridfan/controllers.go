@@ -0,0 +1,65 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/controller"
+	"os"
+	"text/tabwriter"
+)
+
+// Print USB serial adapters, which may be controllers, with the device path
+// naming them by serial number, their identity and quirks profile, and
+// whether the config uses them
+func printControllers(config config.Config) error {
+	devices, err := controller.USBSerials()
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{config.DevicePath: true}
+	for _, path := range config.ChainedDevicePaths {
+		used[path] = true
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer,
+		"DEVICE PATH\tSERIAL DEVICE\tIDENTITY\tQUIRKS\tCONFIGURED\n")
+	for _, device := range devices {
+		path := controller.SerialNumberPrefix + device.SerialNumber
+		configured := "no"
+		if used[path] || used[device.DevicePath] {
+			configured = "yes"
+		}
+
+		identity, profile := "unknown", "-"
+		adapter := controller.GridFanController{DevicePath: device.DevicePath}
+		if found, err := adapter.Identify(); err == nil {
+			identity = found.String()
+			if quirks, ok := controller.LookupQuirks(found); ok {
+				profile = quirks.Profile
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", path,
+			device.DevicePath, identity, profile, configured)
+	}
+
+	return writer.Flush()
+}
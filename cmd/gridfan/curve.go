@@ -0,0 +1,142 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Widest curve chart, in columns
+const curveChartWidth = 60
+
+// Show the curve of a zone, or of the disk curve for the disks zone, as a
+// chart of rpm by temperature
+func showCurve(config config.Config, name string) error {
+	if name == "disks" {
+		return renderCurve(os.Stdout, name, config.DiskCurve.Curve)
+	}
+
+	for _, zone := range config.Zones {
+		if zone.Name != name {
+			continue
+		}
+		if len(zone.Points) == 0 {
+			return fmt.Errorf("zone %s has no curve points", name)
+		}
+		return renderCurve(os.Stdout, name, zone.Curve)
+	}
+
+	return fmt.Errorf("unknown zone: %s", name)
+}
+
+// Render curve chart, with rows of 10 rpm and a column for every one or more
+// degrees, marking curve points with o, the rpm with *, and the lower rpm
+// held by hysteresis while cooling with .
+func renderCurve(w io.Writer, name string, curve config.Curve) error {
+	if len(curve.Points) == 0 {
+		return fmt.Errorf("curve %s has no points", name)
+	}
+
+	// Temperature range around the points
+	first := curve.Points[0].Temperature - 10
+	if first < 0 {
+		first = 0
+	}
+	last := curve.Points[len(curve.Points)-1].Temperature + 10
+	if last > 100 {
+		last = 100
+	}
+	step := (last - first + curveChartWidth - 1) / curveChartWidth
+	if step == 0 {
+		step = 1
+	}
+
+	// Plot columns
+	columns := (last-first)/step + 1
+	rows := make([][]byte, 11)
+	for i := range rows {
+		rows[i] = []byte(strings.Repeat(" ", columns))
+	}
+	row := func(rpm int) int {
+		return int(math.Round(float64(rpm) / 10))
+	}
+	for column := 0; column < columns; column++ {
+		temp := first + column*step
+		rpm := curve.Evaluate(temp)
+		if held := curve.EvaluateFrom(temp, 100); held != rpm {
+			rows[row(held)][column] = '.'
+		}
+		rows[row(rpm)][column] = '*'
+	}
+	for _, point := range curve.Points {
+		if column := (point.Temperature - first) / step; column < columns {
+			rows[row(point.RPM)][column] = 'o'
+		}
+	}
+
+	// Title
+	details := []string{}
+	if curve.Relative() {
+		details = append(details, "percent of fan range")
+	}
+	if curve.Interpolate {
+		details = append(details, "interpolated")
+	}
+	if curve.Hysteresis > 0 {
+		details = append(details, fmt.Sprintf("hysteresis %d°C",
+			curve.Hysteresis))
+	}
+	fmt.Fprintf(w, "%s", name)
+	if len(details) != 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(details, ", "))
+	}
+	fmt.Fprintf(w, "\n")
+
+	// Rows from 100 rpm down, and the temperature axis
+	for i := len(rows) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "%3d |%s\n", i*10, strings.TrimRight(string(rows[i]), " "))
+	}
+	fmt.Fprintf(w, "    +%s\n", strings.Repeat("-", columns))
+
+	labels := []byte(strings.Repeat(" ", columns+3))
+	for column := 0; column < columns; column++ {
+		temp := first + column*step
+		if temp%10 != 0 && column != 0 {
+			continue
+		}
+		label := fmt.Sprintf("%d", temp)
+		if column+len(label) <= len(labels) &&
+			strings.TrimSpace(string(labels[column:column+len(label)])) == "" &&
+			(column == 0 || labels[column-1] == ' ') {
+			copy(labels[column:], label)
+		}
+	}
+	fmt.Fprintf(w, "     %s °C\n", strings.TrimRight(string(labels), " "))
+
+	fmt.Fprintf(w, "o point  * rpm")
+	if curve.Hysteresis > 0 {
+		fmt.Fprintf(w, "  . rpm while cooling")
+	}
+	fmt.Fprintf(w, "\n")
+
+	return nil
+}
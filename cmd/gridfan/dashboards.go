@@ -0,0 +1,160 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/daemon"
+	"io"
+	"os"
+	"strings"
+)
+
+// Dashboard panel size, in grid units of a 24 unit wide row
+const (
+	dashboardPanelWidth  = 12
+	dashboardPanelHeight = 8
+)
+
+// grafanaDashboard model, of the fields set by export
+type grafanaDashboard struct {
+	UID           string          `json:"uid"`
+	Title         string          `json:"title"`
+	Tags          []string        `json:"tags"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Refresh       string          `json:"refresh"`
+	Time          grafanaTime     `json:"time"`
+	Templating    grafanaTemplate `json:"templating"`
+	Panels        []grafanaPanel  `json:"panels"`
+}
+
+// grafanaTime range of a dashboard
+type grafanaTime struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// grafanaTemplate variables of a dashboard
+type grafanaTemplate struct {
+	List []grafanaVariable `json:"list"`
+}
+
+// grafanaVariable of a dashboard
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+// grafanaPanel of a dashboard
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Datasource  string          `json:"datasource"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Targets     []grafanaTarget `json:"targets"`
+}
+
+// grafanaGridPos of a panel
+type grafanaGridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// grafanaTarget query of a panel
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	Exemplar     bool   `json:"exemplar"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Export Grafana dashboard of the daemon metrics
+func exportDashboards() error {
+	return writeDashboard(os.Stdout, daemon.Metrics)
+}
+
+// Write Grafana dashboard JSON with a panel for each metric, except info
+// metrics, which only carry labels. Counters are graphed as their per
+// second rate, with their exemplars.
+func writeDashboard(w io.Writer, metrics []daemon.Metric) error {
+	dashboard := grafanaDashboard{
+		UID:           "gridfan",
+		Title:         "gridfan",
+		Tags:          []string{"gridfan"},
+		SchemaVersion: 27,
+		Refresh:       "1m",
+		Time:          grafanaTime{From: "now-24h", To: "now"},
+		Templating: grafanaTemplate{List: []grafanaVariable{{
+			Name: "datasource", Label: "Data source", Type: "datasource",
+			Query: "prometheus"}}},
+		Panels: []grafanaPanel{},
+	}
+
+	for _, metric := range metrics {
+		if strings.HasSuffix(metric.Name, "_info") {
+			continue
+		}
+
+		expr := metric.Name
+		if metric.Type == daemon.MetricCounter {
+			expr = fmt.Sprintf("rate(%s[5m])", metric.Name)
+		}
+
+		legend := "{{instance}}"
+		if len(metric.Labels) != 0 {
+			labels := []string{}
+			for _, label := range metric.Labels {
+				labels = append(labels, "{{"+label+"}}")
+			}
+			legend = strings.Join(labels, " ")
+		}
+
+		index := len(dashboard.Panels)
+		dashboard.Panels = append(dashboard.Panels, grafanaPanel{
+			ID:          index + 1,
+			Type:        "timeseries",
+			Title:       metric.Name,
+			Description: metric.Help,
+			Datasource:  "${datasource}",
+			GridPos: grafanaGridPos{
+				X: (index % 2) * dashboardPanelWidth,
+				Y: (index / 2) * dashboardPanelHeight,
+				W: dashboardPanelWidth,
+				H: dashboardPanelHeight,
+			},
+			Targets: []grafanaTarget{{RefID: "A", Expr: expr,
+				LegendFormat: legend,
+				Exemplar:     metric.Type == daemon.MetricCounter}},
+		})
+	}
+
+	contents, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", contents)
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/disk"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Print status, temperature, power management settings, identity and rated
+// maximum temperature of config disks. Only active disks are checked for temperature, so that they
+// are not woken.
+func printDisks(config config.Config) error {
+	disk.SetCommands(config.Commands, config.StrictCommands)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "DISK\tSTATUS\tTEMP\tBACKEND\tAPM\tSTANDBY TIMER\tMODEL\tSERIAL\tFIRMWARE\tCAPACITY\tMAX TEMP\n")
+
+	paths := []string{}
+	for _, diskConfig := range config.Disks {
+		paths = append(paths, diskConfig.Path)
+	}
+	duplicates := disk.Duplicates(paths)
+
+	for _, diskConfig := range config.Disks {
+		if first, ok := duplicates[diskConfig.Path]; ok {
+			fmt.Fprintf(os.Stderr, "Skipping %s, the same device as %s\n",
+				diskConfig.Path, first)
+			continue
+		}
+
+		d := disk.Disk{DevicePath: diskConfig.Path, Target: diskConfig.Target,
+			Bridge: diskConfig.Bridge}
+
+		backend, err := d.DetectBackend(config.TemperatureBackends)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to detect backend: %v\n", err)
+		}
+		d.Backend = backend
+
+		statusString := "-"
+		temperatureString := "-"
+		status, err := d.GetStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get status: %v\n", err)
+		} else {
+			statusString = status.String()
+			if status == disk.DiskStatusActive || status == disk.DiskStatusIdle {
+				temperature, err := d.GetTemperature()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to get temperature: %v\n", err)
+				} else {
+					temperatureString = strconv.Itoa(temperature)
+				}
+			}
+		}
+
+		settings, err := d.GetPowerManagement()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get power management: %v\n", err)
+		}
+
+		identity, err := d.Identify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to identify: %v\n", err)
+		}
+		d.Identity = identity
+		capacityString := "-"
+		if identity.Capacity > 0 {
+			capacityString = disk.FormatCapacity(identity.Capacity)
+		}
+
+		limits := disk.Limits{Max: diskConfig.MaxTemp,
+			Source: disk.LimitsConfig}
+		if diskConfig.MaxTemp == 0 {
+			limits, err = d.ReadLimits()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read limits: %v\n", err)
+			}
+		}
+		maxTempString := "-"
+		if limits.Max != 0 {
+			maxTempString = fmt.Sprintf("%d (%s)", limits.Max, limits.Source)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.DevicePath, statusString, temperatureString, orDash(backend),
+			orDash(settings.APMLevel), orDash(settings.StandbyTimer),
+			orDash(identity.Model), orDash(identity.Serial),
+			orDash(identity.Firmware), capacityString, maxTempString)
+	}
+
+	return writer.Flush()
+}
+
+// Value, or a dash if empty
+func orDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/cybojanek/gridfan/internal/config"
 	"github.com/cybojanek/gridfan/internal/controller"
 	"github.com/cybojanek/gridfan/internal/daemon"
+	"github.com/cybojanek/gridfan/internal/version"
 	"log"
 	"os"
 	"strconv"
@@ -36,18 +37,90 @@ func mainWrapper() (ret int) {
 	// Default return is error unless we reach end
 	ret = 1
 
+	// Version does not need a config
+	if len(os.Args) == 2 && os.Args[1] == "version" {
+		fmt.Printf("gridfan %s\n", version.String())
+		return 0
+	}
+
+	// Dashboards do not need a config
+	if len(os.Args) == 3 && os.Args[1] == "dashboards" &&
+		os.Args[2] == "export" {
+		if err := exportDashboards(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export dashboards: %v\n", err)
+			return
+		}
+		return 0
+	}
+
+	// Packaging does not need a config
+	if len(os.Args) == 4 && os.Args[1] == "packaging" &&
+		os.Args[2] == "export" {
+		if err := exportPackaging(os.Args[3]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export packaging: %v\n", err)
+			return
+		}
+		return 0
+	}
+
+	// Profile of config file, before the command
+	profile := ""
+	if len(os.Args) >= 4 && os.Args[2] == "--profile" {
+		profile = os.Args[3]
+		os.Args = append(os.Args[:2], os.Args[4:]...)
+	}
+
 	// Check usage
-	if !((len(os.Args) == 3 && os.Args[2] == "daemon") ||
+	if !((len(os.Args) >= 3 && os.Args[2] == "daemon" &&
+		daemonFlags(os.Args[3:]) != nil) ||
+		(len(os.Args) == 4 && os.Args[2] == "config" && os.Args[3] == "dump") ||
+		(len(os.Args) == 3 && os.Args[2] == "disks") ||
+		(len(os.Args) == 3 && os.Args[2] == "controllers") ||
+		(len(os.Args) == 4 && os.Args[2] == "curve" && os.Args[3] == "show") ||
+		(len(os.Args) == 5 && os.Args[2] == "curve" && os.Args[3] == "show") ||
+		(len(os.Args) >= 3 && os.Args[2] == "bench-curve") ||
+		(len(os.Args) == 3 && os.Args[2] == "status") ||
+		(len(os.Args) == 4 && os.Args[2] == "status" && os.Args[3] == "--verbose") ||
+		(len(os.Args) == 4 && os.Args[2] == "calibrate") ||
+		(len(os.Args) == 3 && os.Args[2] == "test-fans") ||
+		(len(os.Args) == 3 && os.Args[2] == "smartd-hook") ||
+		(len(os.Args) == 5 && os.Args[2] == "zone" && os.Args[3] == "enable") ||
+		(len(os.Args) == 5 && os.Args[2] == "zone" && os.Args[3] == "disable") ||
+		(len(os.Args) == 7 && os.Args[2] == "zone" && os.Args[3] == "disable" &&
+			os.Args[5] == "--for") ||
+		(len(os.Args) >= 4 && os.Args[2] == "history" && os.Args[3] == "export") ||
+		(len(os.Args) == 5 && os.Args[2] == "preset" && os.Args[3] == "apply") ||
+		(len(os.Args) == 4 && os.Args[2] == "preset" && os.Args[3] == "clear") ||
 		(len(os.Args) == 4 && os.Args[2] == "get") ||
+		(len(os.Args) == 5 && os.Args[2] == "get" && os.Args[4] == "--raw") ||
 		(len(os.Args) == 5 && os.Args[2] == "set")) {
 		fmt.Fprintf(os.Stderr, "Usage: %v\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE daemon\n")
-		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE get all|1|2|3|4|5|6\n")
-		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE set all|1|2|3|4|5|6 0|20|21|...|100\n")
+		fmt.Fprintf(os.Stderr, "  version\n")
+		fmt.Fprintf(os.Stderr, "  dashboards export\n")
+		fmt.Fprintf(os.Stderr, "  packaging export DIR\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE [--profile NAME] COMMAND ...\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE daemon [--once] [--debug-decisions]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE config dump\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE disks\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE controllers\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE curve show [ZONE]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE bench-curve [--zone NAME] [--input FILE] [--loud RPM]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE status [--verbose]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE calibrate 1..N|ALIAS\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE test-fans\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE zone disable NAME [--for DURATION]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE zone enable NAME\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE smartd-hook\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE history export [--from TIME] [--to TIME] [--format csv|json] [--series NAME,...]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE preset apply NAME\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE preset clear\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE get all|1..N|ALIAS [--raw]\n")
+		fmt.Fprintf(os.Stderr, "  YAML_CONFIG_FILE set all|1..N|ALIAS 0|20|21|...|100\n")
+		fmt.Fprintf(os.Stderr, "Fans are numbered 1..N, six per controller, chained controllers last\n")
 		return
 	}
 
-	config, err := config.Read(os.Args[1])
+	config, err := config.ReadProfile(os.Args[1], profile)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to read config: %v\n", err)
@@ -57,17 +130,129 @@ func mainWrapper() (ret int) {
 	switch os.Args[2] {
 
 	case "daemon":
-		log.Printf("INFO Starting with config: %+v", config)
-		daemon.Run(config)
+		log.Printf("INFO Starting gridfan %s", version.String())
+		log.Printf("INFO Starting with config: %s (sha256 %s)", config.Path,
+			config.SHA256)
+		if contents, err := config.Dump(); err != nil {
+			log.Printf("ERROR failed to dump config: %v", err)
+		} else {
+			log.Printf("INFO Effective config, with secrets redacted:\n%s",
+				contents)
+		}
+		flags := daemonFlags(os.Args[3:])
+		options := []daemon.Option{}
+		if flags["--debug-decisions"] {
+			options = append(options, daemon.DebugDecisions())
+		}
+		if flags["--once"] {
+			if err := daemon.New(config, options...).RunOnce(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed daemon cycle: %v\n", err)
+				return
+			}
+		} else {
+			daemon.Run(config, options...)
+		}
+
+	case "config":
+		contents, err := config.Dump()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to dump config: %v\n", err)
+			return
+		}
+		fmt.Print(string(contents))
+
+	case "disks":
+		if err := printDisks(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print disks: %v\n", err)
+			return
+		}
+
+	case "controllers":
+		if err := printControllers(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print controllers: %v\n", err)
+			return
+		}
+
+	case "curve":
+		name := "disks"
+		if len(os.Args) == 5 {
+			name = os.Args[4]
+		}
+		if err := showCurve(config, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to show curve: %v\n", err)
+			return
+		}
+
+	case "bench-curve":
+		if err := benchCurve(config, os.Args[3:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to bench curve: %v\n", err)
+			return
+		}
+
+	case "status":
+		if err := printStatus(config, len(os.Args) == 4); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get status: %v\n", err)
+			return
+		}
+
+	case "calibrate":
+		fan, err := config.Fan(os.Args[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Bad fan index: %v\n", os.Args[3])
+			return
+		}
+		if err := calibrateFan(config, fan); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to calibrate fan: %v\n", err)
+			return
+		}
+
+	case "zone":
+		duration := ""
+		if len(os.Args) == 7 {
+			duration = os.Args[6]
+		}
+		if err := setZone(config, os.Args[3], os.Args[4], duration); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s zone: %v\n", os.Args[3], err)
+			return
+		}
+
+	case "test-fans":
+		if err := testFans(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to test fans: %v\n", err)
+			return
+		}
+
+	case "smartd-hook":
+		if err := writeSmartdWarning(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write smartd warning: %v\n", err)
+			return
+		}
+
+	case "history":
+		if err := exportHistory(config, os.Args[4:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export history: %v\n", err)
+			return
+		}
+
+	case "preset":
+		if os.Args[3] == "apply" {
+			err = applyPreset(config, os.Args[4])
+		} else {
+			err = clearPreset(config)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s preset: %v\n", os.Args[3], err)
+			return
+		}
 
 	case "get":
 		fallthrough
 	case "set":
 		// Parse fans
-		fans := []int{1, 2, 3, 4, 5, 6}
+		fans := config.Controller().Fans()
 		if os.Args[3] != "all" {
 			fans = fans[0:0]
-			value, err := strconv.Atoi(os.Args[3])
+			value, err := config.Fan(os.Args[3])
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Bad fan index: %v\n", os.Args[3])
 				return
@@ -86,8 +271,12 @@ func mainWrapper() (ret int) {
 			rpm = value
 		}
 
+		// Filter speed readings, unless raw
+		raw := os.Args[2] == "get" && len(os.Args) == 5
+		filter := controller.SpeedFilter{}
+
 		// Open controller
-		controller := controller.GridFanController{DevicePath: config.DevicePath}
+		controller := config.Controller()
 		if err := controller.Open(); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to open controller: %v\n", err)
 			return
@@ -104,10 +293,32 @@ func mainWrapper() (ret int) {
 		// Run command
 		for _, fan := range fans {
 			if os.Args[2] == "get" {
-				rpm, err := controller.GetSpeed(fan)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to get speed: %v\n", err)
-					return
+				// Take the median of a few plausible readings
+				readings := 3
+				if raw {
+					readings = 1
+				}
+
+				rpm := 0
+				for i := 0; i < readings; i++ {
+					reading, err := controller.GetSpeed(fan)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Failed to get speed: %v\n", err)
+						return
+					}
+
+					rpm = reading
+					filter.Filter(fan, reading)
+				}
+				if !raw {
+					median, ok := filter.Median(fan)
+					if !ok {
+						fmt.Fprintf(os.Stderr,
+							"Failed to get speed: %d: implausible readings\n",
+							fan)
+						return
+					}
+					rpm = median
 				}
 				fmt.Printf("%d %d\n", fan, rpm)
 			} else {
@@ -124,3 +335,15 @@ func mainWrapper() (ret int) {
 	ret = 0
 	return
 }
+
+// Parse daemon flags, or nil if any is unknown or repeated
+func daemonFlags(args []string) map[string]bool {
+	flags := map[string]bool{}
+	for _, arg := range args {
+		if (arg != "--once" && arg != "--debug-decisions") || flags[arg] {
+			return nil
+		}
+		flags[arg] = true
+	}
+	return flags
+}
@@ -0,0 +1,160 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/daemon"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse time as RFC 3339, or as a duration before now, such as 1h
+func parseTime(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Check if series name matches one of the filters. A filter matches the
+// series of the same name, and the series below it, so that "fan" matches
+// "fan/4".
+func matchSeries(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+
+	for _, filter := range filters {
+		if name == filter || strings.HasPrefix(name, filter+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Export daemon history as csv or json, with args:
+// [--from TIME] [--to TIME] [--format csv|json] [--series NAME,...]
+func exportHistory(config config.Config, args []string) error {
+	flags := flag.NewFlagSet("history export", flag.ContinueOnError)
+	from := flags.String("from", "", "export samples from time (RFC 3339 or duration ago)")
+	to := flags.String("to", "", "export samples until time (RFC 3339 or duration ago)")
+	format := flags.String("format", "csv", "export format: csv or json")
+	series := flags.String("series", "", "comma separated series, such as disks,sensor/cpu,fan")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+	}
+
+	var fromTime, toTime time.Time
+	if len(*from) != 0 {
+		value, err := parseTime(*from)
+		if err != nil {
+			return fmt.Errorf("bad --from: %v", err)
+		}
+		fromTime = value
+	}
+	if len(*to) != 0 {
+		value, err := parseTime(*to)
+		if err != nil {
+			return fmt.Errorf("bad --to: %v", err)
+		}
+		toTime = value
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("bad --format: %s", *format)
+	}
+	filters := []string{}
+	if len(*series) != 0 {
+		filters = strings.Split(*series, ",")
+	}
+
+	api, err := daemonClient(config)
+	if err != nil {
+		return err
+	}
+	history, err := api.GetHistory()
+	if err != nil {
+		return err
+	}
+
+	// Filter samples
+	names := []string{}
+	for name, samples := range history {
+		if !matchSeries(name, filters) {
+			delete(history, name)
+			continue
+		}
+
+		filtered := []daemon.Sample{}
+		for _, sample := range samples {
+			if (!fromTime.IsZero() && sample.Time.Before(fromTime)) ||
+				(!toTime.IsZero() && sample.Time.After(toTime)) {
+				continue
+			}
+			filtered = append(filtered, sample)
+		}
+		history[name] = filtered
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(history)
+	}
+
+	// One row per sample, ordered by time and series
+	type row struct {
+		series string
+		sample daemon.Sample
+	}
+	rows := []row{}
+	for _, name := range names {
+		for _, sample := range history[name] {
+			rows = append(rows, row{series: name, sample: sample})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].sample.Time.Before(rows[j].sample.Time)
+	})
+
+	writer := csv.NewWriter(os.Stdout)
+	if err := writer.Write([]string{"time", "series", "value"}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write([]string{row.sample.Time.Format(time.RFC3339),
+			row.series, strconv.Itoa(row.sample.Value)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,183 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Installed paths of packages
+const (
+	packageBinary     = "/usr/bin/gridfan"
+	packageConfig     = "/etc/gridfan/gridfan.yaml"
+	packageUnit       = "/lib/systemd/system/gridfan.service"
+	packageSysusers   = "/usr/lib/sysusers.d/gridfan.conf"
+	packageStateDir   = "/var/lib/gridfan"
+	packageLogDir     = "/var/log/gridfan"
+	packageGroup      = "gridfan"
+	packageHomepage   = "https://github.com/cybojanek/gridfan"
+	packageMaintainer = "Jan Kasiak"
+)
+
+// nfpmConfig of the fields set by export
+type nfpmConfig struct {
+	Name        string        `yaml:"name"`
+	Arch        string        `yaml:"arch"`
+	Platform    string        `yaml:"platform"`
+	Version     string        `yaml:"version"`
+	Section     string        `yaml:"section"`
+	Maintainer  string        `yaml:"maintainer"`
+	Description string        `yaml:"description"`
+	Homepage    string        `yaml:"homepage"`
+	License     string        `yaml:"license"`
+	Recommends  []string      `yaml:"recommends"`
+	Suggests    []string      `yaml:"suggests"`
+	Contents    []nfpmContent `yaml:"contents"`
+	Scripts     nfpmScripts   `yaml:"scripts"`
+}
+
+// nfpmContent of a package: a file from src, or a directory
+type nfpmContent struct {
+	Src      string        `yaml:"src,omitempty"`
+	Dst      string        `yaml:"dst"`
+	Type     string        `yaml:"type,omitempty"`
+	FileInfo *nfpmFileInfo `yaml:"file_info,omitempty"`
+}
+
+// nfpmFileInfo of content
+type nfpmFileInfo struct {
+	Mode  os.FileMode `yaml:"mode"`
+	Group string      `yaml:"group,omitempty"`
+}
+
+// nfpmScripts of a package
+type nfpmScripts struct {
+	PreInstall  string `yaml:"preinstall"`
+	PostInstall string `yaml:"postinstall"`
+}
+
+// Systemd unit of the daemon, which reloads the config on SIGHUP
+var packageUnitFile = `[Unit]
+Description=gridfan fan controller
+Documentation=` + packageHomepage + `
+After=local-fs.target
+
+[Service]
+ExecStart=` + packageBinary + ` ` + packageConfig + ` daemon
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+StateDirectory=` + filepath.Base(packageStateDir) + `
+LogsDirectory=` + filepath.Base(packageLogDir) + `
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Sysusers entry of the group which can read the config, to run commands such
+// as status without root
+var packageSysusersFile = `g ` + packageGroup + ` -
+`
+
+// Package scripts, creating the group before its files are installed, and
+// reloading systemd after
+var (
+	packagePreInstall = `#!/bin/sh
+getent group ` + packageGroup + ` >/dev/null || groupadd --system ` +
+		packageGroup + `
+`
+	packagePostInstall = `#!/bin/sh
+if [ -d /run/systemd/system ]; then
+	systemctl daemon-reload
+fi
+`
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Export packaging files to directory: the nfpm config, and the systemd
+// unit, sysusers entry and scripts it packages, along with the gridfan
+// binary and sample.yaml of the current directory. nfpm expands VERSION and
+// GOARCH from the environment.
+func exportPackaging(directory string) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name     string
+		contents string
+		mode     os.FileMode
+	}{
+		{"gridfan.service", packageUnitFile, 0644},
+		{"sysusers.conf", packageSysusersFile, 0644},
+		{"preinstall.sh", packagePreInstall, 0755},
+		{"postinstall.sh", packagePostInstall, 0755},
+	}
+	for _, file := range files {
+		path := filepath.Join(directory, file.name)
+		if err := ioutil.WriteFile(path, []byte(file.contents),
+			file.mode); err != nil {
+			return err
+		}
+	}
+
+	config := nfpmConfig{
+		Name:       "gridfan",
+		Arch:       "${GOARCH}",
+		Platform:   "linux",
+		Version:    "${VERSION}",
+		Section:    "utils",
+		Maintainer: packageMaintainer,
+		Description: strings.Join([]string{
+			"Fan control for the NZXT Grid+ controller,",
+			"from disk power state and temperatures"}, " "),
+		Homepage:   packageHomepage,
+		License:    "Apache-2.0",
+		Recommends: []string{"hdparm", "smartmontools"},
+		Suggests:   []string{"hddtemp", "nvme-cli"},
+		Contents: []nfpmContent{
+			{Src: "./gridfan", Dst: packageBinary},
+			{Src: filepath.Join(directory, "gridfan.service"),
+				Dst: packageUnit},
+			{Src: filepath.Join(directory, "sysusers.conf"),
+				Dst: packageSysusers},
+			{Src: "./sample.yaml", Dst: packageConfig, Type: "config|noreplace",
+				FileInfo: &nfpmFileInfo{Mode: 0640, Group: packageGroup}},
+			{Dst: packageStateDir, Type: "dir",
+				FileInfo: &nfpmFileInfo{Mode: 0750}},
+			{Dst: packageLogDir, Type: "dir",
+				FileInfo: &nfpmFileInfo{Mode: 0750}},
+		},
+		Scripts: nfpmScripts{
+			PreInstall:  filepath.Join(directory, "preinstall.sh"),
+			PostInstall: filepath.Join(directory, "postinstall.sh"),
+		},
+	}
+
+	contents, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal nfpm config: %v", err)
+	}
+	return ioutil.WriteFile(filepath.Join(directory, "nfpm.yaml"), contents,
+		0644)
+}
@@ -0,0 +1,99 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cybojanek/gridfan/client"
+	"github.com/cybojanek/gridfan/internal/config"
+	"os"
+	"sort"
+)
+
+// Client of the daemon API at the config listen address, with its api token
+func daemonClient(config config.Config) (*client.Client, error) {
+	if len(config.ListenAddress) == 0 {
+		return nil, fmt.Errorf("listen_address is not set")
+	}
+	api := client.New(config.ListenAddress)
+	api.Token = config.APIToken
+	return api, nil
+}
+
+// Print value as JSON, as the daemon API replies
+func printJSON(value interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(value)
+}
+
+// Apply preset. With a listen address, the daemon applies it as an override,
+// otherwise all preset fans are set directly, without a ttl: a running daemon
+// sets them back on its next cycle, and without a daemon they stay set.
+func applyPreset(config config.Config, name string) (err error) {
+	preset, ok := config.Presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset: %s", name)
+	}
+
+	if len(config.ListenAddress) != 0 {
+		api, _ := daemonClient(config)
+		override, err := api.SetOverride(name)
+		if err != nil {
+			return err
+		}
+		return printJSON(override)
+	}
+
+	controller := config.Controller()
+	if err := controller.Open(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := controller.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	fans := []int{}
+	for fan := range preset.Fans {
+		fans = append(fans, fan)
+	}
+	sort.Ints(fans)
+
+	for _, fan := range fans {
+		if err := controller.SetSpeed(fan, preset.Fans[fan]); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Set preset %s directly, without listen_address: "+
+		"it has no ttl, and a running daemon sets the fans back on its next "+
+		"cycle\n", name)
+
+	return nil
+}
+
+// Clear preset override of the daemon
+func clearPreset(config config.Config) error {
+	if len(config.ListenAddress) == 0 {
+		return fmt.Errorf("clearing a preset requires listen_address")
+	}
+
+	api, _ := daemonClient(config)
+	return api.ClearOverride()
+}
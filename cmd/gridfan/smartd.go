@@ -0,0 +1,38 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/disk"
+)
+
+// Write smartd warning from the smartd environment to the smartd directory,
+// for the daemon to pick up. Run by smartd -M exec.
+func writeSmartdWarning(config config.Config) error {
+	if len(config.SmartdDir) == 0 {
+		return fmt.Errorf("smartd_dir is not set")
+	}
+
+	warning, err := disk.SmartdWarningFromEnv()
+	if err != nil {
+		return err
+	}
+
+	return disk.WriteSmartdWarning(config.SmartdDir, warning)
+}
@@ -0,0 +1,131 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"sort"
+	"strings"
+)
+
+// Format temperature in degrees celsius, or - if unknown
+func formatTemperature(temperature *int) string {
+	if temperature == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d°C", *temperature)
+}
+
+// Print status of the daemon, and with verbose, its last fan speed changes
+func printStatus(config config.Config, verbose bool) error {
+	api, err := daemonClient(config)
+	if err != nil {
+		return err
+	}
+	status, err := api.GetStatus()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("time: %s, uptime: %ds\n",
+		status.Time.Local().Format("2006-01-02 15:04:05"), status.Uptime)
+
+	if len(status.ControllerError) != 0 {
+		fmt.Printf("controller lost: %s\n", status.ControllerError)
+	}
+
+	for _, controller := range status.Controllers {
+		if len(controller.QuirksProfile) != 0 {
+			fmt.Printf("controller %s: %s, quirks %s\n", controller.DevicePath,
+				controller.Identity, controller.QuirksProfile)
+		}
+	}
+
+	for _, zone := range status.Zones {
+		state := ""
+		if zone.DiskStatus != nil {
+			state = strings.ToLower(zone.DiskStatus.String()) + " "
+		}
+		if zone.Disabled {
+			state += "disabled "
+		}
+		fmt.Printf("zone %s: %s%s, target %d (%s)\n", zone.Name, state,
+			formatTemperature(zone.Temperature), zone.TargetRPM, zone.Reason)
+	}
+
+	paths := []string{}
+	for path := range status.Disks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		identity := ""
+		if value, ok := status.Identities[path]; ok {
+			identity = fmt.Sprintf(" (%v)", value)
+		}
+		notes := ""
+		if path == status.HottestDisk {
+			notes = ", hottest"
+		}
+		if limit, ok := status.DiskLimits[path]; ok && len(limit.Level) != 0 {
+			notes += fmt.Sprintf(", %s (rated max %d°C)", limit.Level,
+				limit.Max)
+		}
+		fmt.Printf("disk %s: %s%s%s\n", path,
+			strings.ToLower(status.Disks[path].String()), notes, identity)
+	}
+
+	for _, fan := range status.Fans {
+		speed := ""
+		if fan.Speed != nil {
+			speed = fmt.Sprintf(", %d rpm", *fan.Speed)
+		}
+		fmt.Printf("fan %s: %d%s (%s)\n", config.FanName(fan.Fan), fan.RPM,
+			speed, fan.Reason)
+	}
+
+	if !verbose {
+		return nil
+	}
+
+	changes, err := api.GetChanges()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("changes:\n")
+	for _, change := range changes {
+		from := "?"
+		if change.From != nil {
+			from = fmt.Sprintf("%d", *change.From)
+		}
+		trigger := ""
+		if len(change.Zone) != 0 && change.Temperature != nil {
+			trigger = fmt.Sprintf(" zone %s at %d°C,", change.Zone,
+				*change.Temperature)
+		} else if len(change.Zone) != 0 {
+			trigger = fmt.Sprintf(" zone %s,", change.Zone)
+		}
+		fmt.Printf("  %s fan %s: %s -> %d,%s %s\n",
+			change.Time.Local().Format("2006-01-02 15:04:05"),
+			config.FanName(change.Fan), from,
+			change.To, trigger, change.Reason)
+	}
+
+	return nil
+}
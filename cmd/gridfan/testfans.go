@@ -0,0 +1,111 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Test fans of the fan_test sequence one at a time, running each at the test
+// rpm while the others stop, so that each fan header can be matched to a fan
+// in the chassis. Asks for an alias of each fan, and prints the fan_aliases.
+// Restores the fan duties afterwards.
+func testFans(config config.Config) (err error) {
+	controller := config.Controller()
+	if err := controller.Open(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := controller.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	duties := map[int]int{}
+	for _, fan := range controller.Fans() {
+		duty, err := controller.GetDuty(fan)
+		if err != nil {
+			return err
+		}
+		duties[fan] = duty
+	}
+
+	defer func() {
+		for fan, duty := range duties {
+			if restoreErr := controller.SetSpeed(fan, duty); restoreErr != nil &&
+				err == nil {
+				err = restoreErr
+			}
+		}
+	}()
+
+	aliases := map[int]string{}
+	for fan, alias := range config.FanAliases {
+		aliases[fan] = alias
+	}
+
+	input := bufio.NewReader(os.Stdin)
+	duration := time.Duration(config.FanTest.Duration) * time.Second
+	for _, fan := range config.FanTest.Fans {
+		for other := range duties {
+			rpm := 0
+			if other == fan {
+				rpm = config.FanTest.RPM
+			}
+			if err := controller.SetSpeed(other, rpm); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("fan %d at %d, others stopped for %v\n", fan,
+			config.FanTest.RPM, duration)
+		time.Sleep(duration)
+
+		fmt.Printf("alias of fan %d [%s]: ", fan, aliases[fan])
+		line, err := input.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if alias := strings.TrimSpace(line); len(alias) != 0 {
+			aliases[fan] = alias
+		}
+		if err == io.EOF {
+			fmt.Printf("\n")
+		}
+	}
+
+	fans := []int{}
+	for fan := range aliases {
+		fans = append(fans, fan)
+	}
+	sort.Ints(fans)
+
+	fmt.Printf("fan_aliases:\n")
+	for _, fan := range fans {
+		fmt.Printf("  %d: %q\n", fan, aliases[fan])
+	}
+
+	return nil
+}
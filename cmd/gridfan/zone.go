@@ -0,0 +1,57 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"time"
+)
+
+// Disable or enable zone of the daemon. A disabled zone is enabled again
+// after duration, if set.
+func setZone(config config.Config, action string, name string,
+	duration string) error {
+
+	if len(config.ListenAddress) == 0 {
+		return fmt.Errorf("zone %s requires listen_address", action)
+	}
+
+	if !config.HasZone(name) {
+		return fmt.Errorf("unknown zone: %s", name)
+	}
+
+	api, _ := daemonClient(config)
+	var disabled map[string]*time.Time
+	var err error
+	if action == "disable" {
+		var parsed time.Duration
+		if len(duration) != 0 {
+			if parsed, err = time.ParseDuration(duration); err != nil {
+				return err
+			}
+		}
+		disabled, err = api.DisableZone(name, parsed)
+	} else {
+		disabled, err = api.EnableZone(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printJSON(disabled)
+}
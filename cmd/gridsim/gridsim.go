@@ -0,0 +1,138 @@
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/simulator"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	os.Exit(mainWrapper())
+}
+
+func mainWrapper() int {
+	flags := flag.NewFlagSet("gridsim", flag.ContinueOnError)
+	listen := flags.String("listen", "",
+		"serve on a TCP address, for serial_device_path: tcp://ADDRESS, instead of a pseudo terminal")
+	link := flags.String("link", "",
+		"create a symlink to the pseudo terminal, for a stable serial_device_path")
+	maxSpeed := flags.Int("max-speed", 2000, "fan speed in rpm at 100% duty")
+	latency := flags.Duration("latency", 0, "delay of each reply")
+	drop := flags.Int("drop", 0, "percent of replies to drop")
+	corrupt := flags.Int("corrupt", 0, "percent of replies to corrupt")
+	scenario := flags.String("scenario", "", "yaml file of faults to inject")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [options]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil || flags.NArg() != 0 {
+		return 2
+	}
+
+	if *drop < 0 || *drop > 100 || *corrupt < 0 || *corrupt > 100 {
+		fmt.Fprintf(os.Stderr, "Bad percent: not in [0, 100]\n")
+		return 2
+	}
+
+	sim := simulator.New()
+	sim.MaxSpeed = *maxSpeed
+	sim.Latency = *latency
+	sim.DropPercent = *drop
+	sim.CorruptPercent = *corrupt
+	if len(*scenario) != 0 {
+		value, err := simulator.ReadScenario(*scenario)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read scenario: %v\n", err)
+			return 1
+		}
+		sim.Scenario = value
+	}
+
+	if len(*listen) != 0 {
+		if err := serveNetwork(sim, *listen); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := servePTY(sim, *link); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// Serve simulator on a TCP address
+func serveNetwork(sim *simulator.Simulator, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("INFO listening on: %s", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := sim.Serve(conn); err != nil {
+				log.Printf("ERROR failed to serve %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Serve simulator on a pseudo terminal, with an optional symlink to it
+func servePTY(sim *simulator.Simulator, link string) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	log.Printf("INFO serving on: %s", slave.Name())
+	if len(link) != 0 {
+		os.Remove(link)
+		if err := os.Symlink(slave.Name(), link); err != nil {
+			return err
+		}
+		log.Printf("INFO linked: %s", link)
+
+		// Remove symlink when stopped
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			os.Remove(link)
+			os.Exit(0)
+		}()
+	}
+
+	return sim.Serve(master)
+}
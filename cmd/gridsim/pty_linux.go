@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Open a pseudo terminal in raw mode. Returns its master, and its slave,
+// which is kept open so that the master does not fail between clients.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unlock := int32(0)
+	if err := ioctl(master, syscall.TIOCSPTLCK,
+		unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %v", err)
+	}
+
+	number := uint32(0)
+	if err := ioctl(master, syscall.TIOCGPTN,
+		unsafe.Pointer(&number)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("get pty number: %v", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", number),
+		os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	// Raw mode, so that replies are not echoed or translated
+	termios := syscall.Termios{}
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&termios)); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("get pty attributes: %v", err)
+	}
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK |
+		syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL |
+		syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON |
+		syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	if err := ioctl(slave, syscall.TCSETS, unsafe.Pointer(&termios)); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("set pty attributes: %v", err)
+	}
+
+	return master, slave, nil
+}
+
+// Run ioctl request on file
+func ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request,
+		uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
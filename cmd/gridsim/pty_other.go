@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"os"
+)
+
+// Open a pseudo terminal, which is only supported on Linux
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("pseudo terminals are not supported, use -listen")
+}
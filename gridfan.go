@@ -0,0 +1,91 @@
+// Package gridfan runs the gridfan daemon embedded in other Go programs.
+package gridfan
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/api"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/daemon"
+	"github.com/cybojanek/gridfan/internal/sensor"
+)
+
+// Config types, see sample.yaml
+type (
+	Config       = config.Config
+	Curve        = config.Curve
+	CurveInput   = config.CurveInput
+	CurvePoint   = config.CurvePoint
+	DiskConfig   = config.DiskConfig
+	FanGroup     = config.FanGroup
+	Preset       = config.Preset
+	Ramp         = config.Ramp
+	Decay        = config.Decay
+	SensorConfig = config.SensorConfig
+)
+
+// Daemon types, and the wire types of its API
+type (
+	Daemon           = daemon.Daemon
+	Option           = daemon.Option
+	Status           = api.Status
+	ZoneStatus       = api.ZoneStatus
+	ConfigStatus     = api.ConfigStatus
+	SensorReading    = api.SensorReading
+	FanStatus        = api.FanStatus
+	Override         = api.Override
+	Change           = api.Change
+	Event            = api.Event
+	Health           = api.Health
+	ControllerStatus = api.ControllerStatus
+	Sample           = api.Sample
+	PushedTarget     = api.PushedTarget
+)
+
+// Sensor types, for sensor types of other programs
+type (
+	Sensor        = sensor.Sensor
+	SensorOptions = sensor.Options
+	SensorFactory = sensor.Factory
+)
+
+// RegisterSensor type, for sensors configured with that type. Register
+// sensor types before reading the config.
+func RegisterSensor(name string, factory SensorFactory) {
+	sensor.Register(name, factory)
+}
+
+// ReadConfig from yaml file, with defaults applied
+func ReadConfig(path string) (Config, error) {
+	return config.Read(path)
+}
+
+// ReadConfigProfile from yaml file with profiles, by name, with defaults
+// applied
+func ReadConfigProfile(path string, profile string) (Config, error) {
+	return config.ReadProfile(path, profile)
+}
+
+// New daemon for config. Start it with Start, and stop it with Stop.
+func New(config Config, options ...Option) *Daemon {
+	return daemon.New(config, options...)
+}
+
+// OnStatus calls callback with the status of every daemon cycle
+func OnStatus(callback func(Status)) Option {
+	return daemon.OnStatus(callback)
+}
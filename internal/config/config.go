@@ -2,59 +2,655 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/cybojanek/gridfan/internal/controller"
+	"github.com/cybojanek/gridfan/internal/disk"
+	"github.com/cybojanek/gridfan/internal/mqtt"
+	"github.com/cybojanek/gridfan/internal/sensor"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"os"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// CurvePoint for a temperature/rpm curve
+// CurvePoint for a temperature/rpm curve. With Relative, RPM is a
+// percentage of each fan's range from its min to its max, written as min, max
+// or a percentage such as 60%.
 type CurvePoint struct {
-	Temperature int `yaml:"temp"`
-	RPM         int `yaml:"rpm"`
+	Temperature int  `yaml:"temp"`
+	RPM         int  `yaml:"rpm"`
+	Relative    bool `yaml:"-"`
 }
 
-// Config for GridFan
+// CurveInput of a weighted sensor. The sensor named "disks" is the maximum
+// temperature of all disks.
+type CurveInput struct {
+	Sensor string  `yaml:"sensor"`
+	Weight float64 `yaml:"weight"`
+}
+
+// SensorConfig of a temperature source other than disks. Type is one of the
+// registered sensor types, and Extra holds the options of other types. Raw
+// values are multiplied by Scale (1 if unset), and Offset is added.
+type SensorConfig struct {
+	Type    string                 `yaml:"type"`
+	Path    string                 `yaml:"path,omitempty"`
+	Command []string               `yaml:"command,omitempty"`
+	URL     string                 `yaml:"url,omitempty"`
+	Field   string                 `yaml:"field,omitempty"`
+	Scale   float64                `yaml:"scale,omitempty"`
+	Offset  float64                `yaml:"offset,omitempty"`
+	Extra   map[string]interface{} `yaml:",inline"`
+}
+
+// Options of sensor config, for its sensor factory
+func (sensorConfig SensorConfig) Options() sensor.Options {
+	return sensor.Options{Path: sensorConfig.Path,
+		Command: sensorConfig.Command, URL: sensorConfig.URL,
+		Field: sensorConfig.Field, Extra: sensorConfig.Extra,
+		Scale: sensor.Scale{Factor: sensorConfig.Scale,
+			Offset: sensorConfig.Offset}}
+}
+
+// DiskConfig of a disk. The YAML is either just the device path, or a mapping
+// with the device path, an optional temperature target, an optional poll
+// interval overriding the disk_curve poll interval, and an optional USB-SATA
+// bridge.
+type DiskConfig struct {
+	Path         string `yaml:"path"`
+	Target       int    `yaml:"target"`
+	PollInterval int    `yaml:"poll_interval"`
+	Bridge       string `yaml:"bridge"`
+	MaxTemp      int    `yaml:"max_temp"`
+}
+
+// UnmarshalYAML from a device path string or mapping
+func (disk *DiskConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&disk.Path); err == nil {
+		return nil
+	}
+
+	type plain DiskConfig
+	return unmarshal((*plain)(disk))
+}
+
+// FanGroup of fans, which run at an offset or ratio of the curve fans. For
+// example, exhaust fans at 10 rpm above the intake curve fans. With a
+// Cooldown, the group decays along it instead while the disks cool down.
+type FanGroup struct {
+	Name     string  `yaml:"name"`
+	Fans     []int   `yaml:"fans"`
+	Ratio    float64 `yaml:"ratio"`
+	Offset   int     `yaml:"offset"`
+	Cooldown Decay   `yaml:"cooldown"`
+}
+
+// Decay of rpms, each run for an equal part of a time, such as the cooldown
+// of sleeping disks. The YAML is either one rpm, or a list of rpms.
+type Decay []int
+
+// Maximum steps of a decay
+const maxDecaySteps = 10
+
+// UnmarshalYAML from one rpm or a list
+func (decay *Decay) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var rpm int
+	if err := unmarshal(&rpm); err == nil {
+		*decay = Decay{rpm}
+		return nil
+	}
+
+	var rpms []int
+	if err := unmarshal(&rpms); err != nil {
+		return err
+	}
+	*decay = rpms
+	return nil
+}
+
+// At progress in [0, 1] of the decay time, the rpm of its step, or 0 if it
+// has none
+func (decay Decay) At(progress float64) int {
+	if len(decay) == 0 {
+		return 0
+	}
+
+	step := int(progress * float64(len(decay)))
+	if step < 0 {
+		step = 0
+	}
+	if step >= len(decay) {
+		step = len(decay) - 1
+	}
+	return decay[step]
+}
+
+// Check decay has at most maxDecaySteps valid rpms
+func (decay Decay) check(chain *controller.Chain) error {
+	if len(decay) > maxDecaySteps {
+		return fmt.Errorf("%d steps, more than %d", len(decay),
+			maxDecaySteps)
+	}
+
+	for _, rpm := range decay {
+		if !chain.IsValidRPM(rpm) {
+			return fmt.Errorf("rpm: %d", rpm)
+		}
+	}
+	return nil
+}
+
+// FanLimit of the rpm range of a fan, which min and max resolve to in curves
+// of relative points.
+type FanLimit struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+// Zone of fans with their own curve of a sensor temperature, besides the
+// disks zone of the disk_curve. Fans run at least at the targets of the zones
+// they follow, for example exhaust fans following the intake fans.
+type Zone struct {
+	Curve `yaml:",inline"`
+
+	Name         string   `yaml:"name"`
+	Fans         []int    `yaml:"fans"`
+	Sensor       string   `yaml:"sensor"`
+	Follow       []string `yaml:"follow"`
+	CriticalTemp int      `yaml:"critical_temp"`
+}
+
+// Preset of fan rpms, applied on demand. The daemon keeps the preset fans at
+// their rpm for TTL seconds, or for the config override TTL if TTL is 0.
+type Preset struct {
+	Fans map[int]int `yaml:"fans"`
+	TTL  int         `yaml:"ttl"`
+}
+
+// Threshold of a zone temperature, with an action when reached. The YAML is
+// either just the temperature, for a log action, or a mapping.
+type Threshold struct {
+	Temperature int      `yaml:"temp"`
+	Action      string   `yaml:"action"`
+	RPM         int      `yaml:"rpm"`
+	Command     []string `yaml:"command"`
+}
+
+// UnmarshalYAML from a temperature or mapping
+func (threshold *Threshold) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&threshold.Temperature); err == nil {
+		return nil
+	}
+
+	type plain Threshold
+	return unmarshal((*plain)(threshold))
+}
+
+// Threshold actions
+const (
+	// Log when reached and left
+	ThresholdLog = "log"
+
+	// Log, and write an event when reached and left
+	ThresholdAlert = "alert"
+
+	// Run fans at least at rpm while reached
+	ThresholdBoost = "boost"
+
+	// Run command when reached
+	ThresholdCommand = "command"
+)
+
+// Actions on fan duties changed by something else than the daemon
+const (
+	// Set the fan again
+	ExternalReassert = "reassert"
+
+	// Keep the changed duty, until the fan target changes
+	ExternalAdopt = "adopt"
+
+	// Only log and write an event
+	ExternalAlert = "alert"
+)
+
+// Stall actions, for fans below their stall duty
+const (
+	// Raise to the stall duty
+	StallRaise = "raise"
+
+	// Stop the fan
+	StallStop = "stop"
+)
+
+// Actions on zone temperatures above their critical temperature
+const (
+	// Only log and write an event
+	CriticalNone = "none"
+
+	// Shut down the host
+	CriticalShutdown = "shutdown"
+
+	// Run the critical command
+	CriticalCommand = "command"
+)
+
+// Disk curve behaviors for disk power states
+const (
+	// Cooldown, and then sleeping rpm
+	BehaviorSleep = "sleep"
+
+	// Standby rpm
+	BehaviorStandby = "standby"
+
+	// Temperature curve
+	BehaviorCurve = "curve"
+)
+
+// Disk curve status detection
+const (
+	// Check disk power states
+	StatusDetectionOn = "on"
+
+	// Only read temperatures, and treat disks without one as in standby
+	StatusDetectionOff = "off"
+)
+
+// Disk curve behaviors when all disks are removed
+const (
+	// Cooldown, and then sleeping rpm, as if the disks were sleeping
+	RemovedSleep = "sleep"
+
+	// Hold the last target rpm
+	RemovedHold = "hold"
+
+	// Failsafe rpm, as on errors
+	RemovedFailsafe = "failsafe"
+)
+
+// DisksSensor is the name of the disk temperature curve input
+const DisksSensor = "disks"
+
+// OverrideFilePreset is the preset name of override file requests of fans,
+// without a preset, which presets can not use
+const OverrideFilePreset = "override_file"
+
+// Config for GridFan. Path, SHA256 and Loaded are those of the config file
+// it was read from, if any, and Profile is the profile selected from it.
 type Config struct {
-	ConstantRPM map[int]int `yaml:"constant_rpm"`
-	CurveFans   []int       `yaml:"curve_fans"`
-	DevicePath  string      `yaml:"serial_device_path"`
-	Disks       []string    `yaml:"disks"`
-	DiskCurve   struct {
-		Points          []CurvePoint `yaml:"points"`
-		PollInterval    int          `yaml:"poll_interval"`
-		CooldownTimeout int          `yaml:"cooldown_timeout"`
+	Path    string    `yaml:"-"`
+	SHA256  string    `yaml:"-"`
+	Loaded  time.Time `yaml:"-"`
+	Profile string    `yaml:"-"`
+
+	CommandBurst           int                     `yaml:"command_burst"`
+	CommandDelay           int                     `yaml:"command_delay"`
+	Commands               map[string]string       `yaml:"commands"`
+	StrictCommands         bool                    `yaml:"strict_commands"`
+	ConstantRPM            map[int]int             `yaml:"constant_rpm"`
+	ConstantRPMOnPanic     bool                    `yaml:"constant_rpm_override_on_panic"`
+	ConstantVerifyInterval int                     `yaml:"constant_verify_interval"`
+	ControllerQuirks       string                  `yaml:"controller_quirks"`
+	ConfirmDevice          bool                    `yaml:"confirm_device"`
+	ChainedDevicePaths     []string                `yaml:"chained_device_paths"`
+	CriticalAction         string                  `yaml:"critical_action"`
+	CriticalCommand        []string                `yaml:"critical_command"`
+	CriticalDuration       int                     `yaml:"critical_duration"`
+	CurveFans              []int                   `yaml:"curve_fans"`
+	DevicePath             string                  `yaml:"serial_device_path"`
+	EventLog               string                  `yaml:"event_log"`
+	Disks                  []DiskConfig            `yaml:"disks"`
+	FailsafeRPM            int                     `yaml:"failsafe_rpm"`
+	FanAliases             map[int]string          `yaml:"fan_aliases"`
+	FanGroups              []FanGroup              `yaml:"fan_groups"`
+	FanLimits              map[int]FanLimit        `yaml:"fan_limits"`
+	Follow                 string                  `yaml:"follow"`
+	ListenAddress          string                  `yaml:"listen_address"`
+	APIToken               string                  `yaml:"api_token"`
+	LogTemperatureDelta    int                     `yaml:"log_temperature_delta"`
+	OnExternalChange       string                  `yaml:"on_external_change"`
+	Presets                map[string]Preset       `yaml:"presets"`
+	OverrideTTL            int                     `yaml:"override_ttl"`
+	OverrideDebounce       int                     `yaml:"override_debounce"`
+	OverrideFile           string                  `yaml:"override_file"`
+	OpenRetry              int                     `yaml:"open_retry"`
+	OpenRetryInterval      int                     `yaml:"open_retry_interval"`
+	PingFan                int                     `yaml:"ping_fan"`
+	PushTargets            bool                    `yaml:"push_targets"`
+	PushTimeout            int                     `yaml:"push_timeout"`
+	ReadSpeeds             bool                    `yaml:"read_speeds"`
+	ReadbackTolerance      int                     `yaml:"readback_tolerance"`
+	SensorOnly             bool                    `yaml:"sensor_only"`
+	SmartdDir              string                  `yaml:"smartd_dir"`
+	SkipPing               bool                    `yaml:"skip_ping_on_open"`
+	StallAction            string                  `yaml:"stall_action"`
+	StateFile              string                  `yaml:"state_file"`
+	StallDuty              map[int]int             `yaml:"stall_duty"`
+	Sensors                map[string]SensorConfig `yaml:"sensors"`
+	TemperatureBackends    []string                `yaml:"temperature_backends"`
+	VerifyInterval         int                     `yaml:"verify_interval"`
+	Zones                  []Zone                  `yaml:"zones"`
+	Dither                 struct {
+		Percent  int `yaml:"percent"`
+		Interval int `yaml:"interval"`
+	} `yaml:"dither"`
+	FanTest struct {
+		Fans     []int `yaml:"fans"`
+		RPM      int   `yaml:"rpm"`
+		Duration int   `yaml:"duration"`
+	} `yaml:"fan_test"`
+	Hooks struct {
+		BeforeChange []string `yaml:"before_change"`
+		AfterChange  []string `yaml:"after_change"`
+		MinChange    int      `yaml:"min_change"`
+		Timeout      int      `yaml:"timeout"`
+	} `yaml:"hooks"`
+	MQTT struct {
+		Broker          string `yaml:"broker"`
+		CAFile          string `yaml:"ca_file"`
+		ClientID        string `yaml:"client_id"`
+		DiscoveryPrefix string `yaml:"discovery_prefix"`
+		Password        string `yaml:"password"`
+		TopicPrefix     string `yaml:"topic_prefix"`
+		Username        string `yaml:"username"`
+	} `yaml:"mqtt"`
+	Schedule struct {
+		StartJitter int `yaml:"start_jitter"`
+		Phase       int `yaml:"phase"`
+	} `yaml:"schedule"`
+	ThermalRunaway struct {
+		Cycles  int      `yaml:"cycles"`
+		Command []string `yaml:"command"`
+	} `yaml:"thermal_runaway"`
+	DiskCurve struct {
+		Curve `yaml:",inline"`
+
+		Ambient         string               `yaml:"ambient"`
+		DiskTarget      int                  `yaml:"disk_target"`
+		DriveLimits     bool                 `yaml:"drive_limits"`
+		Gentle          bool                 `yaml:"gentle"`
+		HotDuty         int                  `yaml:"hot_duty"`
+		Inputs          []CurveInput         `yaml:"inputs"`
+		LimitMargin     int                  `yaml:"limit_margin"`
+		OnRemoved       string               `yaml:"on_removed"`
+		PanicTemp       int                  `yaml:"panic_temp"`
+		PollInterval    int                  `yaml:"poll_interval"`
+		PowerStates     map[string]string    `yaml:"power_states"`
+		CooldownTimeout int                  `yaml:"cooldown_timeout"`
+		CriticalTemp    int                  `yaml:"critical_temp"`
+		StaleTTL        int                  `yaml:"stale_ttl"`
+		Stagger         int                  `yaml:"stagger"`
+		StatusDetection string               `yaml:"status_detection"`
+		StopBelowTemp   int                  `yaml:"stop_below_temp"`
+		StartAboveTemp  int                  `yaml:"start_above_temp"`
+		Thresholds      map[string]Threshold `yaml:"thresholds"`
+		WarningTemp     int                  `yaml:"warning_temp"`
+		WakeBoostRPM    int                  `yaml:"wake_boost_rpm"`
+		WakeBoostTime   int                  `yaml:"wake_boost_duration"`
 		RPM             struct {
-			Sleeping int `yaml:"sleeping"`
-			Cooldown int `yaml:"cooldown"`
-			Standby  int `yaml:"standby"`
+			Sleeping int   `yaml:"sleeping"`
+			Cooldown Decay `yaml:"cooldown"`
+			Standby  int   `yaml:"standby"`
 		} `yaml:"rpm"`
+		TrendBoost struct {
+			Slope  float64 `yaml:"slope"`
+			Window int     `yaml:"window"`
+			RPM    int     `yaml:"rpm"`
+		} `yaml:"trend_boost"`
 	} `yaml:"disk_curve"`
 }
 
-// Read yaml config file.
+// Read yaml config file, selecting the profile of this host, if it has
+// profiles.
 func Read(path string) (Config, error) {
-	config := Config{}
-	controller := controller.GridFanController{}
+	return ReadProfile(path, "")
+}
+
+// ReadProfile of yaml config file, by name, or else the profile of this host,
+// if it has profiles.
+func ReadProfile(path string, profile string) (Config, error) {
+	config := Config{ConfirmDevice: true}
 
 	// Read config file
-	configContents, err := ioutil.ReadFile(os.Args[1])
+	configContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	// Select profile
+	profileContents, profile, err := selectProfile(configContents, profile)
 	if err != nil {
 		return config, err
 	}
 
 	// yaml decode
-	err = yaml.Unmarshal(configContents, &config)
+	err = yaml.Unmarshal(profileContents, &config)
 	if err != nil {
 		return config, err
 	}
+	hash := sha256.Sum256(configContents)
+	config.Path = path
+	config.SHA256 = hex.EncodeToString(hash[:])
+	config.Loaded = time.Now()
+	config.Profile = profile
+
+	// Check ControllerQuirks, before the controller package is shadowed
+	switch config.ControllerQuirks {
+	case "", controller.QuirksAuto, controller.QuirksNone:
+	default:
+		if _, ok := controller.NamedQuirks(config.ControllerQuirks); !ok {
+			return config, fmt.Errorf("Read: Invalid controller_quirks: %s",
+				config.ControllerQuirks)
+		}
+	}
+
+	if config.ReadbackTolerance < 0 || config.ReadbackTolerance > 10 {
+		return config, fmt.Errorf(
+			"Read: Invalid readback_tolerance: %d not in [0, 10]",
+			config.ReadbackTolerance)
+	}
+
+	controller := config.Controller()
+
+	// Check Follow
+	if len(config.Follow) != 0 && config.SensorOnly {
+		return config, fmt.Errorf(
+			"Read: follow can not be used with sensor_only")
+	}
 
 	// Check DevicePath
-	if len(config.DevicePath) == 0 {
+	if config.SensorOnly {
+		zoneFans := false
+		for _, zone := range config.Zones {
+			zoneFans = zoneFans || len(zone.Fans) != 0
+		}
+		if len(config.ConstantRPM) != 0 || len(config.CurveFans) != 0 ||
+			len(config.FanGroups) != 0 || zoneFans {
+			return config, fmt.Errorf(
+				"Read: sensor_only can not be used with constant_rpm, curve_fans, fan_groups or zone fans")
+		}
+	} else if len(config.DevicePath) == 0 {
 		return config, fmt.Errorf("Read: Missing serial_device_path")
 	}
 
+	// Check ChainedDevicePaths
+	devicePaths := map[string]bool{config.DevicePath: true}
+	for _, path := range config.ChainedDevicePaths {
+		if len(path) == 0 || devicePaths[path] {
+			return config, fmt.Errorf(
+				"Read: Invalid chained_device_paths: [%s] is empty or repeated",
+				path)
+		}
+		devicePaths[path] = true
+	}
+
+	// Check CommandDelay and CommandBurst
+	if config.CommandDelay < 0 || config.CommandDelay > 1000 {
+		return config, fmt.Errorf(
+			"Read: Invalid command_delay: %d not in [0, 1000]",
+			config.CommandDelay)
+	}
+
+	if config.CommandBurst < 0 || config.CommandBurst > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid command_burst: %d not in [0, 100]",
+			config.CommandBurst)
+	}
+
+	// Check OpenRetry and OpenRetryInterval
+	if config.OpenRetry < 0 || config.OpenRetry > 1000 {
+		return config, fmt.Errorf(
+			"Read: Invalid open_retry: %d not in [0, 1000]", config.OpenRetry)
+	}
+
+	if config.OpenRetryInterval == 0 {
+		config.OpenRetryInterval = 1
+	} else if config.OpenRetryInterval < 0 || config.OpenRetryInterval > 60 {
+		return config, fmt.Errorf(
+			"Read: Invalid open_retry_interval: %d not in [1, 60]",
+			config.OpenRetryInterval)
+	}
+
+	// Check PushTargets and PushTimeout
+	if config.PushTargets && len(config.ListenAddress) == 0 {
+		return config, fmt.Errorf("Read: push_targets requires listen_address")
+	}
+
+	if config.PushTimeout == 0 {
+		config.PushTimeout = 60
+	} else if config.PushTimeout < 0 || config.PushTimeout > 86400 {
+		return config, fmt.Errorf(
+			"Read: Invalid push_timeout: %d not in [1, 86400]",
+			config.PushTimeout)
+	}
+
+	// Check LogTemperatureDelta
+	if config.LogTemperatureDelta < 0 || config.LogTemperatureDelta > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid log_temperature_delta: %d not in [0, 100]",
+			config.LogTemperatureDelta)
+	}
+
+	// Check OverrideDebounce
+	if config.OverrideDebounce < 0 || config.OverrideDebounce > 60000 {
+		return config, fmt.Errorf(
+			"Read: Invalid override_debounce: %d not in [0, 60000]",
+			config.OverrideDebounce)
+	}
+
+	// Check OverrideTTL and StateFile
+	if config.OverrideTTL == 0 {
+		config.OverrideTTL = 3600
+	} else if config.OverrideTTL < 0 || config.OverrideTTL > 604800 {
+		return config, fmt.Errorf(
+			"Read: Invalid override_ttl: %d not in [1, 604800]",
+			config.OverrideTTL)
+	}
+
+	if len(config.StateFile) != 0 && !filepath.IsAbs(config.StateFile) {
+		return config, fmt.Errorf("Read: Invalid state_file: %s is not absolute",
+			config.StateFile)
+	}
+
+	// Check OverrideFile
+	if len(config.OverrideFile) != 0 && !filepath.IsAbs(config.OverrideFile) {
+		return config, fmt.Errorf(
+			"Read: Invalid override_file: %s is not absolute",
+			config.OverrideFile)
+	}
+
+	// Check MQTT, whose topics hold zone names
+	broker := strings.TrimPrefix(config.MQTT.Broker, mqtt.TLSPrefix)
+	tls := broker != config.MQTT.Broker
+	if mqtt := &config.MQTT; len(mqtt.Broker) != 0 {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return config, fmt.Errorf("Read: Invalid mqtt broker: %s",
+				mqtt.Broker)
+		}
+		if len(mqtt.CAFile) != 0 && (!tls || !filepath.IsAbs(mqtt.CAFile)) {
+			return config, fmt.Errorf(
+				"Read: Invalid mqtt ca_file: %s is not absolute, or the broker is not tls://",
+				mqtt.CAFile)
+		}
+		if len(mqtt.ClientID) == 0 {
+			mqtt.ClientID = "gridfan"
+		}
+		if len(mqtt.DiscoveryPrefix) == 0 {
+			mqtt.DiscoveryPrefix = "homeassistant"
+		}
+		if len(mqtt.TopicPrefix) == 0 {
+			mqtt.TopicPrefix = "gridfan"
+		}
+		for _, prefix := range []string{mqtt.DiscoveryPrefix, mqtt.TopicPrefix} {
+			if strings.ContainsAny(prefix, "+#") ||
+				strings.HasSuffix(prefix, "/") {
+				return config, fmt.Errorf("Read: Invalid mqtt topic prefix: %s",
+					prefix)
+			}
+		}
+		for _, zone := range config.Zones {
+			if strings.ContainsAny(zone.Name, "/+#") {
+				return config, fmt.Errorf(
+					"Read: Invalid zone name for mqtt: %s", zone.Name)
+			}
+		}
+	}
+
+	// Check SmartdDir
+	if len(config.SmartdDir) != 0 && !filepath.IsAbs(config.SmartdDir) {
+		return config, fmt.Errorf("Read: Invalid smartd_dir: %s is not absolute",
+			config.SmartdDir)
+	}
+
+	// Check PingFan, which is a fan number of each controller
+	if config.PingFan != 0 &&
+		!controller.Controllers[0].IsValidFan(config.PingFan) {
+		return config, fmt.Errorf("Read: Invalid ping_fan: %d",
+			config.PingFan)
+	}
+
+	// Check FailsafeRPM
+	if config.FailsafeRPM == 0 {
+		config.FailsafeRPM = 100
+	} else if !controller.IsValidRPM(config.FailsafeRPM) {
+		return config, fmt.Errorf("Read: Invalid failsafe_rpm: %d",
+			config.FailsafeRPM)
+	}
+
+	// Check Commands
+	for name, path := range config.Commands {
+		known := false
+		for _, commandName := range disk.CommandNames {
+			known = known || name == commandName
+		}
+		if !known {
+			return config, fmt.Errorf("Read: Unknown command: %s", name)
+		}
+
+		if err := disk.CheckCommand(path); err != nil {
+			return config, fmt.Errorf("Read: Invalid command %s: %v", name, err)
+		}
+	}
+
+	// Check TemperatureBackends
+	for _, backend := range config.TemperatureBackends {
+		known := false
+		for _, name := range disk.Backends {
+			known = known || backend == name
+		}
+		if !known {
+			return config, fmt.Errorf(
+				"Read: Unknown temperature_backends backend: %s", backend)
+		}
+	}
+	if len(config.TemperatureBackends) == 0 {
+		config.TemperatureBackends = disk.Backends
+	}
+
 	// Check ConstantRPM fans
 	for fan, rpm := range config.ConstantRPM {
 		if !controller.IsValidFan(fan) {
@@ -66,6 +662,111 @@ func Read(path string) (Config, error) {
 		}
 	}
 
+	// Check ConstantVerifyInterval
+	if config.ConstantVerifyInterval < 0 ||
+		config.ConstantVerifyInterval > 86400 {
+		return config, fmt.Errorf(
+			"Read: Invalid constant_verify_interval: %d not in [0, 86400]",
+			config.ConstantVerifyInterval)
+	}
+
+	// Check VerifyInterval and OnExternalChange
+	if config.VerifyInterval < 0 || config.VerifyInterval > 86400 {
+		return config, fmt.Errorf(
+			"Read: Invalid verify_interval: %d not in [0, 86400]",
+			config.VerifyInterval)
+	}
+
+	switch config.OnExternalChange {
+	case "":
+		config.OnExternalChange = ExternalReassert
+	case ExternalReassert, ExternalAdopt, ExternalAlert:
+	default:
+		return config, fmt.Errorf("Read: Invalid on_external_change: %s",
+			config.OnExternalChange)
+	}
+
+	// Check CriticalAction, CriticalCommand and CriticalDuration
+	switch config.CriticalAction {
+	case "":
+		config.CriticalAction = CriticalNone
+	case CriticalNone, CriticalShutdown:
+	case CriticalCommand:
+		if len(config.CriticalCommand) == 0 {
+			return config, fmt.Errorf(
+				"Read: critical_action command missing critical_command")
+		}
+	default:
+		return config, fmt.Errorf("Read: Invalid critical_action: %s",
+			config.CriticalAction)
+	}
+
+	if config.CriticalDuration == 0 {
+		config.CriticalDuration = 60
+	} else if config.CriticalDuration < 0 || config.CriticalDuration > 3600 {
+		return config, fmt.Errorf(
+			"Read: Invalid critical_duration: %d not in [1, 3600]",
+			config.CriticalDuration)
+	}
+
+	// Check Dither
+	if config.Dither.Percent < 0 || config.Dither.Percent > 50 {
+		return config, fmt.Errorf(
+			"Read: Invalid dither percent: %d not in [0, 50]",
+			config.Dither.Percent)
+	}
+
+	if config.Dither.Interval < 0 || config.Dither.Interval > 86400 {
+		return config, fmt.Errorf(
+			"Read: Invalid dither interval: %d not in [0, 86400]",
+			config.Dither.Interval)
+	}
+
+	if config.Dither.Percent > 0 && config.Dither.Interval == 0 {
+		config.Dither.Interval = 300
+	}
+
+	// Check Hooks
+	if config.Hooks.MinChange < 0 || config.Hooks.MinChange > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid hooks min_change: %d not in [0, 100]",
+			config.Hooks.MinChange)
+	}
+
+	if config.Hooks.Timeout == 0 {
+		config.Hooks.Timeout = 10
+	} else if config.Hooks.Timeout < 0 || config.Hooks.Timeout > 300 {
+		return config, fmt.Errorf(
+			"Read: Invalid hooks timeout: %d not in [1, 300]",
+			config.Hooks.Timeout)
+	}
+
+	// Check Schedule
+	if config.Schedule.StartJitter < 0 || config.Schedule.StartJitter > 3600 {
+		return config, fmt.Errorf(
+			"Read: Invalid schedule start_jitter: %d not in [0, 3600]",
+			config.Schedule.StartJitter)
+	}
+
+	if config.Schedule.Phase < 0 || config.Schedule.Phase > 3600 {
+		return config, fmt.Errorf(
+			"Read: Invalid schedule phase: %d not in [0, 3600]",
+			config.Schedule.Phase)
+	}
+
+	// Check ThermalRunaway
+	if config.ThermalRunaway.Cycles < 0 || config.ThermalRunaway.Cycles > 1000 {
+		return config, fmt.Errorf(
+			"Read: Invalid thermal_runaway cycles: %d not in [0, 1000]",
+			config.ThermalRunaway.Cycles)
+	}
+
+	if len(config.ThermalRunaway.Command) != 0 &&
+		config.ThermalRunaway.Cycles == 0 {
+		return config, fmt.Errorf(
+			"Read: thermal_runaway command requires cycles")
+	}
+
 	// Check DiskControlled.Fans
 	for _, fan := range config.CurveFans {
 		if !controller.IsValidFan(fan) {
@@ -80,15 +781,205 @@ func Read(path string) (Config, error) {
 		}
 	}
 
+	// Check FanGroups
+	groupFans := map[int]bool{}
+	for _, group := range config.FanGroups {
+		if len(group.Name) == 0 {
+			return config, fmt.Errorf("Read: Missing fan group name")
+		}
+
+		if group.Ratio < 0 {
+			return config, fmt.Errorf(
+				"Read: Invalid fan group %s ratio: %v must not be negative",
+				group.Name, group.Ratio)
+		}
+
+		if group.Offset < -100 || group.Offset > 100 {
+			return config, fmt.Errorf(
+				"Read: Invalid fan group %s offset: %d not in [-100, 100]",
+				group.Name, group.Offset)
+		}
+
+		if err := group.Cooldown.check(controller); err != nil {
+			return config, fmt.Errorf(
+				"Read: Invalid fan group %s cooldown %v", group.Name, err)
+		}
+
+		for _, fan := range group.Fans {
+			if !controller.IsValidFan(fan) {
+				return config, fmt.Errorf("Read: Invalid fan index: %d", fan)
+			}
+
+			// Can only be present in one
+			_, constant := config.ConstantRPM[fan]
+			curve := false
+			for _, curveFan := range config.CurveFans {
+				curve = curve || curveFan == fan
+			}
+			if constant || curve || groupFans[fan] {
+				return config, fmt.Errorf(
+					"Read: Fan %d present in more than one of constant_rpm, curve_fans and fan_groups",
+					fan)
+			}
+			groupFans[fan] = true
+		}
+	}
+
+	// Check FanAliases
+	aliases := map[string]bool{}
+	for fan, alias := range config.FanAliases {
+		if !controller.IsValidFan(fan) {
+			return config, fmt.Errorf("Read: Invalid fan_aliases fan index: %d",
+				fan)
+		}
+		if len(alias) == 0 {
+			return config, fmt.Errorf("Read: Missing fan_aliases fan %d alias",
+				fan)
+		}
+		if _, err := strconv.Atoi(alias); err == nil || alias == "all" {
+			return config, fmt.Errorf(
+				"Read: Invalid fan_aliases fan %d alias: %s", fan, alias)
+		}
+		if aliases[alias] {
+			return config, fmt.Errorf("Read: Duplicate fan_aliases alias: %s",
+				alias)
+		}
+		aliases[alias] = true
+	}
+
+	// Check FanTest
+	for _, fan := range config.FanTest.Fans {
+		if !controller.IsValidFan(fan) {
+			return config, fmt.Errorf("Read: Invalid fan_test fan index: %d",
+				fan)
+		}
+	}
+	if len(config.FanTest.Fans) == 0 {
+		config.FanTest.Fans = controller.Fans()
+	}
+
+	if config.FanTest.RPM == 0 {
+		config.FanTest.RPM = 100
+	} else if !controller.IsValidRPM(config.FanTest.RPM) {
+		return config, fmt.Errorf("Read: Invalid fan_test rpm: %d",
+			config.FanTest.RPM)
+	}
+
+	if config.FanTest.Duration == 0 {
+		config.FanTest.Duration = 5
+	} else if config.FanTest.Duration < 0 || config.FanTest.Duration > 60 {
+		return config, fmt.Errorf(
+			"Read: Invalid fan_test duration: %d not in [1, 60]",
+			config.FanTest.Duration)
+	}
+
+	// Check StallDuty and StallAction
+	for fan, duty := range config.StallDuty {
+		if !controller.IsValidFan(fan) {
+			return config, fmt.Errorf("Read: Invalid stall_duty fan index: %d",
+				fan)
+		}
+		if duty == 0 || !controller.IsValidRPM(duty) {
+			return config, fmt.Errorf(
+				"Read: Invalid stall_duty fan %d duty: %d", fan, duty)
+		}
+	}
+
+	switch config.StallAction {
+	case "":
+		config.StallAction = StallRaise
+	case StallRaise, StallStop:
+	default:
+		return config, fmt.Errorf("Read: Invalid stall_action: %s",
+			config.StallAction)
+	}
+
+	// Check FanLimits
+	for fan, limit := range config.FanLimits {
+		if !controller.IsValidFan(fan) {
+			return config, fmt.Errorf("Read: Invalid fan_limits fan index: %d",
+				fan)
+		}
+		if limit.Min != 0 && !controller.IsValidRPM(limit.Min) {
+			return config, fmt.Errorf(
+				"Read: Invalid fan_limits fan %d min: %d", fan, limit.Min)
+		}
+		if limit.Max != 0 && !controller.IsValidRPM(limit.Max) {
+			return config, fmt.Errorf(
+				"Read: Invalid fan_limits fan %d max: %d", fan, limit.Max)
+		}
+		if min, max := config.FanRange(fan); min > max {
+			return config, fmt.Errorf(
+				"Read: Invalid fan_limits fan %d: min %d above max %d", fan,
+				min, max)
+		}
+	}
+
+	// Check Presets
+	for name, preset := range config.Presets {
+		if name == OverrideFilePreset {
+			return config, fmt.Errorf("Read: Reserved preset name: %s", name)
+		}
+
+		for fan, rpm := range preset.Fans {
+			if !controller.IsValidFan(fan) {
+				return config, fmt.Errorf(
+					"Read: Invalid preset %s fan index: %d", name, fan)
+			}
+			if !controller.IsValidRPM(rpm) {
+				return config, fmt.Errorf(
+					"Read: Invalid preset %s fan %d rpm: %d", name, fan, rpm)
+			}
+		}
+
+		if preset.TTL < 0 {
+			return config, fmt.Errorf(
+				"Read: Invalid preset %s ttl: %d must not be negative",
+				name, preset.TTL)
+		}
+	}
+
+	// Default FanGroups ratio
+	for i := range config.FanGroups {
+		if config.FanGroups[i].Ratio == 0 {
+			config.FanGroups[i].Ratio = 1
+		}
+	}
+
+	// Check PowerStates
+	powerStates := map[string]string{
+		"sleeping": BehaviorSleep,
+		"standby":  BehaviorSleep,
+		"unknown":  BehaviorStandby,
+		"idle":     BehaviorCurve,
+		"active":   BehaviorCurve,
+	}
+	for state, behavior := range config.DiskCurve.PowerStates {
+		status, err := disk.ParseStatus(state)
+		if err != nil {
+			return config, fmt.Errorf("Read: Invalid disk_curve power state: %s",
+				state)
+		}
+
+		switch behavior {
+		case BehaviorSleep, BehaviorStandby, BehaviorCurve:
+			powerStates[strings.ToLower(status.String())] = behavior
+		default:
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve power state %s behavior: %s",
+				state, behavior)
+		}
+	}
+	config.DiskCurve.PowerStates = powerStates
+
 	// Check Sleeping, Cooldown and Standby
 	if !controller.IsValidRPM(config.DiskCurve.RPM.Sleeping) {
 		return config, fmt.Errorf("Read: Invalid sleeping rpm: %d",
 			config.DiskCurve.RPM.Sleeping)
 	}
 
-	if !controller.IsValidRPM(config.DiskCurve.RPM.Cooldown) {
-		return config, fmt.Errorf("Read: Invalid cooldown rpm: %d",
-			config.DiskCurve.RPM.Cooldown)
+	if err := config.DiskCurve.RPM.Cooldown.check(controller); err != nil {
+		return config, fmt.Errorf("Read: Invalid cooldown %v", err)
 	}
 
 	if !controller.IsValidRPM(config.DiskCurve.RPM.Standby) {
@@ -104,6 +995,19 @@ func Read(path string) (Config, error) {
 			config.DiskCurve.PollInterval)
 	}
 
+	// Check Stagger, which must leave time for the rest of the cycle
+	if config.DiskCurve.Stagger < 0 || config.DiskCurve.Stagger > 600 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve stagger: %d not in [0, 600]",
+			config.DiskCurve.Stagger)
+	}
+	if config.DiskCurve.Stagger != 0 && config.DiskCurve.PollInterval != 0 &&
+		config.DiskCurve.Stagger >= config.DiskCurve.PollInterval {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve stagger: %d not below poll_interval %d",
+			config.DiskCurve.Stagger, config.DiskCurve.PollInterval)
+	}
+
 	// Check CooldownTimeout
 	if config.DiskCurve.CooldownTimeout < 0 ||
 		config.DiskCurve.CooldownTimeout > 3600 {
@@ -112,6 +1016,289 @@ func Read(path string) (Config, error) {
 			config.DiskCurve.CooldownTimeout)
 	}
 
+	// Check Disks
+	bridges := map[string]bool{"": true}
+	for _, bridge := range disk.Bridges {
+		bridges[bridge] = true
+	}
+	for _, disk := range config.Disks {
+		if len(disk.Path) == 0 {
+			return config, fmt.Errorf("Read: Missing disk path")
+		}
+
+		if !bridges[disk.Bridge] {
+			return config, fmt.Errorf("Read: Invalid disk %s bridge: %s",
+				disk.Path, disk.Bridge)
+		}
+
+		if disk.Target < 0 || disk.Target > 100 {
+			return config, fmt.Errorf(
+				"Read: Invalid disk %s target: %d not in [0, 100]",
+				disk.Path, disk.Target)
+		}
+
+		if disk.PollInterval < 0 || disk.PollInterval > 3600 {
+			return config, fmt.Errorf(
+				"Read: Invalid disk %s poll_interval: %d not in [0, 3600]",
+				disk.Path, disk.PollInterval)
+		}
+		if config.DiskCurve.Stagger != 0 && disk.PollInterval != 0 &&
+			config.DiskCurve.Stagger >= disk.PollInterval {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve stagger: %d not below poll_interval "+
+					"%d of disk %s", config.DiskCurve.Stagger,
+				disk.PollInterval, disk.Path)
+		}
+
+		if disk.MaxTemp < 0 || disk.MaxTemp > 150 {
+			return config, fmt.Errorf(
+				"Read: Invalid disk %s max_temp: %d not in [0, 150]",
+				disk.Path, disk.MaxTemp)
+		}
+
+		if disk.Target != 0 && config.DiskCurve.DiskTarget == 0 {
+			return config, fmt.Errorf(
+				"Read: Disk %s target requires disk_curve disk_target",
+				disk.Path)
+		}
+	}
+
+	if config.DiskCurve.DiskTarget < 0 || config.DiskCurve.DiskTarget > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve disk_target: %d not in [0, 100]",
+			config.DiskCurve.DiskTarget)
+	}
+
+	// Check Sensors
+	for name, sensorConfig := range config.Sensors {
+		if name == DisksSensor {
+			return config, fmt.Errorf("Read: Reserved sensor name: %s", name)
+		}
+
+		if _, err := sensor.New(sensorConfig.Type,
+			sensorConfig.Options()); err != nil {
+			return config, fmt.Errorf("Read: Sensor %s %v", name, err)
+		}
+	}
+
+	// Check Inputs
+	for _, input := range config.DiskCurve.Inputs {
+		if _, ok := config.Sensors[input.Sensor]; !ok &&
+			input.Sensor != DisksSensor {
+			return config, fmt.Errorf("Read: Invalid disk_curve input sensor: %s",
+				input.Sensor)
+		}
+
+		if input.Weight <= 0 {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve input %s weight: %v must be positive",
+				input.Sensor, input.Weight)
+		}
+	}
+
+	// Check Ambient
+	if len(config.DiskCurve.Ambient) != 0 {
+		if _, ok := config.Sensors[config.DiskCurve.Ambient]; !ok {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve ambient sensor: %s",
+				config.DiskCurve.Ambient)
+		}
+	}
+
+	// Check PanicTemp
+	if config.DiskCurve.PanicTemp < 0 || config.DiskCurve.PanicTemp > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve panic_temp: %d not in [0, 100]",
+			config.DiskCurve.PanicTemp)
+	}
+
+	// Check CriticalTemp
+	if config.DiskCurve.CriticalTemp < 0 ||
+		config.DiskCurve.CriticalTemp > 150 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve critical_temp: %d not in [0, 150]",
+			config.DiskCurve.CriticalTemp)
+	}
+
+	// Check LimitMargin
+	if config.DiskCurve.LimitMargin == 0 {
+		config.DiskCurve.LimitMargin = 5
+	} else if config.DiskCurve.LimitMargin < 0 ||
+		config.DiskCurve.LimitMargin > 30 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve limit_margin: %d not in [1, 30]",
+			config.DiskCurve.LimitMargin)
+	}
+
+	// Check HotDuty and WarningTemp, which only lint the curve
+	if config.DiskCurve.HotDuty == 0 {
+		config.DiskCurve.HotDuty = 80
+	} else if config.DiskCurve.HotDuty < 20 || config.DiskCurve.HotDuty > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve hot_duty: %d not in [20, 100]",
+			config.DiskCurve.HotDuty)
+	}
+
+	if config.DiskCurve.WarningTemp == 0 {
+		config.DiskCurve.WarningTemp = 50
+	} else if config.DiskCurve.WarningTemp < 1 ||
+		config.DiskCurve.WarningTemp > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve warning_temp: %d not in [1, 100]",
+			config.DiskCurve.WarningTemp)
+	}
+
+	// Check StopBelowTemp and StartAboveTemp
+	if config.DiskCurve.StopBelowTemp < 0 || config.DiskCurve.StopBelowTemp > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve stop_below_temp: %d not in [0, 100]",
+			config.DiskCurve.StopBelowTemp)
+	}
+
+	if config.DiskCurve.StartAboveTemp < 0 || config.DiskCurve.StartAboveTemp > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve start_above_temp: %d not in [0, 100]",
+			config.DiskCurve.StartAboveTemp)
+	}
+
+	if config.DiskCurve.StartAboveTemp != 0 {
+		if config.DiskCurve.StopBelowTemp == 0 {
+			return config, fmt.Errorf(
+				"Read: disk_curve start_above_temp requires stop_below_temp")
+		}
+
+		if config.DiskCurve.StartAboveTemp < config.DiskCurve.StopBelowTemp {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve start_above_temp: %d below stop_below_temp: %d",
+				config.DiskCurve.StartAboveTemp, config.DiskCurve.StopBelowTemp)
+		}
+	} else {
+		config.DiskCurve.StartAboveTemp = config.DiskCurve.StopBelowTemp
+	}
+
+	// Check Thresholds
+	for name, threshold := range config.DiskCurve.Thresholds {
+		if threshold.Temperature < 0 || threshold.Temperature > 100 {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve threshold %s temp: %d not in [0, 100]",
+				name, threshold.Temperature)
+		}
+
+		switch threshold.Action {
+		case "":
+			threshold.Action = ThresholdLog
+		case ThresholdLog, ThresholdAlert:
+		case ThresholdBoost:
+			if !controller.IsValidRPM(threshold.RPM) {
+				return config, fmt.Errorf(
+					"Read: Invalid disk_curve threshold %s rpm: %d",
+					name, threshold.RPM)
+			}
+		case ThresholdCommand:
+			if len(threshold.Command) == 0 {
+				return config, fmt.Errorf(
+					"Read: disk_curve threshold %s missing command", name)
+			}
+		default:
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve threshold %s action: %s",
+				name, threshold.Action)
+		}
+		config.DiskCurve.Thresholds[name] = threshold
+	}
+
+	// Check TrendBoost
+	if config.DiskCurve.TrendBoost.Slope < 0 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve trend_boost slope: %v must not be negative",
+			config.DiskCurve.TrendBoost.Slope)
+	}
+
+	if config.DiskCurve.TrendBoost.Window < 0 ||
+		config.DiskCurve.TrendBoost.Window > 3600 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve trend_boost window: %d not in [0, 3600]",
+			config.DiskCurve.TrendBoost.Window)
+	}
+
+	if config.DiskCurve.TrendBoost.Slope > 0 {
+		if !controller.IsValidRPM(config.DiskCurve.TrendBoost.RPM) {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve trend_boost rpm: %d",
+				config.DiskCurve.TrendBoost.RPM)
+		}
+
+		if config.DiskCurve.TrendBoost.Window == 0 {
+			config.DiskCurve.TrendBoost.Window = 300
+		}
+	}
+
+	// Check StatusDetection
+	switch config.DiskCurve.StatusDetection {
+	case "":
+		config.DiskCurve.StatusDetection = StatusDetectionOn
+	case StatusDetectionOn, StatusDetectionOff:
+	default:
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve status_detection: %s",
+			config.DiskCurve.StatusDetection)
+	}
+
+	if config.DiskCurve.Gentle &&
+		config.DiskCurve.StatusDetection == StatusDetectionOff {
+		return config, fmt.Errorf(
+			"Read: disk_curve gentle can not be used with status_detection off")
+	}
+
+	// Check OnRemoved
+	switch config.DiskCurve.OnRemoved {
+	case "":
+		config.DiskCurve.OnRemoved = RemovedFailsafe
+	case RemovedSleep, RemovedHold, RemovedFailsafe:
+	default:
+		return config, fmt.Errorf("Read: Invalid disk_curve on_removed: %s",
+			config.DiskCurve.OnRemoved)
+	}
+
+	// Check StaleTTL
+	if config.DiskCurve.StaleTTL < 0 || config.DiskCurve.StaleTTL > 86400 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve stale_ttl: %d not in [0, 86400]",
+			config.DiskCurve.StaleTTL)
+	}
+
+	// Check WakeBoostRPM and WakeBoostTime
+	if config.DiskCurve.WakeBoostRPM != 0 {
+		if !controller.IsValidRPM(config.DiskCurve.WakeBoostRPM) {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve wake_boost_rpm: %d",
+				config.DiskCurve.WakeBoostRPM)
+		}
+
+		if config.DiskCurve.WakeBoostTime == 0 {
+			config.DiskCurve.WakeBoostTime = 300
+		}
+	}
+
+	if config.DiskCurve.WakeBoostTime < 0 ||
+		config.DiskCurve.WakeBoostTime > 3600 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve wake_boost_duration: %d not in [0, 3600]",
+			config.DiskCurve.WakeBoostTime)
+	}
+
+	// Check Hysteresis
+	if config.DiskCurve.Hysteresis < 0 || config.DiskCurve.Hysteresis > 100 {
+		return config, fmt.Errorf(
+			"Read: Invalid disk_curve hysteresis: %d not in [0, 100]",
+			config.DiskCurve.Hysteresis)
+	}
+
+	// Check Ramp
+	if err := (Curve{Ramp: config.DiskCurve.Ramp}).check(); err != nil {
+		return config, fmt.Errorf("Read: Invalid disk_curve %v", err)
+	}
+
 	// Check Points
 	for i, point := range config.DiskCurve.Points {
 
@@ -130,11 +1317,241 @@ func Read(path string) (Config, error) {
 			}
 		}
 
-		if !controller.IsValidRPM(point.RPM) {
+		if point.Relative != config.DiskCurve.Points[0].Relative {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve rpm: cannot mix min, max and percentages with rpm")
+		}
+
+		if point.Relative && (point.RPM < 0 || point.RPM > 100) {
+			return config, fmt.Errorf(
+				"Read: Invalid disk_curve rpm: %d%% not in [0%%, 100%%]",
+				point.RPM)
+		} else if !point.Relative && !controller.IsValidRPM(point.RPM) {
 			return config, fmt.Errorf(
 				"Read: Invalid disk_curve rpm: %d", point.RPM)
 		}
 	}
 
+	// Check Zones
+	usedFans := map[int]bool{}
+	for fan := range config.ConstantRPM {
+		usedFans[fan] = true
+	}
+	for _, fan := range config.CurveFans {
+		usedFans[fan] = true
+	}
+	for fan := range groupFans {
+		usedFans[fan] = true
+	}
+
+	zoneNames := map[string]bool{DisksSensor: true}
+	for _, zone := range config.Zones {
+		if len(zone.Name) == 0 {
+			return config, fmt.Errorf("Read: Missing zone name")
+		}
+
+		if zoneNames[zone.Name] {
+			return config, fmt.Errorf("Read: Duplicate zone name: %s",
+				zone.Name)
+		}
+		zoneNames[zone.Name] = true
+
+		for _, fan := range zone.Fans {
+			if !controller.IsValidFan(fan) {
+				return config, fmt.Errorf("Read: Invalid fan index: %d", fan)
+			}
+
+			if usedFans[fan] {
+				return config, fmt.Errorf(
+					"Read: Fan %d present in more than one of constant_rpm, curve_fans, fan_groups and zones",
+					fan)
+			}
+			usedFans[fan] = true
+		}
+
+		if _, ok := config.Sensors[zone.Sensor]; !ok &&
+			zone.Sensor != DisksSensor && len(zone.Points) != 0 {
+			return config, fmt.Errorf("Read: Invalid zone %s sensor: %s",
+				zone.Name, zone.Sensor)
+		}
+
+		if err := zone.Curve.check(); err != nil {
+			return config, fmt.Errorf("Read: Invalid zone %s: %v", zone.Name,
+				err)
+		}
+
+		if zone.Hysteresis < 0 || zone.Hysteresis > 100 {
+			return config, fmt.Errorf(
+				"Read: Invalid zone %s hysteresis: %d not in [0, 100]",
+				zone.Name, zone.Hysteresis)
+		}
+
+		if len(zone.Points) == 0 && len(zone.Follow) == 0 {
+			return config, fmt.Errorf(
+				"Read: Zone %s needs points or follow", zone.Name)
+		}
+
+		if zone.CriticalTemp < 0 || zone.CriticalTemp > 150 {
+			return config, fmt.Errorf(
+				"Read: Invalid zone %s critical_temp: %d not in [0, 150]",
+				zone.Name, zone.CriticalTemp)
+		}
+	}
+
+	for _, zone := range config.Zones {
+		for _, follow := range zone.Follow {
+			if !zoneNames[follow] {
+				return config, fmt.Errorf("Read: Invalid zone %s follow: %s",
+					zone.Name, follow)
+			}
+		}
+	}
+
+	// Order zones after the zones they follow
+	zones, err := orderZones(config.Zones)
+	if err != nil {
+		return config, err
+	}
+	config.Zones = zones
+
 	return config, nil
 }
+
+// Order zones so that each zone comes after the zones it follows. Returns an
+// error if zones follow each other in a cycle.
+func orderZones(zones []Zone) ([]Zone, error) {
+	byName := map[string]Zone{}
+	for _, zone := range zones {
+		byName[zone.Name] = zone
+	}
+
+	ordered := []Zone{}
+	visiting := map[string]bool{}
+	visited := map[string]bool{}
+
+	var visit func(zone Zone, path []string) error
+	visit = func(zone Zone, path []string) error {
+		if visited[zone.Name] {
+			return nil
+		}
+
+		path = append(path, zone.Name)
+		if visiting[zone.Name] {
+			return fmt.Errorf("Read: Zones follow each other in a cycle: %s",
+				strings.Join(path, " -> "))
+		}
+		visiting[zone.Name] = true
+
+		for _, follow := range zone.Follow {
+			if followed, ok := byName[follow]; ok {
+				if err := visit(followed, path); err != nil {
+					return err
+				}
+			}
+		}
+
+		visiting[zone.Name] = false
+		visited[zone.Name] = true
+		ordered = append(ordered, zone)
+
+		return nil
+	}
+
+	for _, zone := range zones {
+		if err := visit(zone, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// HasZone of name, which is either the disks zone, or one of the zones
+func (config Config) HasZone(name string) bool {
+	if name == DisksSensor {
+		return true
+	}
+
+	for _, zone := range config.Zones {
+		if zone.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FanRange of min and max rpm of fan, which relative curve points resolve to.
+// The min is the fan_limits min, or else the stall duty, or else 20; the max is
+// the fan_limits max, or else 100.
+func (config Config) FanRange(fan int) (int, int) {
+	min, max := 20, 100
+	if duty, ok := config.StallDuty[fan]; ok {
+		min = duty
+	}
+
+	limit := config.FanLimits[fan]
+	if limit.Min != 0 {
+		min = limit.Min
+	}
+	if limit.Max != 0 {
+		max = limit.Max
+	}
+	return min, max
+}
+
+// Fan of alias, or of a fan index
+func (config Config) Fan(name string) (int, error) {
+	for fan, alias := range config.FanAliases {
+		if alias == name {
+			return fan, nil
+		}
+	}
+
+	fan, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, fmt.Errorf("Fan: Unknown fan alias: %s", name)
+	}
+	return fan, nil
+}
+
+// FanName of fan, with its alias if any
+func (config Config) FanName(fan int) string {
+	if alias, ok := config.FanAliases[fan]; ok {
+		return fmt.Sprintf("%d (%s)", fan, alias)
+	}
+	return strconv.Itoa(fan)
+}
+
+// Controller chain for config, not yet opened
+func (config Config) Controller() *controller.Chain {
+	chain := &controller.Chain{}
+	paths := append([]string{config.DevicePath}, config.ChainedDevicePaths...)
+	for _, path := range paths {
+		chain.Controllers = append(chain.Controllers,
+			controller.GridFanController{
+				DevicePath:   path,
+				CommandDelay: time.Duration(config.CommandDelay) * time.Millisecond,
+				CommandBurst: config.CommandBurst,
+				SkipPing:     config.SkipPing,
+				PingFan:      config.PingFan,
+
+				QuirksProfile:     config.ControllerQuirks,
+				ReadbackTolerance: config.ReadbackTolerance,
+				SkipDeviceCheck:   !config.ConfirmDevice,
+			})
+	}
+	return chain
+}
+
+// Dump config as yaml, with defaults applied, and the mqtt password and api
+// token redacted.
+func (config Config) Dump() ([]byte, error) {
+	if len(config.MQTT.Password) != 0 {
+		config.MQTT.Password = "REDACTED"
+	}
+	if len(config.APIToken) != 0 {
+		config.APIToken = "REDACTED"
+	}
+	return yaml.Marshal(config)
+}
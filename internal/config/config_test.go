@@ -0,0 +1,101 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Read config of yaml contents
+func readContents(t *testing.T, contents string) (Config, error) {
+	dir, err := ioutil.TempDir("", "gridfan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Read(path)
+}
+
+func TestOrderZones(t *testing.T) {
+	zone := func(name string, follow ...string) Zone {
+		return Zone{Name: name, Follow: follow}
+	}
+
+	tests := []struct {
+		name     string
+		zones    []Zone
+		expected []string
+		cycle    string
+	}{
+		{"no follow", []Zone{zone("a"), zone("b")},
+			[]string{"a", "b"}, ""},
+		{"follow later zone", []Zone{zone("a", "b"), zone("b")},
+			[]string{"b", "a"}, ""},
+		{"chain", []Zone{zone("a", "b"), zone("b", "c"), zone("c")},
+			[]string{"c", "b", "a"}, ""},
+		{"shared", []Zone{zone("a", "c"), zone("b", "c"), zone("c")},
+			[]string{"c", "a", "b"}, ""},
+		{"disks and unknown", []Zone{zone("a", "disks", "x")},
+			[]string{"a"}, ""},
+		{"self", []Zone{zone("a", "a")}, nil, "a -> a"},
+		{"two zones", []Zone{zone("a", "b"), zone("b", "a")}, nil,
+			"a -> b -> a"},
+		{"three zones", []Zone{zone("d"), zone("a", "b"), zone("b", "c"),
+			zone("c", "a")}, nil, "a -> b -> c -> a"},
+		{"behind zone", []Zone{zone("a", "b"), zone("b", "c"),
+			zone("c", "b")}, nil, "a -> b -> c -> b"},
+	}
+
+	for _, test := range tests {
+		ordered, err := orderZones(test.zones)
+		if len(test.cycle) != 0 {
+			if err == nil || !strings.HasSuffix(err.Error(), test.cycle) {
+				t.Errorf("%s: error = %v, expected cycle: %s", test.name, err,
+					test.cycle)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		names := []string{}
+		for _, zone := range ordered {
+			names = append(names, zone.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: order = %v, expected %v", test.name, names,
+				test.expected)
+		}
+	}
+}
+
+// Zones following each other in a cycle are rejected when reading the config
+func TestReadZoneCycle(t *testing.T) {
+	_, err := readContents(t, `serial_device_path: /dev/ttyACM0
+sensors:
+  room: {type: file, path: /run/room}
+zones:
+  - name: intake
+    sensor: room
+    fans: [1]
+    follow: [exhaust]
+  - name: exhaust
+    sensor: room
+    fans: [2]
+    follow: [intake]
+`)
+	if err == nil || !strings.Contains(err.Error(),
+		"cycle: intake -> exhaust -> intake") {
+		t.Errorf("Read = %v, expected cycle error", err)
+	}
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Curve of temperature points to rpm. Below the first point, the rpm is 100,
+// since the curve does not cover that temperature. Otherwise it is the rpm of
+// the highest point reached, or with Interpolate, linearly interpolated
+// between the points around the temperature. With Hysteresis, the rpm only
+// drops once the temperature is that many degrees below the point which
+// raised it. With a Ramp, the daemon eases to new targets of the curve
+// instead of stepping to them.
+type Curve struct {
+	Points      []CurvePoint `yaml:"points"`
+	Interpolate bool         `yaml:"interpolate"`
+	Hysteresis  int          `yaml:"hysteresis"`
+	Ramp        Ramp         `yaml:"ramp"`
+}
+
+// Ramp to a new target over Time seconds, along the Easing function
+type Ramp struct {
+	Time   int    `yaml:"time"`
+	Easing string `yaml:"easing"`
+}
+
+// Easing functions of a ramp
+const (
+	EasingLinear      = "linear"
+	EasingSmoothstep  = "smoothstep"
+	EasingExponential = "exponential"
+)
+
+// Relative curve of min, max and percentage points, which resolve to the range
+// of each fan
+func (curve Curve) Relative() bool {
+	return len(curve.Points) != 0 && curve.Points[0].Relative
+}
+
+// Resolve percent of a relative curve to rpm in range of min to max
+func Resolve(percent int, min int, max int) int {
+	return min + int(math.Round(float64(percent*(max-min))/100))
+}
+
+// Point is the highest curve point reached at temperature, if any
+func (curve Curve) Point(temp int) (CurvePoint, bool) {
+	index := curve.PointIndex(temp)
+	if index < 0 {
+		return CurvePoint{}, false
+	}
+	return curve.Points[index], true
+}
+
+// PointIndex of the highest curve point reached at temperature, or -1 if none
+func (curve Curve) PointIndex(temp int) int {
+	index := -1
+	for i, next := range curve.Points {
+		if temp < next.Temperature {
+			break
+		}
+		index = i
+	}
+	return index
+}
+
+// Evaluate curve rpm at temperature
+func (curve Curve) Evaluate(temp int) int {
+	for i, point := range curve.Points {
+		if temp >= point.Temperature {
+			continue
+		}
+
+		if i == 0 {
+			return 100
+		}
+
+		previous := curve.Points[i-1]
+		if !curve.Interpolate {
+			return previous.RPM
+		}
+
+		// Interpolate, but never into the invalid range between 0 and 20
+		fraction := float64(temp-previous.Temperature) /
+			float64(point.Temperature-previous.Temperature)
+		rpm := int(math.Round(float64(previous.RPM) +
+			fraction*float64(point.RPM-previous.RPM)))
+		if !curve.Relative() && rpm != 0 && rpm < 20 {
+			rpm = previous.RPM
+		}
+		return rpm
+	}
+
+	if len(curve.Points) == 0 {
+		return 100
+	}
+	return curve.Points[len(curve.Points)-1].RPM
+}
+
+// EvaluateFrom the last curve rpm at temperature, applying hysteresis
+func (curve Curve) EvaluateFrom(temp int, last int) int {
+	rpm := curve.Evaluate(temp)
+	if rpm >= last || curve.Hysteresis <= 0 {
+		return rpm
+	}
+
+	// Keep the rpm of Hysteresis degrees higher, up to the last rpm
+	held := curve.Evaluate(temp + curve.Hysteresis)
+	if held > last {
+		held = last
+	}
+	if held > rpm {
+		return held
+	}
+	return rpm
+}
+
+// Check curve points have strictly increasing temperatures, and valid rpm
+func (curve Curve) check() error {
+	for i, point := range curve.Points {
+		if point.Temperature < 0 || point.Temperature > 100 {
+			return fmt.Errorf("temperature: %d not in [0, 100]",
+				point.Temperature)
+		}
+
+		if i > 0 && curve.Points[i-1].Temperature >= point.Temperature {
+			return fmt.Errorf("temperature: %d must be strictly increasing",
+				point.Temperature)
+		}
+
+		if point.Relative != curve.Points[0].Relative {
+			return fmt.Errorf("rpm: cannot mix min, max and percentages with rpm")
+		}
+
+		if point.Relative && (point.RPM < 0 || point.RPM > 100) {
+			return fmt.Errorf("rpm: %d%% not in [0%%, 100%%]", point.RPM)
+		} else if !point.Relative && point.RPM != 0 &&
+			(point.RPM < 20 || point.RPM > 100) {
+			return fmt.Errorf("rpm: %d", point.RPM)
+		}
+	}
+
+	if curve.Ramp.Time < 0 || curve.Ramp.Time > 3600 {
+		return fmt.Errorf("ramp time: %d not in [0, 3600]", curve.Ramp.Time)
+	}
+
+	switch curve.Ramp.Easing {
+	case "", EasingLinear, EasingSmoothstep, EasingExponential:
+	default:
+		return fmt.Errorf("ramp easing: %s", curve.Ramp.Easing)
+	}
+
+	return nil
+}
+
+// RPMString of point: min, max or a percentage for relative points
+func (point CurvePoint) RPMString() string {
+	return FormatRPM(point.RPM, point.Relative)
+}
+
+// FormatRPM of rpm, which is a percentage of the fan range if relative
+func FormatRPM(rpm int, relative bool) string {
+	switch {
+	case !relative:
+		return strconv.Itoa(rpm)
+	case rpm == 0:
+		return "min"
+	case rpm == 100:
+		return "max"
+	default:
+		return fmt.Sprintf("%d%%", rpm)
+	}
+}
+
+// UnmarshalYAML of point, where rpm is a number, min, max or a percentage
+func (point *CurvePoint) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw struct {
+		Temperature int    `yaml:"temp"`
+		RPM         string `yaml:"rpm"`
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	point.Temperature = raw.Temperature
+	point.Relative = false
+	switch {
+	case raw.RPM == "":
+		point.RPM = 0
+	case raw.RPM == "min":
+		point.RPM, point.Relative = 0, true
+	case raw.RPM == "max":
+		point.RPM, point.Relative = 100, true
+	case strings.HasSuffix(raw.RPM, "%"):
+		percent, err := strconv.Atoi(strings.TrimSuffix(raw.RPM, "%"))
+		if err != nil {
+			return fmt.Errorf("invalid rpm percentage: %s", raw.RPM)
+		}
+		point.RPM, point.Relative = percent, true
+	default:
+		rpm, err := strconv.Atoi(raw.RPM)
+		if err != nil {
+			return fmt.Errorf("invalid rpm: %s", raw.RPM)
+		}
+		point.RPM = rpm
+	}
+	return nil
+}
+
+// MarshalYAML of point, keeping relative rpm as min, max or a percentage
+func (point CurvePoint) MarshalYAML() (interface{}, error) {
+	if !point.Relative {
+		return struct {
+			Temperature int `yaml:"temp"`
+			RPM         int `yaml:"rpm"`
+		}{point.Temperature, point.RPM}, nil
+	}
+	return struct {
+		Temperature int    `yaml:"temp"`
+		RPM         string `yaml:"rpm"`
+	}{point.Temperature, point.RPMString()}, nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"testing"
+)
+
+// Curve of steps at 30, 50 and 70°C
+func stepCurve() Curve {
+	return Curve{Points: []CurvePoint{
+		{Temperature: 30, RPM: 40},
+		{Temperature: 50, RPM: 60},
+		{Temperature: 70, RPM: 100},
+	}}
+}
+
+// Curve of stepCurve points, interpolated
+func interpolatedCurve() Curve {
+	curve := stepCurve()
+	curve.Interpolate = true
+	return curve
+}
+
+// Relative curve from min at 30°C to max at 50°C, interpolated
+func relativeCurve() Curve {
+	return Curve{Interpolate: true, Points: []CurvePoint{
+		{Temperature: 30, RPM: 0, Relative: true},
+		{Temperature: 40, RPM: 50, Relative: true},
+		{Temperature: 50, RPM: 100, Relative: true},
+	}}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve Curve
+		temp  int
+		rpm   int
+	}{
+		{"no points", Curve{}, 40, 100},
+
+		{"step below first", stepCurve(), 29, 100},
+		{"step first", stepCurve(), 30, 40},
+		{"step between", stepCurve(), 49, 40},
+		{"step second", stepCurve(), 50, 60},
+		{"step before last", stepCurve(), 69, 60},
+		{"step last", stepCurve(), 70, 100},
+		{"step above last", stepCurve(), 90, 100},
+
+		{"interpolated below first", interpolatedCurve(), 20, 100},
+		{"interpolated first", interpolatedCurve(), 30, 40},
+		{"interpolated quarter", interpolatedCurve(), 35, 45},
+		{"interpolated middle", interpolatedCurve(), 40, 50},
+		{"interpolated second", interpolatedCurve(), 50, 60},
+		{"interpolated upper middle", interpolatedCurve(), 60, 80},
+		{"interpolated rounded", interpolatedCurve(), 53, 66},
+		{"interpolated above last", interpolatedCurve(), 80, 100},
+
+		{"interpolated from off, below 20", Curve{Interpolate: true,
+			Points: []CurvePoint{{Temperature: 30, RPM: 0},
+				{Temperature: 50, RPM: 40}}}, 35, 0},
+		{"interpolated from off, above 20", Curve{Interpolate: true,
+			Points: []CurvePoint{{Temperature: 30, RPM: 0},
+				{Temperature: 50, RPM: 40}}}, 45, 30},
+
+		{"relative below first", relativeCurve(), 29, 100},
+		{"relative min", relativeCurve(), 30, 0},
+		{"relative below 20", relativeCurve(), 32, 10},
+		{"relative percentage", relativeCurve(), 40, 50},
+		{"relative interpolated", relativeCurve(), 45, 75},
+		{"relative max", relativeCurve(), 50, 100},
+		{"relative above last", relativeCurve(), 60, 100},
+	}
+
+	for _, test := range tests {
+		if rpm := test.curve.Evaluate(test.temp); rpm != test.rpm {
+			t.Errorf("%s: Evaluate(%d) = %d, expected %d", test.name,
+				test.temp, rpm, test.rpm)
+		}
+	}
+}
+
+func TestEvaluateFrom(t *testing.T) {
+	step := stepCurve()
+	step.Hysteresis = 5
+	interpolated := interpolatedCurve()
+	interpolated.Hysteresis = 5
+	relative := relativeCurve()
+	relative.Hysteresis = 4
+
+	tests := []struct {
+		name  string
+		curve Curve
+		temp  int
+		last  int
+		rpm   int
+	}{
+		{"no hysteresis drops", stepCurve(), 48, 60, 40},
+		{"no hysteresis rises", stepCurve(), 50, 40, 60},
+
+		{"step rises", step, 50, 40, 60},
+		{"step held", step, 46, 60, 60},
+		{"step held at edge", step, 45, 60, 60},
+		{"step drops below hysteresis", step, 44, 60, 40},
+		{"step below first is full speed", step, 26, 40, 100},
+		{"step never above last", step, 66, 60, 60},
+		{"step unchanged", step, 40, 40, 40},
+
+		{"interpolated rises", interpolated, 45, 40, 55},
+		{"interpolated held", interpolated, 45, 60, 60},
+		{"interpolated held up to last", interpolated, 45, 57, 57},
+		{"interpolated drops to held", interpolated, 40, 60, 55},
+		{"interpolated drops below hysteresis", interpolated, 30, 40, 40},
+
+		{"relative held", relative, 36, 50, 50},
+		{"relative drops", relative, 32, 50, 30},
+	}
+
+	for _, test := range tests {
+		rpm := test.curve.EvaluateFrom(test.temp, test.last)
+		if rpm != test.rpm {
+			t.Errorf("%s: EvaluateFrom(%d, %d) = %d, expected %d",
+				test.name, test.temp, test.last, rpm, test.rpm)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Lint config for settings which are valid, but likely not what was intended.
+// Returns a list of warnings.
+func (config Config) Lint() []string {
+	warnings := []string{}
+
+	// Curve should reach full speed, or have a panic temperature
+	points := config.DiskCurve.Points
+	maxRPM := 0
+	for _, point := range points {
+		if point.RPM > maxRPM {
+			maxRPM = point.RPM
+		}
+	}
+	if len(points) != 0 && maxRPM < 100 && config.DiskCurve.PanicTemp == 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"disk_curve highest rpm is %d and panic_temp is unset, so fans never reach 100",
+			maxRPM))
+	}
+
+	// Sleeping disks should not need more cooling than standby disks
+	rpm := config.DiskCurve.RPM
+	if rpm.Sleeping > rpm.Standby {
+		warnings = append(warnings, fmt.Sprintf(
+			"disk_curve sleeping rpm %d exceeds standby rpm %d",
+			rpm.Sleeping, rpm.Standby))
+	}
+
+	// Curve should reach hot_duty by the warning temperature of the disks,
+	// unless panic_temp reaches full speed first. With ambient or inputs,
+	// the curve input is not a disk temperature, so it cannot be checked.
+	if len(points) != 0 && len(config.DiskCurve.Ambient) == 0 &&
+		len(config.DiskCurve.Inputs) == 0 {
+		input, disk := config.hotInput()
+		panicTemp := config.DiskCurve.PanicTemp
+		if duty := config.curveDuty(input); duty < config.DiskCurve.HotDuty &&
+			(panicTemp == 0 || panicTemp > input) {
+			warnings = append(warnings, fmt.Sprintf(
+				"disk_curve reaches only %d at %d°C, the warning temperature of %s, below hot_duty %d",
+				duty, input, disk, config.DiskCurve.HotDuty))
+		}
+	}
+
+	// Curve without fans does nothing, unless only exporting it
+	if len(points) != 0 && len(config.CurveFans) == 0 &&
+		len(config.FanGroups) == 0 && !config.SensorOnly {
+		warnings = append(warnings,
+			"disk_curve points are defined, but curve_fans is empty")
+	}
+
+	return warnings
+}
+
+// Lowest curve input at which a disk reaches its warning temperature, and
+// that disk. The warning temperature of a disk is its max_temp less
+// limit_margin, or else warning_temp, shifted by its target like its
+// temperature.
+func (config Config) hotInput() (int, string) {
+	input, hottest := config.DiskCurve.WarningTemp, "disks"
+	for i, disk := range config.Disks {
+		warning := config.DiskCurve.WarningTemp
+		if disk.MaxTemp != 0 {
+			warning = disk.MaxTemp - config.DiskCurve.LimitMargin
+		}
+		if disk.Target != 0 && config.DiskCurve.DiskTarget != 0 {
+			warning -= disk.Target - config.DiskCurve.DiskTarget
+		}
+		if i == 0 || warning < input {
+			input, hottest = warning, disk.Path
+		}
+	}
+	return input, hottest
+}
+
+// Lowest duty of the curve fans at curve input, after resolving relative
+// points and applying fan_limits max. Without curve fans, it is the curve
+// rpm.
+func (config Config) curveDuty(input int) int {
+	rpm := config.DiskCurve.Evaluate(input)
+	if len(config.CurveFans) == 0 {
+		return rpm
+	}
+
+	lowest := 100
+	for _, fan := range config.CurveFans {
+		duty := rpm
+		min, max := config.FanRange(fan)
+		if config.DiskCurve.Relative() {
+			duty = Resolve(rpm, min, max)
+		} else if duty > max {
+			duty = max
+		}
+		if duty < lowest {
+			lowest = duty
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,133 @@
+package config
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Key of the profiles of a config file
+const profilesKey = "profiles"
+
+// Select profile of config file contents, and return the contents of the
+// config it makes, with its name. Each profile is a complete config, with a
+// name and optional hosts patterns, whose keys replace the top level keys of
+// the file, which profiles share. Without a profile name, the first profile
+// whose hosts match the hostname, or its short form, is selected. Contents
+// without profiles are returned unchanged.
+func selectProfile(contents []byte, name string) ([]byte, string, error) {
+	file := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, "", err
+	}
+
+	value, ok := file[profilesKey]
+	if !ok {
+		if len(name) != 0 {
+			return nil, "", fmt.Errorf("Read: Unknown profile: %s", name)
+		}
+		return contents, "", nil
+	}
+	delete(file, profilesKey)
+
+	profiles := []map[interface{}]interface{}{}
+	if encoded, err := yaml.Marshal(value); err != nil {
+		return nil, "", err
+	} else if err := yaml.Unmarshal(encoded, &profiles); err != nil {
+		return nil, "", fmt.Errorf("Read: Invalid profiles: %v", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil && len(name) == 0 {
+		return nil, "", fmt.Errorf("Read: Failed to get hostname: %v", err)
+	}
+
+	var selected map[interface{}]interface{}
+	names := map[string]bool{}
+	for _, profile := range profiles {
+		var header struct {
+			Name  string   `yaml:"name"`
+			Hosts []string `yaml:"hosts"`
+		}
+		if encoded, err := yaml.Marshal(profile); err != nil {
+			return nil, "", err
+		} else if err := yaml.Unmarshal(encoded, &header); err != nil {
+			return nil, "", fmt.Errorf("Read: Invalid profile: %v", err)
+		}
+
+		if len(header.Name) == 0 {
+			return nil, "", fmt.Errorf("Read: Missing profile name")
+		} else if names[header.Name] {
+			return nil, "", fmt.Errorf("Read: Duplicate profile name: %s",
+				header.Name)
+		}
+		names[header.Name] = true
+
+		for _, pattern := range header.Hosts {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, "", fmt.Errorf(
+					"Read: Invalid hosts pattern of profile %s: %s",
+					header.Name, pattern)
+			}
+		}
+
+		if selected != nil {
+			continue
+		} else if len(name) != 0 && header.Name == name {
+			selected = profile
+		} else if len(name) == 0 && matchesHost(header.Hosts, hostname) {
+			selected = profile
+			name = header.Name
+		}
+	}
+
+	if selected == nil && len(name) != 0 {
+		return nil, "", fmt.Errorf("Read: Unknown profile: %s", name)
+	} else if selected == nil {
+		return nil, "", fmt.Errorf("Read: No profile matches host: %s",
+			hostname)
+	}
+
+	for key, value := range selected {
+		if key != "name" && key != "hosts" {
+			file[key] = value
+		}
+	}
+
+	contents, err = yaml.Marshal(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return contents, name, nil
+}
+
+// Check if any of patterns match hostname, or its short form
+func matchesHost(patterns []string, hostname string) bool {
+	short := strings.SplitN(hostname, ".", 2)[0]
+	for _, pattern := range patterns {
+		for _, host := range []string{hostname, short} {
+			if matched, _ := filepath.Match(pattern, host); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+)
+
+// Number of fans of each controller
+const gridFanCount = GridMaxFanIndex - GridMinFanIndex + 1
+
+// Chain of daisy-chained controllers, with one fan namespace: fans 1 to 6
+// are those of the first controller, 7 to 12 those of the second, and so on.
+type Chain struct {
+	Controllers []GridFanController
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// IsValidFan number of any controller
+func (chain *Chain) IsValidFan(fan int) bool {
+	return fan >= GridMinFanIndex &&
+		fan < GridMinFanIndex+gridFanCount*len(chain.Controllers)
+}
+
+// IsValidRPM for a fan.
+func (chain *Chain) IsValidRPM(rpm int) bool {
+	return (&GridFanController{}).IsValidRPM(rpm)
+}
+
+// Fans of all controllers
+func (chain *Chain) Fans() []int {
+	fans := []int{}
+	for fan := GridMinFanIndex; chain.IsValidFan(fan); fan++ {
+		fans = append(fans, fan)
+	}
+	return fans
+}
+
+// Get controller of a fan, and the fan number on it
+func (chain *Chain) controller(fan int) (*GridFanController, int, error) {
+	if !chain.IsValidFan(fan) {
+		return nil, 0, fmt.Errorf("Bad fan number: %d not in range [%d, %d]",
+			fan, GridMinFanIndex, GridMinFanIndex+
+				gridFanCount*len(chain.Controllers)-1)
+	}
+
+	index := (fan - GridMinFanIndex) / gridFanCount
+	return &chain.Controllers[index], fan - index*gridFanCount, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Open all controllers
+func (chain *Chain) Open() error {
+	for i := range chain.Controllers {
+		if err := chain.Controllers[i].Open(); err != nil {
+			// Close, we already have an error...so ignore Close error
+			chain.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close all controllers, and return the first error
+func (chain *Chain) Close() error {
+	var firstErr error
+	for i := range chain.Controllers {
+		if err := chain.Controllers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// GetSpeed of a fan
+func (chain *Chain) GetSpeed(fan int) (int, error) {
+	controller, fan, err := chain.controller(fan)
+	if err != nil {
+		return 0, fmt.Errorf("GetSpeed: %v", err)
+	}
+	return controller.GetSpeed(fan)
+}
+
+// GetDuty of a fan
+func (chain *Chain) GetDuty(fan int) (int, error) {
+	controller, fan, err := chain.controller(fan)
+	if err != nil {
+		return 0, fmt.Errorf("GetDuty: %v", err)
+	}
+	return controller.GetDuty(fan)
+}
+
+// SetSpeed of a fan
+func (chain *Chain) SetSpeed(fan int, rpm int) error {
+	controller, fan, err := chain.controller(fan)
+	if err != nil {
+		return fmt.Errorf("SetSpeed: %v", err)
+	}
+	return controller.SetSpeed(fan, rpm)
+}
+
+// DutyMatches if duty read back of a fan is within the readback tolerance of
+// its controller of the rpm set
+func (chain *Chain) DutyMatches(fan int, rpm int, duty int) bool {
+	controller, _, err := chain.controller(fan)
+	if err != nil {
+		return duty == rpm
+	}
+	return controller.DutyMatches(rpm, duty)
+}
@@ -18,9 +18,10 @@ limitations under the License.
 */
 
 import (
-	"bytes"
 	"fmt"
-	"github.com/tarm/serial"
+	"io"
+	"strings"
+	"time"
 )
 
 // Controller minimums and maximums
@@ -31,11 +32,45 @@ const (
 	GridMaxFanRPM   = 100
 )
 
-// GridFanController for GridFan
+// Serial baud rate of the controller
+const gridBaudRate = 4800
+
+// Serial read timeout, after which a reply is truncated
+const gridReadTimeout = 2 * time.Second
+
+// AutoDevicePath discovers the serial device of the controller on open
+const AutoDevicePath = "auto"
+
+// SerialNumberPrefix of device paths naming the USB serial number of the
+// controller, such as serial:A600XYZ, which is resolved to its serial device on
+// open
+const SerialNumberPrefix = "serial:"
+
+// GridFanController for GridFan. DevicePath is either a local serial device,
+// auto to discover it, serial:NUMBER of its USB serial number, or a
+// tcp://host:port or rfc2217://host:port address of a remote one. If
+// CommandDelay is set, commands are paced to one per CommandDelay, after a
+// burst of up to CommandBurst commands. If SkipPing is set, Open checks the
+// controller by reading the speed of PingFan (default 1) instead of a Ping, for
+// clones which do not answer it reliably. On Open, the controller is
+// identified, and the quirks of its QuirksProfile (default auto) apply, with
+// CommandDelay, SkipPing and ReadbackTolerance overriding them if set. Unless
+// SkipDeviceCheck is set, a local device must look like a USB serial adapter,
+// and not a console or modem.
 type GridFanController struct {
-	DevicePath string
-
-	serial *serial.Port
+	DevicePath        string
+	CommandDelay      time.Duration
+	CommandBurst      int
+	SkipPing          bool
+	PingFan           int
+	QuirksProfile     string
+	ReadbackTolerance int
+	SkipDeviceCheck   bool
+
+	serial   io.ReadWriteCloser
+	pacer    pacer
+	identity Identity
+	quirks   Quirks
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -52,8 +87,10 @@ func (controller *GridFanController) IsValidRPM(rpm int) bool {
 
 ////////////////////////////////////////////////////////////////////////////////
 
-// Write all bytes to the serial device
+// Write all bytes of a command to the serial device
 func (controller *GridFanController) writeFully(b []byte) error {
+	controller.pace()
+
 	written := 0
 	for written < len(b) {
 		n, err := controller.serial.Write(b[written:])
@@ -65,7 +102,8 @@ func (controller *GridFanController) writeFully(b []byte) error {
 	return nil
 }
 
-// Read until array is full
+// Read until array is full. A read of nothing is a timeout, and the reply
+// is truncated.
 func (controller *GridFanController) readFully(b []byte) error {
 	read := 0
 	for read < len(b) {
@@ -73,6 +111,9 @@ func (controller *GridFanController) readFully(b []byte) error {
 		if err != nil {
 			return err
 		}
+		if n == 0 {
+			return fmt.Errorf("Truncated reply: %v", b[:read])
+		}
 		read += n
 	}
 	return nil
@@ -86,17 +127,51 @@ func (controller *GridFanController) Open() error {
 		return nil
 	}
 
-	c := &serial.Config{Name: controller.DevicePath, Baud: 4800}
-	s, err := serial.OpenPort(c)
-	if err != nil {
-		return err
-	}
-	controller.serial = s
+	if IsNetworkPath(controller.DevicePath) {
+		conn, err := openNetwork(controller.DevicePath)
+		if err != nil {
+			return err
+		}
+		controller.serial = conn
+		controller.applyQuirks(Identity{})
+	} else {
+		devicePath, err := controller.resolveDevicePath()
+		if err != nil {
+			return err
+		}
+
+		// Protocol bytes sent to a console or modem may wedge it
+		if !controller.SkipDeviceCheck {
+			if err := checkSerialDevice(devicePath); err != nil {
+				return fmt.Errorf(
+					"Open: Refusing to use %s: %v, set confirm_device: false if it is the controller",
+					devicePath, err)
+			}
+		}
 
-	controller.serial.Flush()
+		s, err := openSerial(devicePath)
+		if err != nil {
+			return permissionHint(devicePath, err)
+		}
+		controller.serial = s
+
+		// Adapters which can not be identified get no profile quirks
+		identity, _ := usbIdentity(devicePath)
+		controller.applyQuirks(identity)
+	}
 
 	// Check controller
-	if err := controller.Ping(); err != nil {
+	if controller.quirks.SkipPing {
+		pingFan := controller.PingFan
+		if pingFan == 0 {
+			pingFan = GridMinFanIndex
+		}
+		if _, err := controller.GetSpeed(pingFan); err != nil {
+			controller.Close()
+			return fmt.Errorf("Open: Failed to read fan %d speed: %v",
+				pingFan, err)
+		}
+	} else if err := controller.Ping(); err != nil {
 		// Close, we already have an error...so ignore Close error
 		controller.Close()
 		return fmt.Errorf("Open: Failed to ping controller: %v", err)
@@ -105,6 +180,21 @@ func (controller *GridFanController) Open() error {
 	return nil
 }
 
+// Resolve the local serial device path of the controller, discovering it
+// or looking up its USB serial number
+func (controller *GridFanController) resolveDevicePath() (string, error) {
+	devicePath := controller.DevicePath
+	switch {
+	case devicePath == AutoDevicePath:
+		return discoverSerial()
+	case strings.HasPrefix(devicePath, SerialNumberPrefix):
+		return resolveSerialNumber(
+			strings.TrimPrefix(devicePath, SerialNumberPrefix))
+	default:
+		return devicePath, nil
+	}
+}
+
 // Close controller
 func (controller *GridFanController) Close() error {
 	if controller.serial == nil {
@@ -138,8 +228,8 @@ func (controller *GridFanController) Ping() error {
 		return err
 	}
 
-	if reply[0] != 0x21 {
-		return fmt.Errorf("Ping: Unexpected reply: %d", reply[0])
+	if err := parseAck(reply, 0x21); err != nil {
+		return fmt.Errorf("Ping: %v", err)
 	}
 
 	return nil
@@ -170,15 +260,46 @@ func (controller *GridFanController) GetSpeed(fan int) (int, error) {
 		return speed, err
 	}
 
-	if !bytes.Equal(reply[0:3], []byte{0xc0, 0x00, 0x00}) {
-		return speed, fmt.Errorf("GetSpeed: Malformed reply: %v", reply)
+	speed, err := parseGetSpeedReply(reply)
+	if err != nil {
+		return speed, fmt.Errorf("GetSpeed: %v", err)
 	}
 
-	speed = (int(reply[3]) << 8) | int(reply[4])
-
 	return speed, nil
 }
 
+// GetDuty of a fan in percent, derived from its voltage. Returns the same
+// values as accepted by SetSpeed.
+func (controller *GridFanController) GetDuty(fan int) (int, error) {
+	duty := 0
+	if controller.serial == nil {
+		return duty, fmt.Errorf("GetDuty: Controller is not open")
+	}
+
+	if !controller.IsValidFan(fan) {
+		return duty, fmt.Errorf(
+			"GetDuty: Bad fan number: %d not in range [%d, %d]", fan,
+			GridMinFanIndex, GridMaxFanIndex)
+	}
+
+	data := []byte{0x84, byte(fan)}
+	if err := controller.writeFully(data); err != nil {
+		return duty, err
+	}
+
+	reply := make([]byte, 5)
+	if err := controller.readFully(reply); err != nil {
+		return duty, err
+	}
+
+	duty, err := parseGetDutyReply(reply)
+	if err != nil {
+		return duty, fmt.Errorf("GetDuty: %v", err)
+	}
+
+	return duty, nil
+}
+
 // SetSpeed of a fan
 func (controller *GridFanController) SetSpeed(fan int, rpm int) error {
 	if controller.serial == nil {
@@ -212,8 +333,8 @@ func (controller *GridFanController) SetSpeed(fan int, rpm int) error {
 		return err
 	}
 
-	if reply[0] != 0x1 {
-		return fmt.Errorf("SetSpeed: Unexpected reply: %d", reply[0])
+	if err := parseAck(reply, 0x1); err != nil {
+		return fmt.Errorf("SetSpeed: %v", err)
 	}
 
 	return nil
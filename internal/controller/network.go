@@ -0,0 +1,271 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Network device path prefixes
+const (
+	tcpPrefix     = "tcp://"
+	rfc2217Prefix = "rfc2217://"
+)
+
+// Timeout for network reads, writes and connect
+const networkTimeout = 5 * time.Second
+
+// Telnet commands and options (RFC 854, RFC 856, RFC 2217)
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWill = 251
+	telnetWont = 252
+	telnetDo   = 253
+	telnetDont = 254
+	telnetIAC  = 255
+
+	telnetOptionBinary  = 0
+	telnetOptionComPort = 44
+
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+
+	comPortParityNone = 1
+	comPortStopSize1  = 1
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// IsNetworkPath checks if a device path is a tcp:// or rfc2217:// address.
+func IsNetworkPath(devicePath string) bool {
+	return strings.HasPrefix(devicePath, tcpPrefix) ||
+		strings.HasPrefix(devicePath, rfc2217Prefix)
+}
+
+// Open a network connection to a remote serial device
+func openNetwork(devicePath string) (io.ReadWriteCloser, error) {
+	switch {
+	case strings.HasPrefix(devicePath, tcpPrefix):
+		conn, err := net.DialTimeout("tcp",
+			strings.TrimPrefix(devicePath, tcpPrefix), networkTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpConn{conn: conn}, nil
+
+	case strings.HasPrefix(devicePath, rfc2217Prefix):
+		conn, err := net.DialTimeout("tcp",
+			strings.TrimPrefix(devicePath, rfc2217Prefix), networkTimeout)
+		if err != nil {
+			return nil, err
+		}
+		telnet := &telnetConn{tcpConn: tcpConn{conn: conn},
+			reader: bufio.NewReader(conn)}
+		if err := telnet.configure(gridBaudRate); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return telnet, nil
+
+	default:
+		return nil, fmt.Errorf("openNetwork: Unsupported device path: %s",
+			devicePath)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// tcpConn is a raw TCP connection with per operation deadlines, as used by
+// ser2net in raw mode.
+type tcpConn struct {
+	conn net.Conn
+}
+
+func (c *tcpConn) Read(b []byte) (int, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(networkTimeout)); err != nil {
+		return 0, err
+	}
+	return c.conn.Read(b)
+}
+
+func (c *tcpConn) Write(b []byte) (int, error) {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(networkTimeout)); err != nil {
+		return 0, err
+	}
+	return c.conn.Write(b)
+}
+
+func (c *tcpConn) Close() error {
+	return c.conn.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// telnetConn is a telnet connection with the RFC 2217 com port option, as
+// used by ser2net in telnet mode.
+type telnetConn struct {
+	tcpConn
+	reader *bufio.Reader
+}
+
+// Negotiate binary mode and set serial port parameters
+func (c *telnetConn) configure(baud int) error {
+	baudBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(baudBytes, uint32(baud))
+
+	data := []byte{
+		telnetIAC, telnetWill, telnetOptionBinary,
+		telnetIAC, telnetDo, telnetOptionBinary,
+		telnetIAC, telnetWill, telnetOptionComPort,
+	}
+	data = append(data, c.subnegotiation(comPortSetBaudRate, baudBytes...)...)
+	data = append(data, c.subnegotiation(comPortSetDataSize, 8)...)
+	data = append(data, c.subnegotiation(comPortSetParity, comPortParityNone)...)
+	data = append(data, c.subnegotiation(comPortSetStopSize, comPortStopSize1)...)
+
+	_, err := c.tcpConn.Write(data)
+	return err
+}
+
+// Build a com port subnegotiation, escaping IAC in the value
+func (c *telnetConn) subnegotiation(command byte, value ...byte) []byte {
+	data := []byte{telnetIAC, telnetSB, telnetOptionComPort, command}
+	data = append(data, escapeIAC(value)...)
+	return append(data, telnetIAC, telnetSE)
+}
+
+// Reply to an option request from the server
+func (c *telnetConn) reply(command byte, option byte) error {
+	accept := option == telnetOptionBinary || option == telnetOptionComPort
+
+	var response byte
+	switch command {
+	case telnetDo:
+		response = telnetWont
+		if accept {
+			response = telnetWill
+		}
+	case telnetWill:
+		response = telnetDont
+		if accept {
+			response = telnetDo
+		}
+	default:
+		// WONT and DONT need no reply
+		return nil
+	}
+
+	_, err := c.tcpConn.Write([]byte{telnetIAC, response, option})
+	return err
+}
+
+// Read data bytes, handling any telnet commands in the stream
+func (c *telnetConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(networkTimeout)); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for n == 0 || (n < len(b) && c.reader.Buffered() > 0) {
+		value, err := c.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+
+		if value != telnetIAC {
+			b[n] = value
+			n++
+			continue
+		}
+
+		command, err := c.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+
+		switch command {
+		case telnetIAC:
+			// Escaped data byte
+			b[n] = telnetIAC
+			n++
+
+		case telnetWill, telnetWont, telnetDo, telnetDont:
+			option, err := c.reader.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			if err := c.reply(command, option); err != nil {
+				return n, err
+			}
+
+		case telnetSB:
+			// Skip subnegotiation replies until IAC SE
+			previous := byte(0)
+			for {
+				value, err := c.reader.ReadByte()
+				if err != nil {
+					return n, err
+				}
+				if previous == telnetIAC && value == telnetSE {
+					break
+				}
+				if previous == telnetIAC && value == telnetIAC {
+					value = 0
+				}
+				previous = value
+			}
+
+		default:
+			// Other commands carry no data
+		}
+	}
+
+	return n, nil
+}
+
+// Write data bytes, escaping IAC
+func (c *telnetConn) Write(b []byte) (int, error) {
+	if _, err := c.tcpConn.Write(escapeIAC(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Double any IAC bytes in data
+func escapeIAC(data []byte) []byte {
+	escaped := make([]byte, 0, len(data))
+	for _, value := range data {
+		escaped = append(escaped, value)
+		if value == telnetIAC {
+			escaped = append(escaped, telnetIAC)
+		}
+	}
+	return escaped
+}
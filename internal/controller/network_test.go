@@ -0,0 +1,184 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Telnet connection to a local server, and the server side of it
+func telnetPair(t *testing.T) (*telnetConn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &telnetConn{tcpConn: tcpConn{conn: conn},
+		reader: bufio.NewReader(conn)}, server
+}
+
+// Read what the server received within a short time
+func readAvailable(server net.Conn) []byte {
+	server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	received := []byte{}
+	buffer := make([]byte, 64)
+	for {
+		n, err := server.Read(buffer)
+		received = append(received, buffer[:n]...)
+		if err != nil {
+			return received
+		}
+	}
+}
+
+func TestEscapeIAC(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected []byte
+	}{
+		{[]byte{}, []byte{}},
+		{[]byte{0x44, 0x01, 0xc0}, []byte{0x44, 0x01, 0xc0}},
+		{[]byte{0xff}, []byte{0xff, 0xff}},
+		{[]byte{0x01, 0xff, 0xff, 0x02}, []byte{0x01, 0xff, 0xff, 0xff,
+			0xff, 0x02}},
+	}
+
+	for _, test := range tests {
+		if escaped := escapeIAC(test.data); !bytes.Equal(escaped,
+			test.expected) {
+			t.Errorf("escapeIAC(%x) = %x, expected %x", test.data, escaped,
+				test.expected)
+		}
+	}
+}
+
+// Data written is escaped, and data read is unescaped, with option requests
+// of the server answered, and its subnegotiations skipped
+func TestTelnetRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  []byte
+		data    []byte
+		replies []byte
+	}{
+		{"data", []byte{0x01, 0x02, 0x03}, []byte{0x01, 0x02, 0x03},
+			[]byte{}},
+		{"escaped IAC", []byte{0x01, 0xff, 0xff, 0x02},
+			[]byte{0x01, 0xff, 0x02}, []byte{}},
+		{"escaped IAC only", []byte{0xff, 0xff}, []byte{0xff}, []byte{}},
+		{"do binary", []byte{0xff, telnetDo, telnetOptionBinary, 0x21},
+			[]byte{0x21}, []byte{0xff, telnetWill, telnetOptionBinary}},
+		{"do echo", []byte{0xff, telnetDo, 1, 0x21}, []byte{0x21},
+			[]byte{0xff, telnetWont, 1}},
+		{"will com port", []byte{0xff, telnetWill, telnetOptionComPort,
+			0x21}, []byte{0x21},
+			[]byte{0xff, telnetDo, telnetOptionComPort}},
+		{"will echo", []byte{0xff, telnetWill, 1, 0x21}, []byte{0x21},
+			[]byte{0xff, telnetDont, 1}},
+		{"wont and dont", []byte{0xff, telnetWont, 1, 0xff, telnetDont, 1,
+			0x21}, []byte{0x21}, []byte{}},
+		{"subnegotiation", []byte{0xff, telnetSB, telnetOptionComPort,
+			100 + comPortSetBaudRate, 0x00, 0x00, 0x12, 0xc0, 0xff, telnetSE,
+			0x21}, []byte{0x21}, []byte{}},
+		{"subnegotiation escaped IAC", []byte{0xff, telnetSB,
+			telnetOptionComPort, 100 + comPortSetBaudRate, 0x00, 0xff, 0xff,
+			telnetSE, 0x00, 0xff, telnetSE, 0x21}, []byte{0x21}, []byte{}},
+		{"other command", []byte{0xff, 241, 0x21}, []byte{0x21}, []byte{}},
+	}
+
+	for _, test := range tests {
+		conn, server := telnetPair(t)
+		if _, err := server.Write(test.stream); err != nil {
+			t.Fatal(err)
+		}
+
+		data := make([]byte, len(test.data))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !bytes.Equal(data, test.data) {
+			t.Errorf("%s: read %x, expected %x", test.name, data, test.data)
+		}
+		if replies := readAvailable(server); !bytes.Equal(replies,
+			test.replies) {
+			t.Errorf("%s: replies %x, expected %x", test.name, replies,
+				test.replies)
+		}
+
+		conn.Close()
+		server.Close()
+	}
+}
+
+func TestTelnetWrite(t *testing.T) {
+	conn, server := telnetPair(t)
+	defer conn.Close()
+	defer server.Close()
+
+	data := []byte{0x44, 0x01, 0xc0, 0x00, 0x00, 0xff, 0x02}
+	if n, err := conn.Write(data); n != len(data) || err != nil {
+		t.Errorf("Write = %d, %v, expected %d", n, err, len(data))
+	}
+
+	expected := []byte{0x44, 0x01, 0xc0, 0x00, 0x00, 0xff, 0xff, 0x02}
+	if written := readAvailable(server); !bytes.Equal(written, expected) {
+		t.Errorf("written %x, expected %x", written, expected)
+	}
+}
+
+// Serial parameters are sent as com port subnegotiations, whose values have
+// IAC escaped
+func TestTelnetConfigure(t *testing.T) {
+	conn, server := telnetPair(t)
+	defer conn.Close()
+	defer server.Close()
+
+	if err := conn.configure(0x1ff); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0xff, telnetWill, telnetOptionBinary,
+		0xff, telnetDo, telnetOptionBinary,
+		0xff, telnetWill, telnetOptionComPort,
+		0xff, telnetSB, telnetOptionComPort, comPortSetBaudRate,
+		0x00, 0x00, 0x01, 0xff, 0xff, 0xff, telnetSE,
+		0xff, telnetSB, telnetOptionComPort, comPortSetDataSize, 8,
+		0xff, telnetSE,
+		0xff, telnetSB, telnetOptionComPort, comPortSetParity,
+		comPortParityNone, 0xff, telnetSE,
+		0xff, telnetSB, telnetOptionComPort, comPortSetStopSize,
+		comPortStopSize1, 0xff, telnetSE,
+	}
+	if written := readAvailable(server); !bytes.Equal(written, expected) {
+		t.Errorf("configure wrote %x, expected %x", written, expected)
+	}
+}
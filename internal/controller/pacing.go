@@ -0,0 +1,64 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// pacer is a token bucket for controller commands. The bucket holds up to
+// CommandBurst tokens, and refills one token every CommandDelay.
+type pacer struct {
+	tokens float64
+	last   time.Time
+}
+
+// Wait until the next command may be sent
+func (controller *GridFanController) pace() {
+	delay := controller.quirks.CommandDelay
+	if delay <= 0 {
+		return
+	}
+
+	burst := controller.CommandBurst
+	if burst < 1 {
+		burst = 1
+	}
+
+	// Refill tokens since the last command
+	now := time.Now()
+	pacer := &controller.pacer
+	if pacer.last.IsZero() {
+		pacer.tokens = float64(burst)
+	} else {
+		pacer.tokens += float64(now.Sub(pacer.last)) / float64(delay)
+		if pacer.tokens > float64(burst) {
+			pacer.tokens = float64(burst)
+		}
+	}
+	pacer.last = now
+
+	// Wait for a token
+	if pacer.tokens < 1 {
+		wait := time.Duration((1 - pacer.tokens) * float64(delay))
+		time.Sleep(wait)
+		pacer.tokens = 1
+		pacer.last = now.Add(wait)
+	}
+
+	pacer.tokens--
+}
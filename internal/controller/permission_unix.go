@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Add a remediation hint to err of opening serial device path, if it is
+// permission denied: serial devices are usually owned by a group, such as
+// dialout or uucp, which the user must be in
+func permissionHint(devicePath string, err error) error {
+	if !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	username := "USER"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	info, statErr := os.Stat(devicePath)
+	if statErr != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return err
+	}
+
+	gid := strconv.FormatUint(uint64(stat.Gid), 10)
+	group := gid
+	if found, err := user.LookupGroupId(gid); err == nil {
+		group = found.Name
+	}
+
+	if info.Mode().Perm()&0060 != 0060 {
+		return fmt.Errorf(
+			"Open: %v: %s is not readable and writable by its group %s, run as root, or grant the group access with a udev rule",
+			err, devicePath, group)
+	}
+
+	return fmt.Errorf(
+		"Open: %v: %s belongs to group %s, add %s to it with: sudo usermod -aG %s %s, and log in again",
+		err, devicePath, group, username, group, username)
+}
@@ -0,0 +1,163 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/api"
+	"strings"
+	"time"
+)
+
+// Identity of a controller, defined in the api package for clients
+type Identity = api.ControllerIdentity
+
+// Quirks of a controller firmware or clone, and the workarounds for them:
+// pacing commands by CommandDelay, checking it by a speed read instead of a
+// ping with SkipPing, and accepting duties read back within
+// ReadbackTolerance percent of the duty set.
+type Quirks struct {
+	Profile           string
+	CommandDelay      time.Duration
+	SkipPing          bool
+	ReadbackTolerance int
+}
+
+// QuirksProfile of controllers identified by the USB vendor and product id of
+// their serial adapter
+type QuirksProfile struct {
+	Name      string
+	VendorID  string
+	ProductID string
+	Quirks    Quirks
+}
+
+// Quirks profile settings: auto picks the profile of the identified
+// controller, and none applies no profile
+const (
+	QuirksAuto = "auto"
+	QuirksNone = "none"
+)
+
+// Known quirks profiles. Clones of the Grid+ use cheaper USB serial adapters
+// than the original, which drop commands sent back to back, answer the ping
+// unreliably, or round the duty read back differently.
+var QuirksProfiles = []QuirksProfile{
+	{Name: "ch340", VendorID: "1a86", ProductID: "7523",
+		Quirks: Quirks{CommandDelay: 50 * time.Millisecond, SkipPing: true,
+			ReadbackTolerance: 1}},
+	{Name: "cp210x", VendorID: "10c4", ProductID: "ea60",
+		Quirks: Quirks{CommandDelay: 20 * time.Millisecond,
+			ReadbackTolerance: 1}},
+	{Name: "pl2303", VendorID: "067b", ProductID: "2303",
+		Quirks: Quirks{CommandDelay: 50 * time.Millisecond}},
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// LookupQuirks of the profile of an identified controller. Returns false if no
+// profile matches.
+func LookupQuirks(identity Identity) (Quirks, bool) {
+	for _, profile := range QuirksProfiles {
+		if strings.EqualFold(profile.VendorID, identity.VendorID) &&
+			strings.EqualFold(profile.ProductID, identity.ProductID) {
+			return profile.profileQuirks(), true
+		}
+	}
+	return Quirks{}, false
+}
+
+// NamedQuirks of the profile with name. Returns false if there is none.
+func NamedQuirks(name string) (Quirks, bool) {
+	for _, profile := range QuirksProfiles {
+		if profile.Name == name {
+			return profile.profileQuirks(), true
+		}
+	}
+	return Quirks{}, false
+}
+
+// Quirks of profile, named after it
+func (profile QuirksProfile) profileQuirks() Quirks {
+	quirks := profile.Quirks
+	quirks.Profile = profile.Name
+	return quirks
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Identify controller, by the USB device of its serial adapter. Network
+// controllers can not be identified.
+func (controller *GridFanController) Identify() (Identity, error) {
+	if IsNetworkPath(controller.DevicePath) {
+		return Identity{}, fmt.Errorf(
+			"Identify: Network controllers can not be identified")
+	}
+
+	devicePath, err := controller.resolveDevicePath()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return usbIdentity(devicePath)
+}
+
+// Apply quirks of the QuirksProfile of controller with identity, and the
+// settings of controller on top of them
+func (controller *GridFanController) applyQuirks(identity Identity) {
+	quirks := Quirks{}
+	switch controller.QuirksProfile {
+	case "", QuirksAuto:
+		quirks, _ = LookupQuirks(identity)
+	case QuirksNone:
+	default:
+		quirks, _ = NamedQuirks(controller.QuirksProfile)
+	}
+
+	if controller.CommandDelay != 0 {
+		quirks.CommandDelay = controller.CommandDelay
+	}
+	if controller.SkipPing {
+		quirks.SkipPing = true
+	}
+	if controller.ReadbackTolerance != 0 {
+		quirks.ReadbackTolerance = controller.ReadbackTolerance
+	}
+
+	controller.identity = identity
+	controller.quirks = quirks
+}
+
+// ActiveQuirks of controller, as applied on its last Open
+func (controller *GridFanController) ActiveQuirks() Quirks {
+	return controller.quirks
+}
+
+// ActiveIdentity of controller, as identified on its last Open
+func (controller *GridFanController) ActiveIdentity() Identity {
+	return controller.identity
+}
+
+// DutyMatches if duty read back of a fan is within the readback tolerance of
+// the rpm set
+func (controller *GridFanController) DutyMatches(rpm int, duty int) bool {
+	difference := duty - rpm
+	if difference < 0 {
+		difference = -difference
+	}
+	return difference <= controller.quirks.ReadbackTolerance
+}
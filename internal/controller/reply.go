@@ -0,0 +1,81 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Header of get speed and get duty replies
+var replyHeader = []byte{0xc0, 0x00, 0x00}
+
+// Parse single byte acknowledgement reply, such as of Ping and SetSpeed
+func parseAck(reply []byte, expected byte) error {
+	if len(reply) != 1 {
+		return fmt.Errorf("parseAck: Bad reply length: %d", len(reply))
+	}
+
+	if reply[0] != expected {
+		return fmt.Errorf("parseAck: Unexpected reply: %d", reply[0])
+	}
+
+	return nil
+}
+
+// Parse value of a get speed or get duty reply: header, and two value bytes
+func parseValueReply(reply []byte) (byte, byte, error) {
+	if len(reply) != 5 {
+		return 0, 0, fmt.Errorf("Bad reply length: %d", len(reply))
+	}
+
+	if !bytes.Equal(reply[0:3], replyHeader) {
+		return 0, 0, fmt.Errorf("Malformed reply: %v", reply)
+	}
+
+	return reply[3], reply[4], nil
+}
+
+// Parse speed in rpm of a get speed reply
+func parseGetSpeedReply(reply []byte) (int, error) {
+	high, low, err := parseValueReply(reply)
+	if err != nil {
+		return 0, fmt.Errorf("parseGetSpeedReply: %v", err)
+	}
+
+	return (int(high) << 8) | int(low), nil
+}
+
+// Parse duty in percent of a get duty reply, as the inverse of the SetSpeed
+// voltage encoding
+func parseGetDutyReply(reply []byte) (int, error) {
+	whole, fraction, err := parseValueReply(reply)
+	if err != nil {
+		return 0, fmt.Errorf("parseGetDutyReply: %v", err)
+	}
+
+	if whole < 2 {
+		return 0, nil
+	}
+
+	duty := (int(whole)-2)*10 + (int(fraction)+0x8)/0x10
+	if duty > GridMaxFanRPM {
+		duty = GridMaxFanRPM
+	}
+
+	return duty, nil
+}
@@ -0,0 +1,84 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Encode speed in rpm as a get speed reply, as sent by the controller
+func encodeGetSpeedReply(speed int) []byte {
+	return append(append([]byte{}, replyHeader...), byte(speed>>8),
+		byte(speed))
+}
+
+func FuzzParseGetSpeedReply(f *testing.F) {
+	for _, speed := range []int{0, 1, 255, 256, 1200, 2900, 0xffff} {
+		reply := encodeGetSpeedReply(speed)
+		f.Add(reply)
+		for length := 0; length < len(reply); length++ {
+			f.Add(reply[:length])
+		}
+		f.Add(append(reply, 0x00))
+	}
+	f.Add([]byte{0xc0, 0x00, 0x01, 0x04, 0xb0})
+	f.Add([]byte{0x21, 0x00, 0x00, 0x04, 0xb0})
+
+	f.Fuzz(func(t *testing.T, reply []byte) {
+		speed, err := parseGetSpeedReply(reply)
+
+		valid := len(reply) == 5 && bytes.HasPrefix(reply, replyHeader)
+		if valid != (err == nil) {
+			t.Fatalf("parseGetSpeedReply(%v) = %d, %v, expected valid: %v",
+				reply, speed, err, valid)
+		}
+		if err != nil {
+			return
+		}
+
+		if speed < 0 || speed > 0xffff {
+			t.Fatalf("parseGetSpeedReply(%v) = %d, out of range", reply,
+				speed)
+		}
+		if encoded := encodeGetSpeedReply(speed); !bytes.Equal(encoded,
+			reply) {
+			t.Fatalf("parseGetSpeedReply(%v) = %d, which encodes to %v",
+				reply, speed, encoded)
+		}
+	})
+}
+
+func FuzzParseAck(f *testing.F) {
+	for _, expected := range []byte{0x01, 0x21} {
+		f.Add([]byte{expected}, expected)
+		f.Add([]byte{}, expected)
+		f.Add([]byte{expected, expected}, expected)
+		f.Add([]byte{0x00}, expected)
+		f.Add([]byte{0xc0, 0x00, 0x00, 0x04, 0xb0}, expected)
+	}
+
+	f.Fuzz(func(t *testing.T, reply []byte, expected byte) {
+		err := parseAck(reply, expected)
+
+		valid := bytes.Equal(reply, []byte{expected})
+		if valid != (err == nil) {
+			t.Fatalf("parseAck(%v, %d) = %v, expected valid: %v", reply,
+				expected, err, valid)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+//go:build darwin
+// +build darwin
+
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Serial devices of USB adapters, which may be the controller. The cu device
+// does not wait for carrier detect, unlike the tty one.
+const serialPattern = "/dev/cu.usbserial*"
+
+// Name prefixes of the serial devices of USB adapters, rather than modems or
+// Bluetooth ports
+var usbSerialPrefixes = []string{"cu.usbserial", "tty.usbserial",
+	"cu.usbmodem", "tty.usbmodem"}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Run ioctl on file
+func ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request,
+		uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Open a local serial device, raw, at the controller baud rate, 8N1, with
+// reads returning nothing after the read timeout. Uses termios directly, so
+// that builds do not need cgo.
+func openSerial(devicePath string) (io.ReadWriteCloser, error) {
+	file, err := os.OpenFile(devicePath,
+		os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	termios := syscall.Termios{
+		Cflag:  syscall.CREAD | syscall.CLOCAL | syscall.CS8,
+		Ispeed: syscall.B4800,
+		Ospeed: syscall.B4800,
+	}
+	termios.Cc[syscall.VMIN] = 0
+	termios.Cc[syscall.VTIME] = uint8(gridReadTimeout.Seconds() * 10)
+	if err := ioctl(file, syscall.TIOCSETA, unsafe.Pointer(&termios)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("openSerial: Failed to configure %s: %v",
+			devicePath, err)
+	}
+
+	// Block in reads, up to the read timeout
+	if err := syscall.SetNonblock(int(file.Fd()), false); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Drop stale input and output
+	flush := 0
+	if err := ioctl(file, syscall.TIOCFLUSH, unsafe.Pointer(&flush)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("openSerial: Failed to flush %s: %v",
+			devicePath, err)
+	}
+
+	return file, nil
+}
+
+// Discover the serial device of the controller, as the only USB serial
+// adapter
+func discoverSerial() (string, error) {
+	paths, err := filepath.Glob(serialPattern)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(paths) {
+	case 0:
+		return "", fmt.Errorf("discoverSerial: No device matches %s",
+			serialPattern)
+	case 1:
+		return paths[0], nil
+	default:
+		return "", fmt.Errorf(
+			"discoverSerial: More than one device matches %s: %v",
+			serialPattern, paths)
+	}
+}
+
+// USB serial adapters, named by the FTDI driver after the serial number of
+// the adapter, such as /dev/cu.usbserial-A600XYZ
+func usbSerials() ([]USBSerial, error) {
+	paths, err := filepath.Glob(serialPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []USBSerial{}
+	for _, path := range paths {
+		serialNumber := strings.TrimPrefix(filepath.Base(path), "cu.usbserial")
+		serialNumber = strings.TrimPrefix(serialNumber, "-")
+		if len(serialNumber) != 0 {
+			devices = append(devices, USBSerial{SerialNumber: serialNumber,
+				DevicePath: path})
+		}
+	}
+
+	return devices, nil
+}
+
+// Identity of the USB device of a serial device, which is only read on Linux
+func usbIdentity(devicePath string) (Identity, error) {
+	return Identity{}, fmt.Errorf(
+		"usbIdentity: USB identities are only supported on Linux")
+}
+
+// Check serial device is named as the device of a USB serial adapter
+func checkSerialDevice(devicePath string) error {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(resolved)
+	for _, prefix := range usbSerialPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a USB serial adapter", resolved)
+}
@@ -0,0 +1,46 @@
+//go:build !darwin
+// +build !darwin
+
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/tarm/serial"
+	"io"
+)
+
+// Open a local serial device
+func openSerial(devicePath string) (io.ReadWriteCloser, error) {
+	c := &serial.Config{Name: devicePath, Baud: gridBaudRate,
+		ReadTimeout: gridReadTimeout}
+	s, err := serial.OpenPort(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Flush()
+	return s, nil
+}
+
+// Discover the serial device of the controller, which is only supported on
+// macOS
+func discoverSerial() (string, error) {
+	return "", fmt.Errorf(
+		"discoverSerial: Serial device discovery is only supported on macOS")
+}
@@ -0,0 +1,87 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"sort"
+)
+
+// Plausible fan speed readings in rpm
+const (
+	minPlausibleSpeed = 0
+	maxPlausibleSpeed = 4000
+)
+
+// Number of readings per fan for the median
+const speedFilterWindow = 5
+
+// SpeedFilter of implausible fan speed readings, which some adapters return
+// as spikes: readings outside [0, 4000] rpm, or readings more than 50% away
+// from the median of the last readings of the fan. Readings away from the
+// median are still remembered, so that a real change in speed is accepted
+// once it persists.
+type SpeedFilter struct {
+	readings map[int][]int
+}
+
+// Filter a raw speed reading of fan. Returns the speed, which is the median
+// of previous readings for a discarded reading, and whether the reading was
+// accepted.
+func (filter *SpeedFilter) Filter(fan int, raw int) (int, bool) {
+	if filter.readings == nil {
+		filter.readings = map[int][]int{}
+	}
+
+	readings := filter.readings[fan]
+	median := speedMedian(readings)
+
+	if raw < minPlausibleSpeed || raw > maxPlausibleSpeed {
+		return median, false
+	}
+
+	accepted := len(readings) < 3 || median == 0 ||
+		(raw >= median/2 && raw <= median+median/2)
+
+	if len(readings) == speedFilterWindow {
+		readings = readings[1:]
+	}
+	filter.readings[fan] = append(readings, raw)
+
+	if !accepted {
+		return median, false
+	}
+
+	return raw, true
+}
+
+// Median of the plausible speed readings of fan, and whether there are any
+func (filter *SpeedFilter) Median(fan int) (int, bool) {
+	readings := filter.readings[fan]
+	return speedMedian(readings), len(readings) != 0
+}
+
+// Get median of speed readings, or 0 if there are none
+func speedMedian(readings []int) int {
+	if len(readings) == 0 {
+		return 0
+	}
+
+	sorted := append([]int{}, readings...)
+	sort.Ints(sorted)
+
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,81 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+)
+
+func TestSpeedFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []int
+		raw      int
+		speed    int
+		accepted bool
+	}{
+		{"first", nil, 1200, 1200, true},
+		{"zero", nil, 0, 0, true},
+		{"max", nil, 4000, 4000, true},
+		{"negative", nil, -1, 0, false},
+		{"above max", nil, 4001, 0, false},
+		{"above max with median", []int{1000, 1000, 1000}, 65535, 1000, false},
+		{"few readings", []int{1000, 1000}, 3000, 3000, true},
+		{"at 50% above median", []int{1000, 1000, 1000}, 1500, 1500, true},
+		{"above 50% of median", []int{1000, 1000, 1000}, 1501, 1000, false},
+		{"at 50% below median", []int{1000, 1000, 1000}, 500, 500, true},
+		{"below 50% of median", []int{1000, 1000, 1000}, 499, 1000, false},
+		{"zero median", []int{0, 0, 0}, 1500, 1500, true},
+		{"median of window", []int{900, 3000, 1000, 1100, 20}, 1400, 1400,
+			true},
+		{"persisting change", []int{1000, 1000, 1000, 3000, 3000, 3000},
+			3000, 3000, true},
+	}
+
+	for _, test := range tests {
+		filter := SpeedFilter{}
+		for _, raw := range test.previous {
+			filter.Filter(1, raw)
+		}
+
+		speed, accepted := filter.Filter(1, test.raw)
+		if speed != test.speed || accepted != test.accepted {
+			t.Errorf("%s: Filter(%d) = %d, %v, expected %d, %v", test.name,
+				test.raw, speed, accepted, test.speed, test.accepted)
+		}
+	}
+}
+
+// Readings are filtered per fan, and implausible ones are not remembered
+func TestSpeedFilterMedian(t *testing.T) {
+	filter := SpeedFilter{}
+	if _, ok := filter.Median(1); ok {
+		t.Errorf("Median of no readings, expected none")
+	}
+
+	for _, raw := range []int{1000, 1200, 5000, 1100} {
+		filter.Filter(1, raw)
+	}
+	filter.Filter(2, 600)
+
+	if median, ok := filter.Median(1); median != 1100 || !ok {
+		t.Errorf("Median(1) = %d, %v, expected 1100", median, ok)
+	}
+	if median, ok := filter.Median(2); median != 600 || !ok {
+		t.Errorf("Median(2) = %d, %v, expected 600", median, ok)
+	}
+}
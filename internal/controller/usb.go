@@ -0,0 +1,61 @@
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"sort"
+)
+
+// USBSerial adapter, which may be a controller
+type USBSerial struct {
+	SerialNumber string
+	DevicePath   string
+}
+
+// USBSerials of the USB serial adapters, sorted by serial number
+func USBSerials() ([]USBSerial, error) {
+	devices, err := usbSerials()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].SerialNumber < devices[j].SerialNumber
+	})
+	return devices, nil
+}
+
+// Resolve the serial device of the USB serial adapter with serial number
+func resolveSerialNumber(serialNumber string) (string, error) {
+	devices, err := USBSerials()
+	if err != nil {
+		return "", err
+	}
+
+	found := []string{}
+	for _, device := range devices {
+		if device.SerialNumber == serialNumber {
+			return device.DevicePath, nil
+		}
+		found = append(found, device.SerialNumber)
+	}
+
+	return "", fmt.Errorf(
+		"resolveSerialNumber: No USB serial adapter with serial number %s, found: %v",
+		serialNumber, found)
+}
@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sysfs directories of tty devices, and of all devices
+var (
+	sysClassTTY = "/sys/class/tty"
+	sysDevices  = "/sys/devices"
+)
+
+// USB serial adapters of the ttys, with the serial number of the USB device
+// which the tty belongs to
+func usbSerials() ([]USBSerial, error) {
+	paths, err := filepath.Glob(filepath.Join(sysClassTTY, "*", "device"))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []USBSerial{}
+	for _, path := range paths {
+		name := filepath.Base(filepath.Dir(path))
+		directory, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			continue
+		}
+
+		// Up from the interface of the tty, to the USB device with the serial
+		for strings.HasPrefix(directory, sysDevices+"/") {
+			contents, err := ioutil.ReadFile(filepath.Join(directory, "serial"))
+			if os.IsNotExist(err) {
+				directory = filepath.Dir(directory)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			devices = append(devices, USBSerial{
+				SerialNumber: strings.TrimSpace(string(contents)),
+				DevicePath:   filepath.Join("/dev", name)})
+			break
+		}
+	}
+
+	return devices, nil
+}
+
+// Identity of the USB device which the tty of a serial device belongs to
+func usbIdentity(devicePath string) (Identity, error) {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	path := filepath.Join(sysClassTTY, filepath.Base(resolved), "device")
+	directory, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	// Up from the interface of the tty, to the USB device with the ids
+	for strings.HasPrefix(directory, sysDevices+"/") {
+		vendorID, err := ioutil.ReadFile(filepath.Join(directory, "idVendor"))
+		if os.IsNotExist(err) {
+			directory = filepath.Dir(directory)
+			continue
+		} else if err != nil {
+			return Identity{}, err
+		}
+
+		productID, err := ioutil.ReadFile(filepath.Join(directory,
+			"idProduct"))
+		if err != nil {
+			return Identity{}, err
+		}
+
+		// Not every device names its product
+		product, _ := ioutil.ReadFile(filepath.Join(directory, "product"))
+
+		return Identity{VendorID: strings.TrimSpace(string(vendorID)),
+			ProductID: strings.TrimSpace(string(productID)),
+			Product:   strings.TrimSpace(string(product))}, nil
+	}
+
+	return Identity{}, fmt.Errorf("usbIdentity: %s is not a USB serial device",
+		devicePath)
+}
+
+// Drivers of USB ttys which are modems, rather than serial adapters
+var modemDrivers = map[string]bool{"option": true, "qcserial": true,
+	"sierra": true, "qmi_wwan": true}
+
+// Check serial device is the tty of a USB serial adapter, and not a console,
+// an onboard UART, or a USB modem
+func checkSerialDevice(devicePath string) error {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(resolved)
+	if name == "console" || name == "tty" ||
+		strings.HasPrefix(name, "ttyS") || strings.HasPrefix(name, "ttyAMA") ||
+		(strings.HasPrefix(name, "tty") && len(name) > 3 &&
+			name[3] >= '0' && name[3] <= '9') {
+		return fmt.Errorf("%s is a console or an onboard serial port",
+			resolved)
+	}
+
+	if _, err := usbIdentity(resolved); err != nil {
+		return fmt.Errorf("%s is not a USB serial adapter", resolved)
+	}
+
+	driver, err := filepath.EvalSymlinks(filepath.Join(sysClassTTY, name,
+		"device", "driver"))
+	if err == nil && modemDrivers[filepath.Base(driver)] {
+		return fmt.Errorf("%s is a USB modem of driver %s", resolved,
+			filepath.Base(driver))
+	}
+
+	return nil
+}
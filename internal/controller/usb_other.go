@@ -0,0 +1,42 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package controller
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+)
+
+// USB serial adapters, which are only listed on Linux and macOS
+func usbSerials() ([]USBSerial, error) {
+	return nil, fmt.Errorf(
+		"usbSerials: USB serial numbers are only supported on Linux and macOS")
+}
+
+// Identity of the USB device of a serial device, which is only read on Linux
+func usbIdentity(devicePath string) (Identity, error) {
+	return Identity{}, fmt.Errorf(
+		"usbIdentity: USB identities are only supported on Linux")
+}
+
+// Check serial device is a USB serial adapter, which is only checked on Linux
+// and macOS
+func checkSerialDevice(devicePath string) error {
+	return nil
+}
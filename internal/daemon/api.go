@@ -0,0 +1,828 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/cybojanek/gridfan/api"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/controller"
+	"github.com/cybojanek/gridfan/internal/disk"
+	"github.com/cybojanek/gridfan/internal/version"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name of the disk curve zone
+const disksZone = config.DisksSensor
+
+// Daemon states
+const (
+	StateOK             = api.StateOK
+	StateFailsafe       = api.StateFailsafe
+	StateControllerLost = api.StateControllerLost
+)
+
+// Wire types of the API, defined in the api package for clients
+type (
+	Status           = api.Status
+	ControllerStatus = api.ControllerStatus
+	ConfigStatus     = api.ConfigStatus
+	ZoneStatus       = api.ZoneStatus
+	SensorReading    = api.SensorReading
+	FanStatus        = api.FanStatus
+	Health           = api.Health
+	Change           = api.Change
+	Event            = api.Event
+	Sample           = api.Sample
+	PushedTarget     = api.PushedTarget
+	DiskLimit        = api.DiskLimit
+	Override         = api.Override
+)
+
+// Gauge values of daemon states, for metrics
+var stateValues = map[string]int{StateOK: 0, StateFailsafe: 1,
+	StateControllerLost: 2}
+
+// Status of each controller of chain, as of its last open
+func controllerStatuses(chain *controller.Chain) []ControllerStatus {
+	statuses := []ControllerStatus{}
+	for i := range chain.Controllers {
+		grid := &chain.Controllers[i]
+		quirks := grid.ActiveQuirks()
+		statuses = append(statuses, ControllerStatus{
+			DevicePath:        grid.DevicePath,
+			Identity:          grid.ActiveIdentity(),
+			QuirksProfile:     quirks.Profile,
+			CommandDelay:      int(quirks.CommandDelay / time.Millisecond),
+			SkipPing:          quirks.SkipPing,
+			ReadbackTolerance: quirks.ReadbackTolerance,
+		})
+	}
+	return statuses
+}
+
+// Get config status of config
+func configStatus(config config.Config) ConfigStatus {
+	status := ConfigStatus{Path: config.Path, SHA256: config.SHA256,
+		Profile: config.Profile}
+	if !config.Loaded.IsZero() {
+		loaded := config.Loaded
+		status.Loaded = &loaded
+	}
+	return status
+}
+
+// Get sensor readings of sensor temperatures, sorted by name
+func sensorReadings(temperatures map[string]int) []SensorReading {
+	readings := []SensorReading{}
+	for name, temperature := range temperatures {
+		readings = append(readings, SensorReading{Name: name,
+			Temperature: temperature})
+	}
+
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Name < readings[j].Name
+	})
+
+	return readings
+}
+
+// generatedConfig of the daemon, and the generation of SetConfig which set it
+type generatedConfig struct {
+	config     config.Config
+	generation uint64
+}
+
+// statusServer serves the latest Status and config over HTTP. The status and
+// config are immutable snapshots, swapped atomically, so that reads never
+// wait for the daemon loop, and the config can be reloaded while it runs.
+type statusServer struct {
+	config      atomic.Value
+	configMutex sync.Mutex
+	started     time.Time
+
+	history   history
+	overrides overrides
+	disabled  disabledZones
+	pushed    pushedTargets
+	changes   changeLog
+	events    eventLog
+	queue     commandQueue
+	debouncer debouncer
+
+	status atomic.Value
+
+	mutex sync.Mutex
+	http  *http.Server
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SetConfig of the daemon, swapping it for the current one, as its next
+// generation. The config must not be modified afterwards.
+func (server *statusServer) SetConfig(config config.Config) {
+	server.configMutex.Lock()
+	defer server.configMutex.Unlock()
+
+	current, _ := server.config.Load().(generatedConfig)
+	server.config.Store(generatedConfig{config: config,
+		generation: current.generation + 1})
+}
+
+// Reload config, with its commands, logging its lint warnings. The listen
+// address, event log and mqtt broker only change on restart.
+func (server *statusServer) reload(config config.Config) {
+	current := server.Config()
+	if config.ListenAddress != current.ListenAddress ||
+		config.EventLog != current.EventLog || config.MQTT != current.MQTT {
+		log.Printf("WARNING listen_address, event_log and mqtt changes need a restart")
+	}
+
+	for _, warning := range config.Lint() {
+		log.Printf("WARNING %s", warning)
+	}
+
+	disk.SetCommands(config.Commands, config.StrictCommands)
+	server.SetConfig(config)
+	log.Printf("INFO Reloaded config: %s (sha256 %s)", config.Path,
+		config.SHA256)
+}
+
+// Config of the daemon, which must not be modified
+func (server *statusServer) Config() config.Config {
+	config, _ := server.ConfigGeneration()
+	return config
+}
+
+// ConfigGeneration of the daemon, with its generation, which changes on every
+// SetConfig, even of a config which was not read from a file
+func (server *statusServer) ConfigGeneration() (config.Config, uint64) {
+	current, _ := server.config.Load().(generatedConfig)
+	return current.config, current.generation
+}
+
+// Set latest status. The status must not be modified afterwards.
+func (server *statusServer) Set(status Status) {
+	server.status.Store(status)
+}
+
+// Get latest status, or an empty status before the first Set. The status
+// must not be modified.
+func (server *statusServer) Get() Status {
+	status, _ := server.status.Load().(Status)
+	return status
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Listen on address in the background
+func (server *statusServer) Listen(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", server.requireToken(server.serveStatus))
+	mux.HandleFunc("/health", server.serveHealth)
+	mux.HandleFunc("/metrics", server.serveMetrics)
+	mux.HandleFunc("/config", server.requireToken(server.serveConfig))
+	mux.HandleFunc("/history", server.requireToken(server.serveHistory))
+	mux.HandleFunc("/changes", server.requireToken(server.serveChanges))
+	mux.HandleFunc("/events", server.requireToken(server.serveEvents))
+	mux.HandleFunc("/preset", server.requireToken(server.servePreset))
+	mux.HandleFunc("/zone", server.requireToken(server.serveZone))
+	mux.HandleFunc("/profile", server.requireToken(server.serveProfile))
+	if server.Config().PushTargets {
+		mux.HandleFunc("/zones/", server.requireToken(server.serveZoneTarget))
+	}
+
+	httpServer := &http.Server{Addr: address, Handler: mux}
+	server.mutex.Lock()
+	server.http = httpServer
+	server.mutex.Unlock()
+
+	go func() {
+		log.Printf("INFO listening on: %s", address)
+		if err := httpServer.ListenAndServe(); err != nil &&
+			err != http.ErrServerClosed {
+			log.Printf("ERROR failed to serve api: %v", err)
+		}
+	}()
+}
+
+// Close listener, if any
+func (server *statusServer) Close() {
+	server.mutex.Lock()
+	httpServer := server.http
+	server.http = nil
+	server.mutex.Unlock()
+
+	if httpServer != nil {
+		if err := httpServer.Close(); err != nil {
+			log.Printf("ERROR failed to close api: %v", err)
+		}
+	}
+}
+
+// Serve status as JSON
+func (server *statusServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(server.Get()); err != nil {
+		log.Printf("ERROR failed to write status: %v", err)
+	}
+}
+
+// Serve health of the daemon as JSON, with status 503 Service Unavailable
+// while the controller is lost, for health checks of service managers and
+// containers
+func (server *statusServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	status := server.Get()
+	health := Health{State: status.State, Error: status.ControllerError}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.State == StateControllerLost {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		log.Printf("ERROR failed to write health: %v", err)
+	}
+}
+
+// Serve history as JSON
+func (server *statusServer) serveHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(server.history.Get()); err != nil {
+		log.Printf("ERROR failed to write history: %v", err)
+	}
+}
+
+// Serve last fan speed changes as JSON
+func (server *statusServer) serveChanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(server.changes.Get()); err != nil {
+		log.Printf("ERROR failed to write changes: %v", err)
+	}
+}
+
+// Debounce override request f of key by the override_debounce window
+func (server *statusServer) debounce(key string, f func()) {
+	window := time.Duration(server.Config().OverrideDebounce) *
+		time.Millisecond
+	if !server.debouncer.Do(key, window, f) {
+		log.Printf("INFO deferring %s request for override_debounce", key)
+	}
+}
+
+// Serve events as JSON lines, as they are written, until the client
+// disconnects
+func (server *statusServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := server.events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Header which requests changing fan state must carry. Web pages can not
+// send it to another origin without a CORS preflight, which is never allowed,
+// so they can not forge such requests.
+const controlHeader = "X-Gridfan-Request"
+
+// Check request carries the api_token as a bearer token, if set, or write an
+// error reply
+func (server *statusServer) authorizeToken(w http.ResponseWriter,
+	r *http.Request) bool {
+
+	token := server.Config().APIToken
+	if len(token) != 0 &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")),
+			[]byte("Bearer "+token)) != 1 {
+		http.Error(w, "bad api token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// Handler which requires the api_token, if set, before handler. Followers
+// send it to read the status of their leader.
+func (server *statusServer) requireToken(
+	handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.authorizeToken(w, r) {
+			handler(w, r)
+		}
+	}
+}
+
+// Check request is authorized to change fan state, or write an error reply.
+// With api_token, the request must carry it as a bearer token, and otherwise
+// it must come from loopback. Either way, it must carry the control header.
+func (server *statusServer) authorizeControl(w http.ResponseWriter,
+	r *http.Request) bool {
+
+	if len(r.Header.Get(controlHeader)) == 0 {
+		http.Error(w, fmt.Sprintf("missing %s header", controlHeader),
+			http.StatusForbidden)
+		return false
+	}
+
+	if len(server.Config().APIToken) != 0 {
+		return server.authorizeToken(w, r)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "changes require api_token, or loopback",
+			http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Serve preset override: GET the current one, POST name to apply a preset, or
+// DELETE to clear it
+func (server *statusServer) servePreset(w http.ResponseWriter, r *http.Request) {
+	var override *Override
+	if r.Method != http.MethodGet && !server.authorizeControl(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		override = server.overrides.Get()
+
+	case http.MethodPost:
+		name := r.FormValue("name")
+		var ok bool
+		if override, ok = server.applyPreset(name); !ok {
+			http.Error(w, fmt.Sprintf("unknown preset: %s", name),
+				http.StatusNotFound)
+			return
+		}
+
+	case http.MethodDelete:
+		server.clearPreset()
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(override); err != nil {
+		log.Printf("ERROR failed to write preset: %v", err)
+	}
+}
+
+// Serve config profile: GET the current one, or POST name to reread the
+// config file with that profile, or the profile matching the hostname
+// without name. The switch lasts until the daemon restarts.
+func (server *statusServer) serveProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !server.authorizeControl(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPost:
+		reloaded, err := readConfig(server.Config().Path, r.FormValue("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		server.reload(reloaded)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(
+		configStatus(server.Config())); err != nil {
+		log.Printf("ERROR failed to write profile: %v", err)
+	}
+}
+
+// Serve disabled zones: GET them, POST name, action disable or enable, and
+// optional duration for, to disable or enable a zone
+func (server *statusServer) serveZone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !server.authorizeControl(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPost:
+		name := r.FormValue("name")
+		if !server.Config().HasZone(name) {
+			http.Error(w, fmt.Sprintf("unknown zone: %s", name),
+				http.StatusNotFound)
+			return
+		}
+
+		switch action := r.FormValue("action"); action {
+		case "disable":
+			duration := time.Duration(server.Config().OverrideTTL) * time.Second
+			if value := r.FormValue("for"); len(value) != 0 {
+				parsed, err := time.ParseDuration(value)
+				if err != nil || parsed <= 0 {
+					http.Error(w, fmt.Sprintf("bad duration: %s", value),
+						http.StatusBadRequest)
+					return
+				}
+				duration = parsed
+			}
+			log.Printf("INFO disabling zone: %s for: %v", name, duration)
+			server.disabled.Disable(name, duration)
+			server.saveState()
+
+		case "enable":
+			log.Printf("INFO enabling zone: %s", name)
+			server.disabled.Enable(name)
+			server.saveState()
+
+		default:
+			http.Error(w, fmt.Sprintf("unknown action: %s", action),
+				http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(server.disabled.Get()); err != nil {
+		log.Printf("ERROR failed to write zones: %v", err)
+	}
+}
+
+// Serve pushed target of zone on /zones/NAME/target: GET it, POST rpm to push
+// it, or DELETE to clear it
+func (server *statusServer) serveZoneTarget(w http.ResponseWriter,
+	r *http.Request) {
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/zones/"), "/")
+	if len(parts) != 2 || parts[1] != "target" {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := parts[0]
+	if !server.Config().HasZone(name) {
+		http.Error(w, fmt.Sprintf("unknown zone: %s", name),
+			http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet && !server.authorizeControl(w, r) {
+		return
+	}
+
+	var target *PushedTarget
+	switch r.Method {
+	case http.MethodGet:
+		if value, ok := server.pushed.Get(name); ok {
+			target = &value
+		}
+
+	case http.MethodPost:
+		rpm, err := strconv.Atoi(r.FormValue("rpm"))
+		controller := controller.GridFanController{}
+		if err != nil || !controller.IsValidRPM(rpm) {
+			http.Error(w, fmt.Sprintf("bad rpm: %s", r.FormValue("rpm")),
+				http.StatusBadRequest)
+			return
+		}
+		timeout := time.Duration(server.Config().PushTimeout) * time.Second
+		pushed := server.pushTarget(name, rpm, timeout)
+		target = &pushed
+
+	case http.MethodDelete:
+		server.clearTarget(name)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(target); err != nil {
+		log.Printf("ERROR failed to write target: %v", err)
+	}
+}
+
+// Apply preset of name, for its ttl, or else override_ttl. Returns false if
+// there is no such preset.
+func (server *statusServer) applyPreset(name string) (*Override, bool) {
+	preset, ok := server.Config().Presets[name]
+	if !ok {
+		return nil, false
+	}
+	if preset.TTL == 0 {
+		preset.TTL = server.Config().OverrideTTL
+	}
+
+	override := newOverride(name, preset)
+	server.debounce("preset", func() {
+		log.Printf("INFO applying preset: %s", name)
+		server.overrides.Set(override)
+		server.saveState()
+
+		// Preempt a batch of changes in progress
+		if !server.Config().SensorOnly {
+			for _, fan := range override.Apply([]FanStatus{}) {
+				server.queue.Push(fan, Change{Time: time.Now(), Fan: fan.Fan,
+					To: fan.RPM, Reason: fan.Reason}, priorityEmergency)
+			}
+		}
+	})
+
+	return override, true
+}
+
+// Clear preset override, if any
+func (server *statusServer) clearPreset() {
+	server.debounce("preset", func() {
+		log.Printf("INFO clearing preset")
+		server.overrides.Clear()
+		server.saveState()
+	})
+}
+
+// Push target rpm of zone, for timeout, coalesced by override_debounce, and
+// saved to the state file
+func (server *statusServer) pushTarget(name string, rpm int,
+	timeout time.Duration) PushedTarget {
+
+	target := PushedTarget{RPM: rpm, Until: time.Now().Add(timeout)}
+	server.debounce("zone "+name+" target", func() {
+		server.pushed.Set(name, rpm, timeout)
+		server.saveState()
+	})
+	return target
+}
+
+// Clear pushed target of zone, if any
+func (server *statusServer) clearTarget(name string) {
+	server.debounce("zone "+name+" target", func() {
+		server.pushed.Clear(name)
+		server.saveState()
+	})
+}
+
+// Serve effective config as yaml
+func (server *statusServer) serveConfig(w http.ResponseWriter, r *http.Request) {
+	contents, err := server.Config().Dump()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	if _, err := w.Write(contents); err != nil {
+		log.Printf("ERROR failed to write config: %v", err)
+	}
+}
+
+// Serve status in Prometheus text format
+func (server *statusServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	status := server.Get()
+
+	// OpenMetrics, for exemplars, if the scraper accepts it
+	openMetrics := strings.Contains(r.Header.Get("Accept"),
+		"application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type",
+			"application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+
+	metricUptime.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricUptime.Name,
+		int(time.Since(server.started).Seconds()))
+
+	metricBuildInfo.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s{version=%q,commit=%q,goversion=%q} 1\n",
+		metricBuildInfo.Name, version.Version, version.Commit,
+		runtime.Version())
+
+	metricConfigInfo.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s{path=%q,sha256=%q,profile=%q} 1\n",
+		metricConfigInfo.Name, server.Config().Path, server.Config().SHA256,
+		server.Config().Profile)
+
+	if !server.Config().Loaded.IsZero() {
+		metricConfigLoaded.writeHeader(w, openMetrics)
+		fmt.Fprintf(w, "%s %d\n", metricConfigLoaded.Name,
+			server.Config().Loaded.Unix())
+	}
+
+	metricState.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricState.Name, stateValues[status.State])
+
+	metricZoneRunaway.writeHeader(w, openMetrics)
+	for _, zone := range status.Zones {
+		runaway := 0
+		if zone.ThermalRunaway {
+			runaway = 1
+		}
+		fmt.Fprintf(w, "%s{zone=%q} %d\n", metricZoneRunaway.Name,
+			zone.Name, runaway)
+	}
+
+	pointHeader := false
+	for _, zone := range status.Zones {
+		if zone.Point == nil {
+			continue
+		}
+		if !pointHeader {
+			metricZonePoint.writeHeader(w, openMetrics)
+			pointHeader = true
+		}
+		fmt.Fprintf(w, "%s{zone=%q} %d\n", metricZonePoint.Name, zone.Name,
+			*zone.Point)
+	}
+
+	if len(status.Disks) != 0 {
+		metricDiskPowerState.writeHeader(w, openMetrics)
+		disks := []string{}
+		for disk := range status.Disks {
+			disks = append(disks, disk)
+		}
+		sort.Strings(disks)
+		for _, disk := range disks {
+			fmt.Fprintf(w, "%s{disk=%q} %d\n", metricDiskPowerState.Name,
+				disk, int(status.Disks[disk]))
+		}
+	}
+
+	metricDiskStatus.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricDiskStatus.Name, int(status.DiskStatus))
+
+	if status.Temperature != nil {
+		metricDiskTemperature.writeHeader(w, openMetrics)
+		fmt.Fprintf(w, "%s %d\n", metricDiskTemperature.Name,
+			*status.Temperature)
+	}
+
+	metricTargetRPM.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricTargetRPM.Name, status.TargetRPM)
+
+	speedHeader := false
+	for _, fan := range status.Fans {
+		if fan.Speed == nil {
+			continue
+		}
+		if !speedHeader {
+			metricFanSpeed.writeHeader(w, openMetrics)
+			speedHeader = true
+		}
+		fmt.Fprintf(w, "%s{fan=\"%d\"} %d\n", metricFanSpeed.Name, fan.Fan,
+			*fan.Speed)
+	}
+
+	if len(status.Wakeups) != 0 {
+		metricDiskWakeups.writeHeader(w, openMetrics)
+		disks := []string{}
+		for disk := range status.Wakeups {
+			disks = append(disks, disk)
+		}
+		sort.Strings(disks)
+		for _, disk := range disks {
+			fmt.Fprintf(w, "%s{disk=%q} %d\n", metricDiskWakeups.Name, disk,
+				status.Wakeups[disk])
+		}
+	}
+
+	if len(status.DutySeconds) != 0 {
+		metricFanDutySeconds.writeHeader(w, openMetrics)
+		fans := []int{}
+		for fan := range status.DutySeconds {
+			fans = append(fans, fan)
+		}
+		sort.Ints(fans)
+		for _, fan := range fans {
+			for _, label := range dutyRanges {
+				fmt.Fprintf(w, "%s{fan=\"%d\",duty=%q} %g\n",
+					metricFanDutySeconds.Name, fan, label,
+					status.DutySeconds[fan][label])
+			}
+		}
+	}
+
+	totals, last := server.changes.Totals()
+	if len(totals) != 0 {
+		fans := []int{}
+		for fan := range totals {
+			fans = append(fans, fan)
+		}
+		sort.Ints(fans)
+
+		metricFanChanges.writeHeader(w, openMetrics)
+		for _, fan := range fans {
+			fmt.Fprintf(w, "%s{fan=\"%d\"} %d", metricFanChanges.Name, fan,
+				totals[fan])
+			if change := last[fan]; openMetrics && change.Temperature != nil {
+				fmt.Fprintf(w, " # {zone=%q,temperature=\"%d\"} %d %.3f",
+					change.Zone, *change.Temperature, change.To,
+					float64(change.Time.UnixNano())/1e9)
+			}
+			fmt.Fprintf(w, "\n")
+		}
+
+		temperatureHeader := false
+		for _, fan := range fans {
+			change := last[fan]
+			if change.Temperature == nil {
+				continue
+			}
+			if !temperatureHeader {
+				metricFanChangeTemperature.writeHeader(w, openMetrics)
+				temperatureHeader = true
+			}
+			fmt.Fprintf(w, "%s{fan=\"%d\",zone=%q} %d\n",
+				metricFanChangeTemperature.Name, fan, change.Zone,
+				*change.Temperature)
+		}
+	}
+
+	runs := commandRuns()
+	if len(runs) != 0 {
+		metricCommands.writeHeader(w, openMetrics)
+		for _, name := range runNames(runs) {
+			fmt.Fprintf(w, "%s{command=%q} %d\n", metricCommands.Name, name,
+				runs[name])
+		}
+	}
+
+	metricCycleCommands.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricCycleCommands.Name, status.CycleCommands)
+
+	// Process stats are only read on Linux
+	if process, err := readProcessStats(); err == nil {
+		metricProcessCPU.writeHeader(w, openMetrics)
+		fmt.Fprintf(w, "%s %g\n", metricProcessCPU.Name, process.CPUSeconds)
+		metricProcessResident.writeHeader(w, openMetrics)
+		fmt.Fprintf(w, "%s %d\n", metricProcessResident.Name,
+			process.ResidentBytes)
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	metricGoroutines.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricGoroutines.Name, runtime.NumGoroutine())
+	metricHeapBytes.writeHeader(w, openMetrics)
+	fmt.Fprintf(w, "%s %d\n", metricHeapBytes.Name, memStats.HeapAlloc)
+
+	if openMetrics {
+		fmt.Fprintf(w, "# EOF\n")
+	}
+}
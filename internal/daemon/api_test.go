@@ -0,0 +1,117 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"github.com/cybojanek/gridfan/internal/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Config file with two profiles, of different curve fans
+const profilesConfig = `serial_device_path: tcp://127.0.0.1:1
+disk_curve:
+  points: [{temp: 30, rpm: 40}, {temp: 50, rpm: 100}]
+profiles:
+  - name: attic
+    curve_fans: [1]
+  - name: closet
+    curve_fans: [2]
+`
+
+func TestServeProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gridfan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gridfan.yaml")
+	if err := ioutil.WriteFile(path, []byte(profilesConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.ReadProfile(path, "attic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		control bool
+		code    int
+		profile string
+		fans    []int
+	}{
+		{"get", http.MethodGet, "/profile", false, http.StatusOK, "attic",
+			[]int{1}},
+		{"no header", http.MethodPost, "/profile?name=closet", false,
+			http.StatusForbidden, "attic", []int{1}},
+		{"unknown", http.MethodPost, "/profile?name=garage", true,
+			http.StatusBadRequest, "attic", []int{1}},
+		{"switch", http.MethodPost, "/profile?name=closet", true,
+			http.StatusOK, "closet", []int{2}},
+		{"method", http.MethodDelete, "/profile", true,
+			http.StatusMethodNotAllowed, "attic", []int{1}},
+	}
+
+	for _, test := range tests {
+		server := &statusServer{}
+		server.SetConfig(cfg)
+
+		request := httptest.NewRequest(test.method, test.target, nil)
+		request.RemoteAddr = "127.0.0.1:4242"
+		if test.control {
+			request.Header.Set(controlHeader, "1")
+		}
+		recorder := httptest.NewRecorder()
+		server.serveProfile(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: code = %d, expected %d", test.name, recorder.Code,
+				test.code)
+			continue
+		}
+		if recorder.Code == http.StatusOK {
+			status := ConfigStatus{}
+			if err := json.Unmarshal(recorder.Body.Bytes(),
+				&status); err != nil {
+				t.Errorf("%s: bad reply: %v", test.name, err)
+			} else if status.Profile != test.profile {
+				t.Errorf("%s: reply profile = %s, expected %s", test.name,
+					status.Profile, test.profile)
+			}
+		}
+
+		current := server.Config()
+		if current.Profile != test.profile {
+			t.Errorf("%s: profile = %s, expected %s", test.name,
+				current.Profile, test.profile)
+		}
+		if len(current.CurveFans) != len(test.fans) ||
+			current.CurveFans[0] != test.fans[0] {
+			t.Errorf("%s: curve fans = %v, expected %v", test.name,
+				current.CurveFans, test.fans)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"sync"
+)
+
+// Number of fan speed changes kept
+const changeLogSize = 100
+
+// changeLog of the last changeLogSize fan speed changes, and of the number
+// of changes and the last change of each fan since start
+type changeLog struct {
+	mutex   sync.Mutex
+	changes []Change
+	totals  map[int]int
+	last    map[int]Change
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Add change, dropping the oldest change if full
+func (changes *changeLog) Add(change Change) {
+	changes.mutex.Lock()
+	defer changes.mutex.Unlock()
+
+	if len(changes.changes) == changeLogSize {
+		changes.changes = append(changes.changes[:0], changes.changes[1:]...)
+	}
+	changes.changes = append(changes.changes, change)
+
+	if changes.totals == nil {
+		changes.totals = map[int]int{}
+		changes.last = map[int]Change{}
+	}
+	changes.totals[change.Fan]++
+	changes.last[change.Fan] = change
+}
+
+// Get copy of changes, from oldest to newest
+func (changes *changeLog) Get() []Change {
+	changes.mutex.Lock()
+	defer changes.mutex.Unlock()
+	return append([]Change{}, changes.changes...)
+}
+
+// Totals of changes by fan, and the last change of each fan
+func (changes *changeLog) Totals() (map[int]int, map[int]Change) {
+	changes.mutex.Lock()
+	defer changes.mutex.Unlock()
+
+	totals := map[int]int{}
+	last := map[int]Change{}
+	for fan, total := range changes.totals {
+		totals[fan] = total
+		last[fan] = changes.last[fan]
+	}
+	return totals, last
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Get curve input temperature of each zone, or its temperature without input
+func zoneTemperatures(zones []ZoneStatus) map[string]*int {
+	temperatures := map[string]*int{}
+	for _, zone := range zones {
+		if zone.Input != nil {
+			temperatures[zone.Name] = zone.Input
+		} else {
+			temperatures[zone.Name] = zone.Temperature
+		}
+	}
+	return temperatures
+}
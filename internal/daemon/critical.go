@@ -0,0 +1,149 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Critical actions which only log, and which shut down the host
+const (
+	criticalNone     = config.CriticalNone
+	criticalShutdown = config.CriticalShutdown
+)
+
+// Command to shut down the host, for the shutdown critical action
+var shutdownCommand = []string{"shutdown", "-h", "now"}
+
+// criticalZones of zones with a critical temperature, and since when each is
+// at or above it
+type criticalZones struct {
+	action   string
+	command  []string
+	duration time.Duration
+	temps    map[string]int
+	since    map[string]time.Time
+	acted    map[string]bool
+}
+
+// Create critical zones of config
+func newCriticalZones(config config.Config) *criticalZones {
+	temps := map[string]int{}
+	if config.DiskCurve.CriticalTemp != 0 {
+		temps[disksZone] = config.DiskCurve.CriticalTemp
+	}
+	for _, zone := range config.Zones {
+		if zone.CriticalTemp != 0 {
+			temps[zone.Name] = zone.CriticalTemp
+		}
+	}
+
+	command := config.CriticalCommand
+	if config.CriticalAction == criticalShutdown {
+		command = shutdownCommand
+	}
+
+	return &criticalZones{
+		action:   config.CriticalAction,
+		command:  command,
+		duration: time.Duration(config.CriticalDuration) * time.Second,
+		temps:    temps,
+		since:    map[string]time.Time{},
+		acted:    map[string]bool{},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Resume since when zones of previous critical zones are critical, and whether
+// their action ran, for zones which still have a critical temperature, so that
+// a reload does not restart the critical duration
+func (critical *criticalZones) Resume(previous *criticalZones) {
+	for zone := range critical.temps {
+		if since, ok := previous.since[zone]; ok {
+			critical.since[zone] = since
+		}
+		if previous.acted[zone] {
+			critical.acted[zone] = true
+		}
+	}
+}
+
+// Evaluate zone temperature at now. Once the zone has been at or above its
+// critical temperature for the critical duration, runs the critical action,
+// once until the temperature drops below it again. Returns since when the
+// zone is critical, or nil.
+func (critical *criticalZones) Evaluate(zone ZoneStatus, now time.Time,
+	events *eventLog) *time.Time {
+
+	temp, ok := critical.temps[zone.Name]
+	if !ok || zone.Temperature == nil || *zone.Temperature < temp {
+		if _, ok := critical.since[zone.Name]; ok {
+			log.Printf("INFO zone %s below critical temperature: %d",
+				zone.Name, temp)
+		}
+		delete(critical.since, zone.Name)
+		delete(critical.acted, zone.Name)
+		return nil
+	}
+
+	since, ok := critical.since[zone.Name]
+	if !ok {
+		log.Printf("WARNING zone %s at critical temperature: %d >= %d",
+			zone.Name, *zone.Temperature, temp)
+		since = now
+		critical.since[zone.Name] = since
+	}
+
+	if now.Sub(since) >= critical.duration && !critical.acted[zone.Name] {
+		critical.acted[zone.Name] = true
+		critical.act(zone.Name, *zone.Temperature, events)
+	}
+
+	return &since
+}
+
+// Run critical action of zone
+func (critical *criticalZones) act(zone string, temperature int,
+	events *eventLog) {
+
+	log.Printf("ERROR zone %s critical for %v at %d°C, action: %s", zone,
+		critical.duration, temperature, critical.action)
+	events.Write(Event{Type: EventCritical, Zone: zone,
+		Message: fmt.Sprintf("%s at %d°C", critical.action, temperature)})
+
+	if critical.action == criticalNone {
+		return
+	}
+
+	countCommand("critical")
+	command := exec.Command(critical.command[0], critical.command[1:]...)
+	command.Env = append(os.Environ(),
+		"GRIDFAN_ZONE="+zone,
+		fmt.Sprintf("GRIDFAN_TEMPERATURE=%d", temperature))
+	go func() {
+		if output, err := command.CombinedOutput(); err != nil {
+			log.Printf("ERROR critical %s failed: %v: %s", critical.action,
+				err, output)
+		}
+	}()
+}
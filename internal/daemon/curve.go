@@ -0,0 +1,751 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/disk"
+	"github.com/cybojanek/gridfan/internal/sensor"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diskCurve computes the curve fan rpm from disk status and temperature.
+type diskCurve struct {
+	config  config.Config
+	group   disk.Group
+	sensors map[string]sensor.Sensor
+
+	lastStatus   disk.Status
+	lastBehavior string
+	deadlineOff  time.Time
+	sleepSeen    bool
+	wokeUp       time.Time
+	trend        trend
+	stopped      bool
+	curveRPM     int
+	temperature  *int
+	input        *int
+	hottestDisk  string
+
+	// All disks removed, and the last target while they were not
+	removed    bool
+	lastTarget *decision
+
+	// Limits of disk temperatures
+	limits driveLimits
+
+	// Sensor temperatures read during the last Target
+	sensorTemperatures map[string]int
+
+	// Log of temperature lines
+	temperatureLog *temperatureLog
+
+	// Trace of decisions, if enabled
+	trace *decisionTrace
+}
+
+// Status detection of disk curves which only read temperatures
+const statusDetectionOff = config.StatusDetectionOff
+
+// Behaviors of disk curves when all disks are removed
+const (
+	removedHold     = config.RemovedHold
+	removedFailsafe = config.RemovedFailsafe
+)
+
+// Create disk curve for config, resuming the state of the previous disk
+// curve, if any. Disks of the previous curve are kept, unless their probes
+// changed, so that a reload does not probe them again.
+func newDiskCurve(config config.Config, previous *diskCurve) *diskCurve {
+	curve := &diskCurve{
+		config:  config,
+		sensors: map[string]sensor.Sensor{},
+
+		// Default is asleep in case of service restart. This means that if
+		// the cooldown did not finish, then the cooldown will be shortened,
+		// but we want that to avoid fan spinup on service restart.
+		lastStatus:   disk.DiskStatusSleep,
+		lastBehavior: config.DiskCurve.PowerStates["sleeping"],
+		deadlineOff:  time.Now(),
+		trend: trend{window: time.Duration(
+			config.DiskCurve.TrendBoost.Window) * time.Second},
+		temperatureLog: newTemperatureLog(config.LogTemperatureDelta),
+		limits: driveLimits{margin: config.DiskCurve.LimitMargin,
+			levels: map[string]string{}},
+	}
+
+	curve.group.Target = config.DiskCurve.DiskTarget
+	curve.group.TemperatureOnly = config.DiskCurve.StatusDetection ==
+		statusDetectionOff
+	curve.group.Stagger = time.Duration(config.DiskCurve.Stagger) *
+		time.Second
+	paths := []string{}
+	for _, diskConfig := range config.Disks {
+		paths = append(paths, diskConfig.Path)
+	}
+	duplicates := disk.Duplicates(paths)
+
+	for _, diskConfig := range config.Disks {
+		if first, ok := duplicates[diskConfig.Path]; ok {
+			log.Printf("WARNING disk %s is the same device as %s, merging",
+				diskConfig.Path, first)
+			continue
+		}
+
+		pollInterval := diskConfig.PollInterval
+		if pollInterval == 0 {
+			pollInterval = config.DiskCurve.PollInterval
+		}
+
+		if d := previous.keptDisk(config, diskConfig); d != nil {
+			d.Target = diskConfig.Target
+			d.PollInterval = time.Duration(pollInterval) * time.Second
+			d.StaleTTL = time.Duration(config.DiskCurve.StaleTTL) *
+				time.Second
+			curve.group.AddDisk(d)
+			continue
+		}
+
+		d := &disk.Disk{DevicePath: diskConfig.Path,
+			Target:       diskConfig.Target,
+			PollInterval: time.Duration(pollInterval) * time.Second,
+			StaleTTL: time.Duration(config.DiskCurve.StaleTTL) *
+				time.Second,
+			Bridge: diskConfig.Bridge,
+			Gentle: config.DiskCurve.Gentle}
+
+		backend, err := d.DetectBackend(config.TemperatureBackends)
+		if err != nil {
+			log.Printf("WARNING %v, using %s", err, disk.BackendHddtemp)
+			backend = disk.BackendHddtemp
+		}
+		log.Printf("INFO Disk %s temperature backend: %s", d.DevicePath,
+			backend)
+		d.Backend = backend
+
+		identity, err := d.Identify()
+		if err != nil {
+			log.Printf("WARNING %v", err)
+		} else {
+			log.Printf("INFO Disk %s: %v", d.DevicePath, identity)
+		}
+		d.Identity = identity
+
+		if diskConfig.MaxTemp != 0 {
+			d.Limits = disk.Limits{Max: diskConfig.MaxTemp,
+				Source: disk.LimitsConfig}
+		} else if config.DiskCurve.DriveLimits {
+			limits, err := d.ReadLimits()
+			if err != nil {
+				log.Printf("WARNING %v", err)
+			}
+			d.Limits = limits
+		}
+		if d.Limits.Max != 0 {
+			log.Printf("INFO Disk %s rated max: %d°C (%s), warning at: %d°C",
+				d.DevicePath, d.Limits.Max, d.Limits.Source,
+				d.Limits.Max-config.DiskCurve.LimitMargin)
+		}
+
+		curve.group.AddDisk(d)
+	}
+
+	curve.group.Interval = curve.PollInterval()
+
+	for name, sensorConfig := range config.Sensors {
+		curve.sensors[name] = newSensor(sensorConfig)
+	}
+
+	if previous != nil {
+		curve.resume(previous)
+	}
+
+	return curve
+}
+
+// Disk of the previous curve at the path of disk config, if its probes of
+// backend, identity and limits would not change with config. Returns nil
+// for a nil curve.
+func (curve *diskCurve) keptDisk(config config.Config,
+	diskConfig config.DiskConfig) *disk.Disk {
+
+	if curve == nil || config.DiskCurve.Gentle != curve.config.DiskCurve.Gentle ||
+		config.DiskCurve.DriveLimits != curve.config.DiskCurve.DriveLimits ||
+		!reflect.DeepEqual(config.TemperatureBackends,
+			curve.config.TemperatureBackends) {
+		return nil
+	}
+
+	for _, previous := range curve.config.Disks {
+		if previous.Path == diskConfig.Path &&
+			(previous.Bridge != diskConfig.Bridge ||
+				previous.MaxTemp != diskConfig.MaxTemp) {
+			return nil
+		}
+	}
+
+	for _, d := range curve.group.Disks {
+		if d.DevicePath == diskConfig.Path {
+			return d
+		}
+	}
+	return nil
+}
+
+// Resume the disk status, cooldown, trend, stop and wake state, the last
+// target while disks were present, and the limit levels of previous curve
+func (curve *diskCurve) resume(previous *diskCurve) {
+	curve.lastStatus = previous.lastStatus
+	curve.lastBehavior = previous.lastBehavior
+	curve.deadlineOff = previous.deadlineOff
+	curve.sleepSeen = previous.sleepSeen
+	curve.wokeUp = previous.wokeUp
+	curve.trend.samples = previous.trend.samples
+	curve.stopped = previous.stopped
+	curve.curveRPM = previous.curveRPM
+	curve.temperature = previous.temperature
+	curve.input = previous.input
+	curve.hottestDisk = previous.hottestDisk
+	curve.removed = previous.removed
+	curve.lastTarget = previous.lastTarget
+	curve.limits.levels = previous.limits.levels
+	curve.temperatureLog.Resume(previous.temperatureLog)
+}
+
+// PollInterval of the curve, which is the shortest disk poll interval
+func (curve *diskCurve) PollInterval() time.Duration {
+	pollInterval := time.Duration(curve.config.DiskCurve.PollInterval) *
+		time.Second
+	if groupInterval := curve.group.PollInterval(); groupInterval > 0 &&
+		groupInterval < pollInterval {
+		pollInterval = groupInterval
+	}
+	return pollInterval
+}
+
+// Wakeups of each disk, by device path
+func (curve *diskCurve) Wakeups() map[string]int {
+	wakeups := map[string]int{}
+	for _, disk := range curve.group.Disks {
+		wakeups[disk.DevicePath] = disk.Wakeups
+	}
+	return wakeups
+}
+
+// Limits of each disk with limits, by device path
+func (curve *diskCurve) DiskLimits() map[string]DiskLimit {
+	return curve.limits.Status(curve.group.Disks)
+}
+
+// Identities of each identified disk, by device path
+func (curve *diskCurve) Identities() map[string]disk.Identity {
+	identities := map[string]disk.Identity{}
+	for _, d := range curve.group.Disks {
+		if d.Identity != (disk.Identity{}) {
+			identities[d.DevicePath] = d.Identity
+		}
+	}
+	return identities
+}
+
+// failedSensor of a sensor config which failed to create a sensor
+type failedSensor struct {
+	err error
+}
+
+// GetTemperature fails with the create error
+func (sensor *failedSensor) GetTemperature() (int, error) {
+	return 0, sensor.err
+}
+
+// Statuses of each disk, by device path, if polled
+func (curve *diskCurve) DiskStatuses() map[string]disk.Status {
+	statuses := map[string]disk.Status{}
+	for _, disk := range curve.group.Disks {
+		if status, ok := disk.LastStatus(); ok {
+			statuses[disk.DevicePath] = status
+		}
+	}
+	return statuses
+}
+
+// Trace status of each disk, and behavior of the group status
+func (curve *diskCurve) traceDisks(status disk.Status, behavior string) {
+	if curve.trace == nil {
+		return
+	}
+
+	for _, disk := range curve.group.Disks {
+		diskStatus, _ := disk.LastStatus()
+		curve.trace.Printf("disk %s status %v", disk.DevicePath, diskStatus)
+	}
+	curve.trace.Printf("disks status %v, behavior %s", status, behavior)
+}
+
+// Trace disk and sensor temperatures, and the curve input aggregated from
+// them
+func (curve *diskCurve) traceInput(temp int, input int) {
+	if curve.trace == nil {
+		return
+	}
+
+	for _, disk := range curve.group.Disks {
+		temperature, read := disk.LastTemperature()
+		if read.IsZero() {
+			curve.trace.Printf("disk %s no temperature", disk.DevicePath)
+		} else {
+			curve.trace.Printf("disk %s %d°C from %v ago", disk.DevicePath,
+				temperature, time.Since(read).Round(time.Second))
+		}
+	}
+
+	names := []string{}
+	for name := range curve.sensorTemperatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		curve.trace.Printf("sensor %s %d°C", name,
+			curve.sensorTemperatures[name])
+	}
+
+	curve.trace.Printf("disks %d°C (%s), inputs %v, ambient %q, curve input %d°C",
+		temp, curve.hottestDisk, curve.config.DiskCurve.Inputs,
+		curve.config.DiskCurve.Ambient, input)
+}
+
+// Create sensor for config
+func newSensor(sensorConfig config.SensorConfig) sensor.Sensor {
+	created, err := sensor.New(sensorConfig.Type, sensorConfig.Options())
+	if err != nil {
+		log.Printf("ERROR failed to create sensor: %v", err)
+		return &failedSensor{err: fmt.Errorf("GetTemperature: %v", err)}
+	}
+	return created
+}
+
+// Curve input temperature, as the weighted average of disk temperature and
+// other sensors, relative to the ambient sensor if any. Without inputs or
+// ambient, this is just the disk temperature.
+func (curve *diskCurve) inputTemperature(diskTemperature int) (int, error) {
+	input, err := curve.weightedTemperature(&diskTemperature)
+	if err != nil {
+		return 0, err
+	}
+
+	return curve.ambientRelative(input)
+}
+
+// Curve input temperature of the other sensors alone, while the disk
+// temperature can't be read, or false without other sensor inputs
+func (curve *diskCurve) sensorInputTemperature() (int, bool, error) {
+	sensors := false
+	for _, input := range curve.config.DiskCurve.Inputs {
+		sensors = sensors || input.Sensor != config.DisksSensor
+	}
+	if !sensors {
+		return 0, false, nil
+	}
+
+	input, err := curve.weightedTemperature(nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	input, err = curve.ambientRelative(input)
+	return input, err == nil, err
+}
+
+// Input temperature relative to the ambient sensor, if any
+func (curve *diskCurve) ambientRelative(input int) (int, error) {
+	ambient := curve.config.DiskCurve.Ambient
+	if len(ambient) == 0 {
+		return input, nil
+	}
+
+	ambientTemperature, err := curve.sensors[ambient].GetTemperature()
+	if err != nil {
+		return 0, err
+	}
+	curve.temperatureLog.Printf(ambient, ambientTemperature,
+		"INFO Ambient %s temp: %d", ambient, ambientTemperature)
+	curve.sensorTemperatures[ambient] = ambientTemperature
+
+	return input - ambientTemperature, nil
+}
+
+// Weighted average of disk temperature and other sensors, leaving out the
+// disks if their temperature is nil
+func (curve *diskCurve) weightedTemperature(diskTemperature *int) (int, error) {
+	inputs := curve.config.DiskCurve.Inputs
+	if len(inputs) == 0 {
+		return *diskTemperature, nil
+	}
+
+	sum := 0.0
+	weights := 0.0
+	for _, input := range inputs {
+		temperature := 0
+		if input.Sensor == config.DisksSensor {
+			if diskTemperature == nil {
+				continue
+			}
+			temperature = *diskTemperature
+		} else {
+			value, err := curve.sensors[input.Sensor].GetTemperature()
+			if err != nil {
+				return 0, err
+			}
+			temperature = value
+			curve.temperatureLog.Printf(input.Sensor, temperature,
+				"INFO Sensor %s temp: %d", input.Sensor, temperature)
+			curve.sensorTemperatures[input.Sensor] = temperature
+		}
+
+		sum += input.Weight * float64(temperature)
+		weights += input.Weight
+	}
+
+	return int(math.Round(sum / weights)), nil
+}
+
+// decision of a fan rpm, and the reason for it
+type decision struct {
+	RPM    int
+	Reason string
+
+	// Percent of the range of each fan, for curves of relative points. RPM is
+	// then the percent of the default range of 20 to 100.
+	Percent *int
+
+	// Progress through the cooldown of sleeping disks, in [0, 1], for fan
+	// groups with a cooldown of their own
+	Cooldown *float64
+
+	// Failsafe raise of fans, on an error or the panic temperature, which is
+	// neither eased nor overridden. Failed if it was on an error.
+	Failsafe bool
+	Failed   bool
+}
+
+// Decision of curve rpm, which is a percent of the range of each fan if
+// relative
+func relativeDecision(rpm int, relative bool, reason string) decision {
+	if !relative {
+		return decision{RPM: rpm, Reason: reason}
+	}
+	return decision{RPM: config.Resolve(rpm, 20, 100), Reason: reason,
+		Percent: &rpm}
+}
+
+// RPM of decision for fan, resolving relative decisions to the range of fan
+func (target decision) FanRPM(config config.Config, fan int) int {
+	if target.Percent == nil {
+		return target.RPM
+	}
+	min, max := config.FanRange(fan)
+	return resolvePercent(*target.Percent, min, max)
+}
+
+// Decision of full speed as a failsafe on an error
+func failedDecision(reason string) decision {
+	return decision{RPM: 100, Reason: reason, Failsafe: true, Failed: true}
+}
+
+// Resolve percent of a relative curve to rpm in a range
+var resolvePercent = config.Resolve
+
+// Raise target of sleeping or standby disks to the curve on the other sensor
+// inputs, which can still be read, unlike the disk temperature
+func (curve *diskCurve) raiseToSensors(target decision) decision {
+	input, ok, err := curve.sensorInputTemperature()
+	if err != nil {
+		log.Printf("ERROR: Failed to check sensor temperature: %v", err)
+		return failedDecision("error: failed to check sensor temperature")
+	} else if !ok {
+		return target
+	}
+	curve.input = &input
+
+	curveConfig := curve.config.DiskCurve.Curve
+	rpm := curveConfig.Evaluate(input)
+	curve.trace.Printf("zone %s curve %s on sensors, rpm %s", disksZone,
+		curveSegment(curveConfig, input),
+		config.FormatRPM(rpm, curveConfig.Relative()))
+
+	sensorTarget := relativeDecision(rpm, curveConfig.Relative(),
+		fmt.Sprintf("%s, curve input %d°C", target.Reason, input))
+	if sensorTarget.RPM <= target.RPM {
+		return target
+	}
+	log.Printf("INFO Sensor curve input %d above %s, setting RPM to: %d",
+		input, target.Reason, sensorTarget.RPM)
+	return sensorTarget
+}
+
+// Stop target below curve floor of input, until above start temperature
+func (curve *diskCurve) stopBelow(input int, target decision) decision {
+	stopBelow := curve.config.DiskCurve.StopBelowTemp
+	startAbove := curve.config.DiskCurve.StartAboveTemp
+	if stopBelow == 0 {
+		return target
+	}
+
+	if input < stopBelow || (curve.stopped && input < startAbove) {
+		curve.stopped = true
+		target.RPM = 0
+		target.Percent = nil
+		target.Reason = fmt.Sprintf("stopped below %d°C until %d°C",
+			stopBelow, startAbove)
+	} else {
+		curve.stopped = false
+	}
+	return target
+}
+
+// Target rpm of curve fans for the current disk status and temperature
+func (curve *diskCurve) Target() decision {
+	// Default is 100 in case of errors
+	target := failedDecision("error")
+	curve.temperature = nil
+	curve.input = nil
+	curve.hottestDisk = ""
+	curve.sensorTemperatures = map[string]int{}
+
+	// All disks removed, such as when their enclosure is powered off
+	removed := curve.group.Removed()
+	if removed != curve.removed {
+		if removed {
+			log.Printf("WARNING all disks removed, %s",
+				curve.config.DiskCurve.OnRemoved)
+		} else {
+			log.Printf("INFO disks are back")
+		}
+		curve.removed = removed
+	}
+	onRemoved := curve.config.DiskCurve.OnRemoved
+	if removed && (onRemoved == removedFailsafe ||
+		(onRemoved == removedHold && curve.lastTarget == nil)) {
+		return failedDecision("error: all disks removed")
+	} else if removed && onRemoved == removedHold {
+		target = *curve.lastTarget
+		target.Failsafe = false
+		target.Reason = fmt.Sprintf("disks removed, holding (%s)",
+			target.Reason)
+		return target
+	}
+
+	// Get disk status, or sleep if removed
+	status := disk.DiskStatusSleep
+	behavior := config.BehaviorSleep
+	if !removed {
+		var statusErr error
+		status, statusErr = curve.group.GetStatus()
+		if statusErr != nil {
+			log.Printf("ERROR failed to check disk status: %v", statusErr)
+			return failedDecision("error: failed to check disk status")
+		}
+
+		// Behavior for power state
+		behavior = curve.config.DiskCurve.PowerStates[strings.ToLower(
+			status.String())]
+	}
+	curve.traceDisks(status, behavior)
+
+	// Disks woke up, unless the daemon just started
+	if behavior == config.BehaviorCurve &&
+		curve.lastBehavior != config.BehaviorCurve && curve.sleepSeen {
+		curve.wokeUp = time.Now()
+		log.Printf("INFO Disks woke up")
+	}
+	if behavior != config.BehaviorCurve {
+		curve.sleepSeen = true
+	}
+
+	switch behavior {
+
+	case config.BehaviorSleep:
+		// Disks are turned off - turn off fans after a cooldown period
+		cooldown := time.Duration(curve.config.DiskCurve.CooldownTimeout) *
+			time.Second
+		if curve.lastBehavior != config.BehaviorSleep {
+			curve.deadlineOff = time.Now().Add(cooldown)
+			log.Printf("INFO Disks just fell asleep, turning off in: %v",
+				cooldown)
+		}
+
+		remaining := time.Until(curve.deadlineOff)
+		if remaining <= 0 {
+			target = decision{RPM: curve.config.DiskCurve.RPM.Sleeping,
+				Reason: "disks sleeping"}
+			log.Printf("INFO Disk status is asleep, cooldown finished, setting RPM to: %d",
+				target.RPM)
+		} else {
+			// Decay along the cooldown steps, from the first one
+			progress := 1 - remaining.Seconds()/cooldown.Seconds()
+			target = decision{
+				RPM: curve.config.DiskCurve.RPM.Cooldown.At(progress),
+				Reason: fmt.Sprintf("disks sleeping, cooldown until %s",
+					curve.deadlineOff.Format("15:04:05")),
+				Cooldown: &progress}
+			log.Printf("INFO Disk status is asleep, cooldown over in: %v, setting RPM to: %d",
+				remaining, target.RPM)
+		}
+		target = curve.raiseToSensors(target)
+
+	case config.BehaviorStandby:
+		// Disks are neither fully turned off, and neither active
+		// Can't read temperature in this state
+		target = decision{RPM: curve.config.DiskCurve.RPM.Standby,
+			Reason: fmt.Sprintf("disks %s", strings.ToLower(status.String()))}
+		log.Printf("INFO Disk status is %v, setting RPM to: %d", status,
+			target.RPM)
+		target = curve.raiseToSensors(target)
+
+	case config.BehaviorCurve:
+		// Disks are active - check temperature curve
+		if temp, hottest, tempErr := curve.group.GetTemperature(); tempErr != nil {
+			log.Printf("ERROR: Failed to check temperature: %v", tempErr)
+			target = failedDecision("error: failed to check temperature")
+		} else if input, inputErr := curve.inputTemperature(temp); inputErr != nil {
+			log.Printf("ERROR: Failed to check sensor temperature: %v", inputErr)
+			target = failedDecision("error: failed to check sensor temperature")
+		} else {
+			for _, disk := range curve.group.Disks {
+				if age, err := disk.StaleTemperature(); err != nil {
+					log.Printf("WARNING using temperature of disk %s from %v ago: %v",
+						disk.DevicePath, age.Round(time.Second), err)
+				}
+			}
+			if hottest != nil {
+				curve.hottestDisk = hottest.DevicePath
+			}
+
+			// Report, and check limits on, the hottest actual temperature,
+			// while the curve runs on the one normalized by disk targets
+			raw := curve.group.RawTemperature()
+			curve.temperatureLog.Printf(disksZone, raw,
+				"INFO Temp: %d (%s), curve input: %d", raw,
+				curve.hottestDisk, input)
+			curve.temperature = &raw
+			curve.input = &input
+			curve.traceInput(temp, input)
+
+			// Curve lookup
+			curveConfig := curve.config.DiskCurve.Curve
+			rpm := curveConfig.EvaluateFrom(input, curve.curveRPM)
+			point, reached := curveConfig.Point(input)
+			switch {
+			case rpm != curveConfig.Evaluate(input):
+				target.Reason = fmt.Sprintf("curve hysteresis %d°C",
+					curveConfig.Hysteresis)
+			case !reached:
+				target.Reason = fmt.Sprintf("curve input %d°C below first point",
+					input)
+			case curveConfig.Interpolate:
+				target.Reason = fmt.Sprintf("curve interpolated %d°C→%s", input,
+					config.FormatRPM(rpm, curveConfig.Relative()))
+			default:
+				target.Reason = fmt.Sprintf("curve point %d°C→%s",
+					point.Temperature, point.RPMString())
+			}
+			curve.trace.Printf("zone %s curve %s, rpm %s", disksZone,
+				curveSegment(curveConfig, input),
+				config.FormatRPM(rpm, curveConfig.Relative()))
+			if plain := curveConfig.Evaluate(input); plain != rpm {
+				curve.trace.Printf("zone %s hysteresis holds %s instead of %s",
+					disksZone, config.FormatRPM(rpm, curveConfig.Relative()),
+					config.FormatRPM(plain, curveConfig.Relative()))
+			}
+			curve.curveRPM = rpm
+			target = relativeDecision(rpm, curveConfig.Relative(), target.Reason)
+
+			target = curve.stopBelow(input, target)
+
+			// Boost after disks woke up, when temperatures still lag
+			wakeBoost := time.Duration(curve.config.DiskCurve.WakeBoostTime) *
+				time.Second
+			if curve.config.DiskCurve.WakeBoostRPM != 0 &&
+				time.Since(curve.wokeUp) < wakeBoost &&
+				target.RPM < curve.config.DiskCurve.WakeBoostRPM {
+				target.RPM = curve.config.DiskCurve.WakeBoostRPM
+				target.Percent = nil
+				target.Reason = fmt.Sprintf("disks woke up, boost until %s",
+					curve.wokeUp.Add(wakeBoost).Format("15:04:05"))
+			}
+
+			curve.trend.Add(temp, time.Now())
+			boost := curve.config.DiskCurve.TrendBoost
+			if slope := curve.trend.Slope(); boost.Slope > 0 &&
+				slope >= boost.Slope && target.RPM < boost.RPM {
+				target.RPM = boost.RPM
+				target.Percent = nil
+				target.Reason = fmt.Sprintf("trend %.1f°C/min", slope)
+				log.Printf("INFO Temp rising %.1f/min, boosting RPM to: %d",
+					slope, target.RPM)
+			}
+
+			panicTemp := curve.config.DiskCurve.PanicTemp
+			if panicTemp != 0 && raw >= panicTemp {
+				target.RPM = 100
+				target.Percent = nil
+				target.Reason = fmt.Sprintf("panic temp %d°C", panicTemp)
+				target.Failsafe = true
+				log.Printf("INFO Temp %d reached panic temp %d, setting RPM to: %d",
+					raw, panicTemp, target.RPM)
+			}
+
+			if critical := curve.limits.Evaluate(
+				curve.group.Disks); critical != nil {
+				target.RPM = 100
+				target.Percent = nil
+				target.Reason = fmt.Sprintf("panic disk %s at rated max %d°C",
+					critical.DevicePath, critical.Limits.Max)
+				target.Failsafe = true
+			}
+		}
+
+	default:
+		log.Printf("ERROR bad status: %v", status)
+		target = failedDecision("error: bad disk status")
+
+	}
+
+	if behavior != config.BehaviorCurve {
+		curve.trend.Reset()
+		curve.stopped = false
+		curve.curveRPM = 0
+	}
+
+	curve.lastStatus = status
+	curve.lastBehavior = behavior
+
+	if removed {
+		target.Reason = "disks removed, " + target.Reason
+	} else if !target.Failed {
+		lastTarget := target
+		curve.lastTarget = &lastTarget
+	}
+
+	return target
+}
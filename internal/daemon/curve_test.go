@@ -0,0 +1,158 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/config"
+	"testing"
+	"time"
+)
+
+// Disk curve of config without disks, whose status is always asleep
+func sleepingCurve(cfg config.Config) *diskCurve {
+	cfg.DiskCurve.PowerStates = map[string]string{
+		"sleeping": config.BehaviorSleep}
+	return newDiskCurve(cfg, nil)
+}
+
+func TestCooldownDecay(t *testing.T) {
+	tests := []struct {
+		name     string
+		cooldown config.Decay
+		sleeping int
+
+		// Rpm with the remaining seconds of the cooldown
+		remaining []int
+		expected  []int
+	}{
+		{"steps", config.Decay{60, 50, 40}, 20,
+			[]int{60, 41, 39, 21, 19, 1, 0, -10},
+			[]int{60, 60, 50, 50, 40, 40, 20, 20}},
+		{"one rpm", config.Decay{70}, 0,
+			[]int{60, 30, 1, 0},
+			[]int{70, 70, 70, 0}},
+		{"no cooldown rpm", nil, 30,
+			[]int{60, 1, 0},
+			[]int{0, 0, 30}},
+	}
+
+	for _, test := range tests {
+		cfg := config.Config{}
+		cfg.DiskCurve.CooldownTimeout = 60
+		cfg.DiskCurve.RPM.Cooldown = test.cooldown
+		cfg.DiskCurve.RPM.Sleeping = test.sleeping
+		curve := sleepingCurve(cfg)
+
+		// Disks fall asleep, which starts the cooldown
+		curve.lastBehavior = config.BehaviorCurve
+		if target := curve.Target(); target.RPM != test.expected[0] ||
+			target.Cooldown == nil {
+			t.Errorf("%s: fell asleep = %+v, expected cooldown at %d",
+				test.name, target, test.expected[0])
+		}
+		remaining := time.Until(curve.deadlineOff)
+		if remaining <= 59*time.Second || remaining > time.Minute {
+			t.Errorf("%s: cooldown remaining = %v, expected 60s", test.name,
+				remaining)
+		}
+
+		for i, seconds := range test.remaining {
+			curve.deadlineOff = time.Now().Add(time.Duration(seconds) *
+				time.Second)
+			target := curve.Target()
+			if target.RPM != test.expected[i] {
+				t.Errorf("%s: %ds remaining rpm = %d, expected %d",
+					test.name, seconds, target.RPM, test.expected[i])
+			}
+			if cooling := seconds > 0; (target.Cooldown != nil) != cooling {
+				t.Errorf("%s: %ds remaining cooldown = %v, expected %v",
+					test.name, seconds, target.Cooldown, cooling)
+			}
+		}
+	}
+}
+
+// Daemon restarts resume asleep, with the cooldown done, so that the fans do
+// not spin up
+func TestCooldownRestart(t *testing.T) {
+	cfg := config.Config{}
+	cfg.DiskCurve.CooldownTimeout = 60
+	cfg.DiskCurve.RPM.Cooldown = config.Decay{60}
+	cfg.DiskCurve.RPM.Sleeping = 20
+	curve := sleepingCurve(cfg)
+
+	if target := curve.Target(); target.RPM != 20 || target.Cooldown != nil {
+		t.Errorf("restart = %+v, expected sleeping at 20", target)
+	}
+}
+
+func TestStopBelow(t *testing.T) {
+	tests := []struct {
+		name      string
+		stopBelow int
+		inputs    []int
+		expected  []int
+	}{
+		{"off", 0,
+			[]int{40, 20, 30},
+			[]int{50, 50, 50}},
+		{"hysteresis", 30,
+			[]int{40, 30, 29, 30, 34, 35, 31, 29, 40},
+			[]int{50, 50, 0, 0, 0, 50, 50, 0, 50}},
+		{"stopped at start", 30,
+			[]int{25, 32, 36},
+			[]int{0, 0, 50}},
+	}
+
+	for _, test := range tests {
+		cfg := config.Config{}
+		cfg.DiskCurve.StopBelowTemp = test.stopBelow
+		cfg.DiskCurve.StartAboveTemp = 35
+		curve := sleepingCurve(cfg)
+
+		for i, input := range test.inputs {
+			target := curve.stopBelow(input, decision{RPM: 50,
+				Reason: "curve"})
+			if target.RPM != test.expected[i] {
+				t.Errorf("%s: input %d rpm = %d, expected %d", test.name,
+					input, target.RPM, test.expected[i])
+			}
+			if stopped := test.expected[i] == 0; curve.stopped != stopped {
+				t.Errorf("%s: input %d stopped = %v, expected %v",
+					test.name, input, curve.stopped, stopped)
+			}
+		}
+	}
+}
+
+// Fans stopped below the curve floor start again once the disks sleep, so
+// that they wake up to the curve
+func TestStopBelowSleeping(t *testing.T) {
+	cfg := config.Config{}
+	cfg.DiskCurve.StopBelowTemp = 30
+	cfg.DiskCurve.StartAboveTemp = 35
+	curve := sleepingCurve(cfg)
+
+	curve.stopBelow(25, decision{RPM: 50})
+	curve.Target()
+	if curve.stopped {
+		t.Errorf("stopped after sleeping, expected started")
+	}
+	if target := curve.stopBelow(32, decision{RPM: 50}); target.RPM != 50 {
+		t.Errorf("woke up at 32 rpm = %d, expected 50", target.RPM)
+	}
+}
@@ -18,136 +18,1076 @@ limitations under the License.
 */
 
 import (
+	"fmt"
 	"github.com/cybojanek/gridfan/internal/config"
 	"github.com/cybojanek/gridfan/internal/controller"
 	"github.com/cybojanek/gridfan/internal/disk"
 	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-// Run indefinitely.
-func Run(config config.Config) {
-	// Create disk group
-	diskGroup := disk.Group{}
-	for _, devicePath := range config.Disks {
-		diskGroup.AddDisk(&disk.Disk{DevicePath: devicePath})
+// Daemon sets fan speeds in the background, until stopped.
+type Daemon struct {
+	onStatus func(Status)
+	trace    *decisionTrace
+
+	server *statusServer
+	mqtt   *mqttBridge
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Option of a Daemon
+type Option func(daemon *Daemon)
+
+// OnStatus calls callback with the status of every daemon cycle
+func OnStatus(callback func(Status)) Option {
+	return func(daemon *Daemon) {
+		daemon.onStatus = callback
+	}
+}
+
+// DebugDecisions logs the decisions of every daemon cycle, from sensor
+// readings to fan commands
+func DebugDecisions() Option {
+	return func(daemon *Daemon) {
+		daemon.trace = &decisionTrace{}
+	}
+}
+
+// New daemon for config
+func New(config config.Config, options ...Option) *Daemon {
+	daemon := &Daemon{
+		server: &statusServer{started: time.Now(),
+			events: eventLog{path: config.EventLog}},
+	}
+	daemon.server.SetConfig(config)
+
+	for _, option := range options {
+		option(daemon)
+	}
+
+	return daemon
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Start daemon in the background
+func (daemon *Daemon) Start() error {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+
+	if daemon.stop != nil {
+		return fmt.Errorf("Start: Daemon is already running")
+	}
+
+	config := daemon.server.Config()
+	for _, warning := range config.Lint() {
+		log.Printf("WARNING %s", warning)
+	}
+
+	disk.SetCommands(config.Commands, config.StrictCommands)
+
+	daemon.server.started = time.Now()
+	daemon.server.loadState()
+
+	// Serve status
+	if len(config.ListenAddress) != 0 {
+		daemon.server.Listen(config.ListenAddress)
+	}
+
+	// Bridge zones to Home Assistant
+	if len(config.MQTT.Broker) != 0 {
+		daemon.mqtt = startMQTTBridge(daemon.server)
+	}
+
+	daemon.stop = make(chan struct{})
+	daemon.done = make(chan struct{})
+	go func() {
+		defer close(daemon.done)
+		daemon.run()
+	}()
+
+	return nil
+}
+
+// Stop daemon, and wait for its current cycle to finish
+func (daemon *Daemon) Stop() {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+
+	if daemon.stop == nil {
+		return
+	}
+
+	close(daemon.stop)
+	<-daemon.done
+	daemon.server.Close()
+	if daemon.mqtt != nil {
+		daemon.mqtt.Stop()
+		daemon.mqtt = nil
+	}
+	daemon.server.events.Close()
+
+	daemon.stop = nil
+	daemon.done = nil
+}
+
+// Reload daemon with config, which the daemon loop switches to at its next
+// cycle. The listen address, event log and mqtt broker only change on
+// restart.
+func (daemon *Daemon) Reload(config config.Config) {
+	daemon.server.reload(config)
+}
+
+// Status of the last daemon cycle, shared with the status server, so it must
+// not be modified
+func (daemon *Daemon) Status() Status {
+	return daemon.server.Get()
+}
+
+// Sleep for duration, unless stopped first. Returns false if stopped.
+func (daemon *Daemon) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-daemon.stop:
+		return false
+	case <-timer.C:
+		return true
 	}
+}
 
-	// Get controller
-	controller := controller.GridFanController{DevicePath: config.DevicePath}
+////////////////////////////////////////////////////////////////////////////////
 
-	constantSet := false
+// Run indefinitely, reloading the config file on SIGHUP, with the current
+// profile, which may have been switched over the API. A config which fails
+// to read is logged, and the current one is kept.
+func Run(config config.Config, options ...Option) {
+	daemon := New(config, options...)
+	if err := daemon.Start(); err != nil {
+		log.Printf("ERROR failed to start daemon: %v", err)
+		return
+	}
 
-	// Default is asleep in case of service restart. This means that if the
-	// cooldown did not finish, then the cooldown will be shortened, but we
-	// want that to avoid fan spinup on service restart.
-	lastStatus := disk.DiskStatusSleep
-	deadlineOff := time.Now()
-	lastRPM := -1
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
 
 	for {
+		select {
+		case <-daemon.done:
+			return
+		case <-hangups:
+			current := daemon.server.Config()
+			reloaded, err := readConfig(current.Path, current.Profile)
+			if err != nil {
+				log.Printf("ERROR failed to reload config: %v", err)
+				continue
+			}
+			daemon.Reload(reloaded)
+		}
+	}
+}
+
+// Read config file, and its profile, for reloads
+var readConfig = config.ReadProfile
+
+// Run daemon loop until stopped
+func (daemon *Daemon) run() {
+	var loopController *controller.Chain
+	defer func() {
+		if err := recover(); err != nil {
+			parkFans(daemon.server.Config(), loopController, err)
+			panic(err)
+		}
+	}()
+
+	if !daemon.waitForController() {
+		return
+	}
+
+	schedule := daemon.server.Config().Schedule
+	if delay := startDelay(time.Duration(schedule.StartJitter) *
+		time.Second); delay > 0 {
+		log.Printf("INFO delaying start by: %v", delay.Round(time.Millisecond))
+		if !daemon.sleep(delay) {
+			return
+		}
+	}
+
+	config, generation := daemon.server.ConfigGeneration()
+	loop := newLoop(config, daemon.server, daemon.onStatus, daemon.trace, nil)
+	loop.generation = generation
+	loopController = loop.controller
+	for {
+		wait, _ := loop.cycle()
+		if phase := loop.config.Schedule.Phase; phase > 0 {
+			wait = phaseWait(time.Now(), wait,
+				time.Duration(phase)*time.Second)
+		}
+		if !daemon.sleep(wait) {
+			return
+		}
+
+		// Switch to a reloaded config, resuming the loop state, so that
+		// fans already at their speed are not set again, and cooldowns,
+		// thresholds and critical durations carry on
+		if config, generation := daemon.server.ConfigGeneration(); generation !=
+			loop.generation {
+			loop = loop.reload(config, generation)
+			loopController = loop.controller
+		}
+	}
+}
+
+// RunOnce runs a single daemon cycle, and returns its first error
+func (daemon *Daemon) RunOnce() error {
+	config := daemon.server.Config()
+	disk.SetCommands(config.Commands, config.StrictCommands)
+
+	var loopController *controller.Chain
+	defer func() {
+		if err := recover(); err != nil {
+			parkFans(daemon.server.Config(), loopController, err)
+			panic(err)
+		}
+	}()
+
+	daemon.waitForController()
+
+	loop := newLoop(daemon.server.Config(), daemon.server, daemon.onStatus,
+		daemon.trace, nil)
+	loopController = loop.controller
+	_, err := loop.cycle()
+	daemon.server.events.Close()
+	return err
+}
+
+// Park all fans at the failsafe rpm after a panic, so that a crash never
+// leaves fans stopped. The loop controller, if any, is closed first, since
+// the panic may have left it open.
+func parkFans(config config.Config, loopController *controller.Chain,
+	reason interface{}) {
+
+	log.Printf("ERROR daemon panic: %v", reason)
+	if config.SensorOnly {
+		return
+	}
+
+	if loopController != nil {
+		if err := loopController.Close(); err != nil {
+			log.Printf("ERROR failed to close controller: %v", err)
+		}
+	}
+
+	controller := config.Controller()
+	if err := controller.Open(); err != nil {
+		log.Printf("ERROR failed to open controller: %v", err)
+		return
+	}
+	defer controller.Close()
+
+	for _, fan := range fanStatuses(config, map[string]decision{}) {
+		log.Printf("INFO setting fan %d to: %d (panic)", fan.Fan,
+			config.FailsafeRPM)
+		if err := controller.SetSpeed(fan.Fan, config.FailsafeRPM); err != nil {
+			log.Printf("ERROR failed to set fan speed: %d, %d -> %v",
+				fan.Fan, config.FailsafeRPM, err)
+		}
+	}
+}
+
+// Wait for the controller to open, retrying open_retry times, since its
+// device may appear only after the daemon starts on boot. Returns false if
+// stopped.
+func (daemon *Daemon) waitForController() bool {
+	config := daemon.server.Config()
+	if config.SensorOnly || config.OpenRetry == 0 {
+		return true
+	}
+
+	controller := config.Controller()
+	interval := time.Duration(config.OpenRetryInterval) * time.Second
+	for attempt := 0; ; attempt++ {
+		err := controller.Open()
+		if err == nil {
+			if attempt != 0 {
+				log.Printf("INFO controller opened after %d retries", attempt)
+			}
+			if err := controller.Close(); err != nil {
+				log.Printf("ERROR failed to close controller: %v", err)
+			}
+			return true
+		}
+
+		if attempt == config.OpenRetry {
+			log.Printf("ERROR failed to open controller after %d retries: %v",
+				attempt, err)
+			return true
+		}
+		if attempt == 0 {
+			log.Printf("INFO waiting for controller, retrying %d times every %v: %v",
+				config.OpenRetry, interval, err)
+		}
+
+		if !daemon.sleep(interval) {
+			return false
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// loop state of the daemon between cycles
+type loop struct {
+	config   config.Config
+	server   *statusServer
+	onStatus func(Status)
+	trace    *decisionTrace
+
+	// Generation of the config, which changes on every reload
+	generation uint64
+
+	// Curve from disks, or leader
+	curve  *diskCurve
+	leader *follower
+
+	controller   *controller.Chain
+	pollInterval time.Duration
+
+	// Last rpm set for each fan
+	applied map[int]int
+	dither  *dither
+
+	// Time of each fan at each duty range
+	duties *dutyHistogram
+
+	// Commands around fan changes
+	hooks *speedHooks
+
+	// Fans to verify periodically, and fans with an external change, by
+	// the duty changed to, and the target they were adopted at
+	verifyInterval time.Duration
+	lastVerify     time.Time
+	verifyFans     []int
+	external       map[int]int
+	adopted        map[int]int
+
+	// Zones other than the disks zone
+	zones []*zoneCurve
+
+	// Ramps of zone targets, by zone name
+	ramps map[string]*ramp
+
+	// Thermal runaway and critical temperatures of all zones
+	runaway  *thermalRunaway
+	critical *criticalZones
+
+	// Thresholds of the disks zone
+	thresholds *zoneThresholds
+
+	// Fan speed readings
+	speedFilter controller.SpeedFilter
+
+	// Error of the last fan speed change, which failed to reach the
+	// controller, if any
+	controllerErr error
+
+	// Last disk status, override and disabled zones, for events
+	lastDiskStatus *disk.Status
+	lastOverride   string
+	lastDisabled   map[string]bool
+}
+
+// Create loop for config, resuming the state of the previous loop, if any.
+// Without a previous loop, or with a different controller, current fan
+// duties are read from the controller.
+func newLoop(config config.Config, server *statusServer,
+	onStatus func(Status), trace *decisionTrace, previous *loop) *loop {
+
+	loop := &loop{
+		config:       config,
+		server:       server,
+		onStatus:     onStatus,
+		trace:        trace,
+		controller:   config.Controller(),
+		pollInterval: time.Duration(config.DiskCurve.PollInterval) * time.Second,
+		applied:      map[int]int{},
+		dither: newDither(config.Dither.Percent,
+			time.Duration(config.Dither.Interval)*time.Second),
+		verifyInterval: time.Duration(config.ConstantVerifyInterval) *
+			time.Second,
+		lastVerify:   time.Now(),
+		verifyFans:   []int{},
+		external:     map[int]int{},
+		adopted:      map[int]int{},
+		duties:       newDutyHistogram(),
+		hooks:        newSpeedHooks(config),
+		lastDisabled: map[string]bool{},
+		zones:        newZoneCurves(config, trace),
+		ramps:        newRamps(config),
+		runaway:      newThermalRunaway(config),
+		critical:     newCriticalZones(config),
+		thresholds: newZoneThresholds(disksZone,
+			config.DiskCurve.Thresholds),
+	}
+
+	var previousCurve *diskCurve
+	if previous != nil {
+		previousCurve = previous.curve
+	}
+
+	if len(config.Follow) != 0 {
+		loop.leader = newFollower(config.Follow, config.APIToken)
+	} else {
+		loop.curve = newDiskCurve(config, previousCurve)
+		loop.curve.trace = trace
+		loop.curve.limits.events = &server.events
+		loop.pollInterval = loop.curve.PollInterval()
+	}
+
+	if previous != nil {
+		loop.resume(previous)
+	}
+
+	if !config.SensorOnly && (previous == nil ||
+		loop.controller != previous.controller) {
+		fans := []int{}
+		for _, fan := range fanStatuses(config, map[string]decision{}) {
+			fans = append(fans, fan.Fan)
+		}
+		loop.applied = readCurrentDuties(loop.controller, fans)
+	}
+
+	// Verify all fans, or only constant fans
+	if config.VerifyInterval > 0 && !config.SensorOnly {
+		loop.verifyInterval = time.Duration(config.VerifyInterval) *
+			time.Second
+		for _, fan := range fanStatuses(config, map[string]decision{}) {
+			loop.verifyFans = append(loop.verifyFans, fan.Fan)
+		}
+	} else {
+		for fan := range config.ConstantRPM {
+			loop.verifyFans = append(loop.verifyFans, fan)
+		}
+	}
+
+	return loop
+}
+
+// Reload loop with config of generation, as a new loop which resumes the
+// state of this loop
+func (loop *loop) reload(config config.Config, generation uint64) *loop {
+	reloaded := newLoop(config, loop.server, loop.onStatus, loop.trace, loop)
+	reloaded.generation = generation
+	return reloaded
+}
+
+// Resume state of previous loop: the controller and the applied fan rpms,
+// unless the controller config changed, fan speed readings and adopted
+// external changes, duty times, zone ramps, hysteresis, thresholds, thermal
+// runaway and critical zones, and the last states written as events. The
+// disk curve resumes its own state when it is created.
+func (loop *loop) resume(previous *loop) {
+	if reflect.DeepEqual(loop.config.Controller(),
+		previous.config.Controller()) {
+		loop.controller = previous.controller
+		loop.applied = previous.applied
+		loop.controllerErr = previous.controllerErr
+	}
+
+	loop.dither.Resume(previous.dither)
+	loop.lastVerify = previous.lastVerify
+	loop.external = previous.external
+	loop.adopted = previous.adopted
+	loop.duties = previous.duties
+	loop.speedFilter = previous.speedFilter
+	loop.lastDiskStatus = previous.lastDiskStatus
+	loop.lastOverride = previous.lastOverride
+	loop.lastDisabled = previous.lastDisabled
+
+	for name, ramp := range loop.ramps {
+		ramp.Resume(previous.ramps[name])
+	}
+	resumeZoneCurves(loop.zones, previous.zones)
+	loop.thresholds.Resume(previous.thresholds)
+	loop.runaway.Resume(previous.runaway)
+	loop.critical.Resume(previous.critical)
+}
+
+// Run one cycle, and write its error event, if any
+func (loop *loop) cycle() (time.Duration, error) {
+	if len(loop.config.SmartdDir) != 0 {
+		loop.readSmartdWarnings()
+	}
+	if len(loop.config.OverrideFile) != 0 {
+		loop.readOverrideFile()
+	}
+
+	wait, err := loop.setSpeeds()
+	if err != nil {
+		loop.server.events.Write(Event{Type: EventError, Message: err.Error()})
+	}
+	return wait, err
+}
+
+// Decide and set fan speeds. Returns how long to wait until the next cycle,
+// and the first error.
+func (loop *loop) setSpeeds() (time.Duration, error) {
+	config := loop.config
+	events := &loop.server.events
+	runs := totalRuns(commandRuns())
+	status := Status{SensorOnly: config.SensorOnly}
+
+	var target decision
+	zone := ZoneStatus{Name: disksZone}
+	var diskStatus disk.Status
+	if loop.leader != nil {
 		// Default is 100 in case of errors
-		targetRPM := 100
+		target = failedDecision("error: failed to follow leader")
 
-		// Get disk status
-		status, statusErr := diskGroup.GetStatus()
-		if statusErr != nil {
-			log.Printf("ERROR failed to check disk status: %v", statusErr)
+		leaderStatus, err := loop.leader.Get()
+		if err != nil {
+			log.Printf("ERROR failed to get leader status: %v", err)
+		} else if !loop.controller.IsValidRPM(leaderStatus.TargetRPM) {
+			log.Printf("ERROR bad leader target RPM: %d",
+				leaderStatus.TargetRPM)
 		} else {
-			switch status {
-
-			case disk.DiskStatusSleep:
-				// Disks are turned off - turn off fans after a cooldown period
-				if lastStatus == disk.DiskStatusSleep {
-					timeSince := time.Since(deadlineOff).Seconds()
-					if timeSince >= 0 {
-						targetRPM = config.DiskCurve.RPM.Sleeping
-						log.Printf("INFO Disk status is asleep, cooldown finished, setting RPM to: %d",
-							targetRPM)
-					} else {
-						targetRPM = config.DiskCurve.RPM.Cooldown
-						log.Printf("INFO Disk status is asleep, cooldown over in: %v, setting RPM to: %d",
-							-timeSince, targetRPM)
-					}
-				} else {
-					// Previous status was not asleep
-					deadlineOff := time.Until(time.Now().Add(time.Duration(
-						config.DiskCurve.CooldownTimeout) * time.Second))
-					targetRPM = config.DiskCurve.RPM.Sleeping
-					log.Printf("INFO Disks just fell asleep, turning off in: %v, setting RPM to: %d",
-						deadlineOff, targetRPM)
-				}
-
-			case disk.DiskStatusStandby:
-				// Disks are neither fully turned off, and neither active
-				// Can't read temperature in this state
-				targetRPM = config.DiskCurve.RPM.Standby
-				log.Printf("INFO Disk status is standby, setting RPM to: %d", targetRPM)
-
-			case disk.DiskStatusActive:
-				// Disks are active - check temperature curve
-				if temp, tempErr := diskGroup.GetTemperature(); tempErr != nil {
-					log.Printf("ERROR: Failed to check temperature: %v", tempErr)
-				} else {
-					log.Printf("INFO Temp: %d", temp)
-					for _, point := range config.DiskCurve.Points {
-						if temp >= point.Temperature {
-							targetRPM = point.RPM
-						}
-					}
-				}
-
-			default:
-				log.Printf("ERROR bad status: %d", status)
+			log.Printf("INFO Leader target RPM: %d", leaderStatus.TargetRPM)
+			diskStatus = leaderStatus.DiskStatus
+			zone.Temperature = leaderStatus.Temperature
+			zone.HottestDisk = leaderStatus.HottestDisk
+			target = decision{RPM: leaderStatus.TargetRPM,
+				Reason: "leader " + config.Follow}
+		}
+	} else {
+		curve := loop.curve
+		target = curve.Target()
+		diskStatus = curve.lastStatus
+		zone.Temperature = curve.temperature
+		zone.Input = curve.input
+		zone.HottestDisk = curve.hottestDisk
+		status.Sensors = sensorReadings(curve.sensorTemperatures)
+		status.Wakeups = curve.Wakeups()
+		status.Disks = curve.DiskStatuses()
+		status.Identities = curve.Identities()
+		status.DiskLimits = curve.DiskLimits()
+	}
+	target = loop.server.pushed.Apply(disksZone, target)
+	target = loop.thresholds.Evaluate(zone.Temperature, target, events)
+	target = loop.ramps[disksZone].Apply(target, time.Now())
+	loop.trace.Printf("zone %s target %d (%s)", disksZone, target.RPM,
+		target.Reason)
+	zone.Thresholds = loop.thresholds.Reached()
+	zone.TargetRPM = target.RPM
+	zone.Reason = target.Reason
+
+	zone.DiskStatus = &diskStatus
+	if loop.lastDiskStatus == nil || *loop.lastDiskStatus != diskStatus {
+		event := Event{Type: EventStatus, Zone: zone.Name,
+			To: strings.ToLower(diskStatus.String())}
+		if loop.lastDiskStatus != nil {
+			event.From = strings.ToLower(loop.lastDiskStatus.String())
+		}
+		events.Write(event)
+		lastDiskStatus := diskStatus
+		loop.lastDiskStatus = &lastDiskStatus
+	}
+
+	var cycleErr error
+	if target.Failed {
+		cycleErr = fmt.Errorf("cycle: Zone %s %s", zone.Name, target.Reason)
+	}
 
+	status.Time = time.Now()
+	status.Uptime = int(status.Time.Sub(loop.server.started).Seconds())
+	loop.duties.Add(loop.applied, status.Time)
+	status.DutySeconds = loop.duties.Get()
+	status.Config = configStatus(config)
+	if !config.SensorOnly {
+		status.Controllers = controllerStatuses(loop.controller)
+	}
+	status.DiskStatus = diskStatus
+	status.Temperature = zone.Temperature
+	status.HottestDisk = zone.HottestDisk
+	status.TargetRPM = zone.TargetRPM
+	status.Zones = []ZoneStatus{zone}
+
+	// Other zones, in order of evaluation
+	targets := map[string]decision{disksZone: target}
+	for _, zoneCurve := range loop.zones {
+		zoneStatus, zoneTarget := zoneCurve.Target(zone.Temperature, targets)
+		zoneTarget = loop.server.pushed.Apply(zoneStatus.Name, zoneTarget)
+		zoneTarget = loop.ramps[zoneStatus.Name].Apply(zoneTarget, time.Now())
+		loop.trace.Printf("zone %s target %d (%s)", zoneStatus.Name,
+			zoneTarget.RPM, zoneTarget.Reason)
+		zoneStatus.TargetRPM = zoneTarget.RPM
+		zoneStatus.Reason = zoneTarget.Reason
+		targets[zoneStatus.Name] = zoneTarget
+		status.Zones = append(status.Zones, zoneStatus)
+		status.Sensors = zoneCurve.AddReading(status.Sensors, zoneStatus)
+
+		if zoneTarget.Failed && cycleErr == nil {
+			cycleErr = fmt.Errorf("cycle: Zone %s %s", zoneStatus.Name,
+				zoneTarget.Reason)
+		}
+	}
+
+	// Curve point of each zone
+	for i := range status.Zones {
+		status.Zones[i].Point = zonePoint(config, status.Zones[i])
+	}
+
+	// Thermal runaway of each zone, at the rpms of the last cycle, and
+	// critical temperatures
+	for i := range status.Zones {
+		status.Zones[i].ThermalRunaway = loop.runaway.Evaluate(
+			status.Zones[i], loop.applied, events)
+		status.Zones[i].CriticalSince = loop.critical.Evaluate(
+			status.Zones[i], status.Time, events)
+	}
+
+	// Failsafe on zone errors, and controller lost on the last failure
+	zoneState := StateOK
+	if cycleErr != nil {
+		zoneState = StateFailsafe
+	}
+	status.State = zoneState
+	if loop.controllerErr != nil {
+		status.State = StateControllerLost
+		status.ControllerError = loop.controllerErr.Error()
+	}
+
+	// Zones disabled at runtime
+	disabled := loop.server.disabled.Get()
+	for i := range status.Zones {
+		if until, ok := disabled[status.Zones[i].Name]; ok {
+			status.Zones[i].Disabled = true
+			status.Zones[i].DisabledUntil = until
+		}
+	}
+	for _, zone := range status.Zones {
+		if zone.Disabled != loop.lastDisabled[zone.Name] {
+			message := "enabled"
+			if zone.Disabled {
+				message = "disabled"
+			}
+			events.Write(Event{Type: EventZone, Zone: zone.Name,
+				Message: message})
+			loop.lastDisabled[zone.Name] = zone.Disabled
+		}
+	}
+
+	held := map[int]bool{}
+	if !config.SensorOnly {
+		status.Fans = fanStatuses(config, targets)
+		held = holdDisabledZones(status.Fans, fanZones(config), disabled,
+			loop.applied)
+		if override := loop.server.overrides.Get(); override != nil {
+			status.Override = override
+			status.Fans = override.Apply(status.Fans)
+			for fan := range override.Fans {
+				delete(held, fan)
 			}
+		}
 
-			lastStatus = status
+		for i := range status.Fans {
+			if !held[status.Fans[i].Fan] {
+				status.Fans[i] = applyStallDuty(config, status.Fans[i])
+			}
+			loop.trace.Printf("fan %d target %d (%s)", status.Fans[i].Fan,
+				status.Fans[i].RPM, status.Fans[i].Reason)
 		}
 
-		if !constantSet || lastRPM != targetRPM {
-			// Open device
-			if err := controller.Open(); err != nil {
-				log.Printf("ERROR failed to open controller: %v", err)
-				time.Sleep(5 * time.Second)
+		if config.ReadSpeeds {
+			loop.readSpeeds(status.Fans)
+		}
+	}
+
+	overrideName := ""
+	if status.Override != nil {
+		overrideName = status.Override.Preset
+	}
+	if overrideName != loop.lastOverride {
+		if len(overrideName) != 0 {
+			events.Write(Event{Type: EventOverride, Preset: overrideName,
+				Message: "applied"})
+		} else {
+			events.Write(Event{Type: EventOverride, Preset: loop.lastOverride,
+				Message: "ended"})
+		}
+		loop.lastOverride = overrideName
+	}
+	status.CycleCommands = int(totalRuns(commandRuns()) - runs)
+	loop.server.Set(status)
+	if loop.onStatus != nil {
+		loop.onStatus(status)
+	}
+	loop.server.history.AddStatus(status)
+
+	if config.SensorOnly {
+		// No controller, only export status
+		return loop.pollInterval, cycleErr
+	}
+
+	// Verify fans did not drift, for example after a brown-out, or were
+	// changed by another tool
+	if loop.verifyInterval > 0 &&
+		time.Since(loop.lastVerify) >= loop.verifyInterval {
+		loop.lastVerify = time.Now()
+		loop.externalChanges(verifyDuties(loop.controller, loop.applied,
+			loop.verifyFans))
+	}
+
+	// Fans which need to be set
+	changed := []FanStatus{}
+	for _, fan := range status.Fans {
+		if held[fan.Fan] {
+			loop.trace.Printf("fan %d held, zone disabled", fan.Fan)
+			continue
+		}
+
+		if dithered := loop.dither.Apply(fan.Fan, fan.RPM); dithered != fan.RPM {
+			fan.RPM = dithered
+			fan.Reason += ", dithered"
+		}
+
+		// Dither may be below the stall duty again
+		fan = applyStallDuty(config, fan)
+
+		// Keep adopted duty, until the target changes
+		if target, ok := loop.adopted[fan.Fan]; ok {
+			if target == fan.RPM {
+				loop.trace.Printf("fan %d keeps adopted duty", fan.Fan)
 				continue
 			}
+			delete(loop.adopted, fan.Fan)
+		}
 
-			// First set constant settings
-			if !constantSet {
-				log.Printf("INFO setting constant fans: %v", config.ConstantRPM)
-				constantSet = true
-				for key, value := range config.ConstantRPM {
-					if err := controller.SetSpeed(key, value); err != nil {
-						log.Printf("ERROR failed to set constant fan speed: %d, %d -> %v",
-							key, value, err)
-						constantSet = false
-					}
-				}
+		if rpm, ok := loop.applied[fan.Fan]; !ok || rpm != fan.RPM {
+			loop.trace.Printf("fan %d command %d (%s)", fan.Fan, fan.RPM,
+				fan.Reason)
+			changed = append(changed, fan)
+		} else {
+			loop.trace.Printf("fan %d unchanged at %d", fan.Fan, rpm)
+		}
+	}
+
+	// Queue changes, for emergencies to go first, dropping commands left
+	// from a failed cycle
+	loop.server.queue.Clear()
+	zones := fanZones(config)
+	temperatures := zoneTemperatures(status.Zones)
+	for _, fan := range changed {
+		change := Change{Time: time.Now(), Fan: fan.Fan, To: fan.RPM,
+			Zone: zones[fan.Fan], Temperature: temperatures[zones[fan.Fan]],
+			Reason: fan.Reason}
+		if status.Override != nil {
+			if _, ok := status.Override.Fans[fan.Fan]; ok {
+				change.Zone = ""
+				change.Temperature = nil
 			}
+		}
+		loop.server.queue.Push(fan, change, commandPriority(fan, loop.applied,
+			status.Override))
+	}
+
+	if loop.server.queue.Len() == 0 {
+		log.Printf("INFO no RPM change")
+		return loop.pollInterval, cycleErr
+	}
 
-			// Set curve fan rpm
-			if lastRPM != targetRPM {
-				log.Printf("INFO setting curve fans %v to: %d",
-					config.CurveFans, targetRPM)
-
-				lastRPM = targetRPM
-				for _, fan := range config.CurveFans {
-					if err := controller.SetSpeed(fan, targetRPM); err != nil {
-						log.Printf("ERROR failed to set disk fan speed: %d, %d -> %v",
-							fan, targetRPM, err)
-						lastRPM = -1
-					}
-				}
+	// Close device, once open
+	opened := false
+	var controllerErr error
+	closeController := func() {
+		opened = false
+		if err := loop.controller.Close(); err != nil {
+			log.Printf("ERROR failed to close controller: %v", err)
+			if cycleErr == nil {
+				cycleErr = err
 			}
+		}
+	}
 
-			if err := controller.Close(); err != nil {
-				log.Printf("ERROR failed to close controller: %v", err)
+	// Pop one command at a time, so that emergencies pushed meanwhile, such
+	// as a preset applied through the API, preempt the rest of the batch
+	for {
+		command, ok := loop.server.queue.Pop()
+		if !ok {
+			break
+		}
+		fan, change := command.fan, command.change
+		emergency := command.priority == priorityEmergency
+
+		if rpm, ok := loop.applied[fan.Fan]; ok {
+			change.From = &rpm
+			log.Printf("INFO setting fan %d from: %d to: %d (%s)", fan.Fan,
+				rpm, fan.RPM, fan.Reason)
+		} else {
+			log.Printf("INFO setting fan %d to: %d (%s)", fan.Fan, fan.RPM,
+				fan.Reason)
+		}
+
+		// Do not hold the device open while waiting for the before hook
+		if opened && !emergency && loop.hooks.HasBefore(change) {
+			closeController()
+		}
+		loop.hooks.Before(change, emergency)
+
+		// Open device
+		if !opened {
+			if err := loop.controller.Open(); err != nil {
+				log.Printf("ERROR failed to open controller: %v", err)
+				loop.setControllerLost(status, zoneState, err)
+				return 5 * time.Second, err
+			}
+			opened = true
+		}
+
+		if err := loop.controller.SetSpeed(fan.Fan, fan.RPM); err != nil {
+			log.Printf("ERROR failed to set fan speed: %d, %d -> %v",
+				fan.Fan, fan.RPM, err)
+			delete(loop.applied, fan.Fan)
+			controllerErr = err
+			if cycleErr == nil {
+				cycleErr = err
 			}
 		} else {
-			log.Printf("INFO no RPM change")
+			loop.applied[fan.Fan] = fan.RPM
+			loop.server.changes.Add(change)
+			rpm := fan.RPM
+			events.Write(Event{Type: EventRPM, Fan: fan.Fan, RPM: &rpm,
+				Message: fan.Reason})
+			loop.hooks.After(change)
+		}
+	}
+
+	if opened {
+		closeController()
+	}
+	loop.setControllerLost(status, zoneState, controllerErr)
+
+	return loop.pollInterval, cycleErr
+}
+
+// Set whether the controller was lost with err, or nil if not, and update
+// the served status state, if it changed
+func (loop *loop) setControllerLost(status Status, zoneState string,
+	err error) {
+
+	loop.controllerErr = err
+
+	state := zoneState
+	message := ""
+	if err != nil {
+		state = StateControllerLost
+		message = err.Error()
+	}
+	if state != status.State || message != status.ControllerError {
+		status.State = state
+		status.ControllerError = message
+		loop.server.Set(status)
+	}
+}
+
+// Read fan speeds into fan statuses, filtering implausible readings
+func (loop *loop) readSpeeds(fans []FanStatus) {
+	if err := loop.controller.Open(); err != nil {
+		log.Printf("ERROR failed to open controller: %v", err)
+		return
+	}
+
+	defer func() {
+		if err := loop.controller.Close(); err != nil {
+			log.Printf("ERROR failed to close controller: %v", err)
+		}
+	}()
+
+	for i := range fans {
+		raw, err := loop.controller.GetSpeed(fans[i].Fan)
+		if err != nil {
+			log.Printf("ERROR failed to get fan speed: %d -> %v", fans[i].Fan,
+				err)
+			continue
+		}
+
+		speed, accepted := loop.speedFilter.Filter(fans[i].Fan, raw)
+		if !accepted {
+			log.Printf("WARNING discarded fan %d speed reading: %d, using: %d",
+				fans[i].Fan, raw, speed)
+		}
+
+		fans[i].Speed = &speed
+		fans[i].RawSpeed = &raw
+	}
+}
+
+// Get index of the highest curve point reached by the curve input of a
+// zone, if it has a curve and input
+func zonePoint(config config.Config, zone ZoneStatus) *int {
+	if zone.Input == nil {
+		return nil
+	}
+
+	curve := config.DiskCurve.Curve
+	if zone.Name != disksZone {
+		for _, zoneConfig := range config.Zones {
+			if zoneConfig.Name == zone.Name {
+				curve = zoneConfig.Curve
+			}
+		}
+	}
+	if len(curve.Points) == 0 {
+		return nil
+	}
+
+	index := curve.PointIndex(*zone.Input)
+	return &index
+}
+
+// Read smartd warnings written by the smartd hook, and write them as events
+func (loop *loop) readSmartdWarnings() {
+	warnings, err := disk.ReadSmartdWarnings(loop.config.SmartdDir)
+	if err != nil {
+		log.Printf("ERROR failed to read smartd warnings: %v", err)
+	}
+
+	for _, warning := range warnings {
+		log.Printf("WARNING smartd %s: %s: %s", warning.Device,
+			warning.FailType, warning.Message)
+		loop.server.events.Write(Event{Time: warning.Time, Type: EventSmartd,
+			Disk: warning.Device, Message: warning.FailType + ": " +
+				warning.Message})
+	}
+}
+
+// Read current fan duties from the controller, so that fans which are already
+// at the right speed, for example after a daemon restart, are not written
+// again. Returns no duties on errors, so that all fans are written.
+func readCurrentDuties(controller *controller.Chain,
+	fans []int) map[int]int {
+
+	duties := map[int]int{}
+	if err := controller.Open(); err != nil {
+		log.Printf("ERROR failed to open controller: %v", err)
+		return duties
+	}
+
+	defer func() {
+		if err := controller.Close(); err != nil {
+			log.Printf("ERROR failed to close controller: %v", err)
 		}
+	}()
+	logQuirks(controller)
 
-		time.Sleep(time.Duration(config.DiskCurve.PollInterval) * time.Second)
+	for _, fan := range fans {
+		duty, err := controller.GetDuty(fan)
+		if err != nil {
+			log.Printf("ERROR failed to get fan duty: %d -> %v", fan, err)
+			return map[int]int{}
+		}
+		duties[fan] = duty
 	}
+	log.Printf("INFO current fan duties: %v", duties)
+
+	return duties
+}
+
+// Log identity and quirks of each controller of chain, once opened
+func logQuirks(chain *controller.Chain) {
+	for _, status := range controllerStatuses(chain) {
+		profile := status.QuirksProfile
+		if len(profile) == 0 {
+			profile = "none"
+		}
+		log.Printf("INFO controller %s is %s, quirks profile: %s, "+
+			"command delay: %dms, skip ping: %t, readback tolerance: %d",
+			status.DevicePath, status.Identity, profile,
+			status.CommandDelay, status.SkipPing, status.ReadbackTolerance)
+	}
+}
+
+// Handle external changes of fan duties by the on_external_change action.
+// Each change is reported once.
+func (loop *loop) externalChanges(changes map[int]int) {
+	action := loop.config.OnExternalChange
+
+	for fan, duty := range changes {
+		rpm := loop.applied[fan]
+		if reported, ok := loop.external[fan]; ok && reported == duty {
+			continue
+		}
+		log.Printf("WARNING fan %d duty changed from %d to %d, %s",
+			fan, rpm, duty, action)
+		loop.server.events.Write(Event{Type: EventExternal, Fan: fan,
+			RPM: &duty, Message: fmt.Sprintf("changed from %d, %s", rpm,
+				action)})
+
+		switch action {
+		case config.ExternalReassert:
+			delete(loop.applied, fan)
+
+		case config.ExternalAdopt:
+			loop.adopted[fan] = rpm
+			loop.applied[fan] = duty
+
+		case config.ExternalAlert:
+			loop.external[fan] = duty
+		}
+	}
+
+	// Forget reported changes which are gone
+	for fan := range loop.external {
+		if _, ok := changes[fan]; !ok {
+			delete(loop.external, fan)
+		}
+	}
+}
+
+// Verify current duties of fans match the applied rpm. Returns the current
+// duty of fans which differ.
+func verifyDuties(controller *controller.Chain,
+	applied map[int]int, fans []int) map[int]int {
+
+	changes := map[int]int{}
+	if err := controller.Open(); err != nil {
+		log.Printf("ERROR failed to open controller: %v", err)
+		return changes
+	}
+
+	defer func() {
+		if err := controller.Close(); err != nil {
+			log.Printf("ERROR failed to close controller: %v", err)
+		}
+	}()
+
+	for _, fan := range fans {
+		rpm, ok := applied[fan]
+		if !ok {
+			continue
+		}
+
+		duty, err := controller.GetDuty(fan)
+		if err != nil {
+			log.Printf("ERROR failed to get fan duty: %d -> %v", fan, err)
+			continue
+		}
+
+		if !controller.DutyMatches(fan, rpm, duty) {
+			changes[fan] = duty
+		}
+	}
+
+	return changes
 }
@@ -0,0 +1,101 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// debouncer coalesces bursts of override requests, such as an automation
+// flapping between presets. The first request of a key is applied at once,
+// but those within the window after it only replace the pending request of
+// their key, and the last one is applied when the window ends.
+type debouncer struct {
+	mutex sync.Mutex
+	keys  map[string]*debounced
+}
+
+// debounced requests of a key
+type debounced struct {
+	applied   time.Time
+	pending   func()
+	coalesced int
+	timer     *time.Timer
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Do f for key now, or when the window since the last request of key was
+// applied ends, replacing any request pending until then. A zero window
+// always does f now. Returns true if f was done now.
+func (debouncer *debouncer) Do(key string, window time.Duration,
+	f func()) bool {
+
+	if window <= 0 {
+		f()
+		return true
+	}
+
+	debouncer.mutex.Lock()
+	if debouncer.keys == nil {
+		debouncer.keys = map[string]*debounced{}
+	}
+	state, ok := debouncer.keys[key]
+	if !ok {
+		state = &debounced{}
+		debouncer.keys[key] = state
+	}
+
+	now := time.Now()
+	if state.timer == nil && now.Sub(state.applied) >= window {
+		state.applied = now
+		debouncer.mutex.Unlock()
+		f()
+		return true
+	}
+
+	if state.pending != nil {
+		state.coalesced++
+	}
+	state.pending = f
+	if state.timer == nil {
+		state.timer = time.AfterFunc(state.applied.Add(window).Sub(now),
+			func() { debouncer.fire(key) })
+	}
+	debouncer.mutex.Unlock()
+
+	return false
+}
+
+// Fire the pending request of key
+func (debouncer *debouncer) fire(key string) {
+	debouncer.mutex.Lock()
+	state := debouncer.keys[key]
+	f, coalesced := state.pending, state.coalesced
+	state.applied = time.Now()
+	state.pending = nil
+	state.coalesced = 0
+	state.timer = nil
+	debouncer.mutex.Unlock()
+
+	if coalesced > 0 {
+		log.Printf("INFO coalesced %d %s requests", coalesced+1, key)
+	}
+	f()
+}
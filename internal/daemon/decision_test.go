@@ -0,0 +1,76 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/config"
+	"testing"
+	"time"
+)
+
+func TestFailedDecision(t *testing.T) {
+	target := failedDecision("error: failed to check temperature")
+	if target.RPM != 100 || !target.Failsafe || !target.Failed {
+		t.Errorf("failedDecision = %+v, expected failed failsafe of 100",
+			target)
+	}
+}
+
+// Failsafe decisions are told apart by their Failsafe field, and not by the
+// wording of their reason
+func TestDecisionFailsafe(t *testing.T) {
+	tests := []struct {
+		name   string
+		target decision
+	}{
+		{"failsafe", decision{RPM: 100, Reason: "sensor lost",
+			Failsafe: true}},
+		{"failed", failedDecision("disks removed, error: all disks removed")},
+		{"panic wording", decision{RPM: 100, Reason: "panic temp 55°C"}},
+		{"error wording", decision{RPM: 100, Reason: "error: none"}},
+	}
+
+	for _, test := range tests {
+		// Failsafes raise the pushed target
+		pushed := pushedTargets{}
+		pushed.Set(disksZone, 50, time.Minute)
+		applied := pushed.Apply(disksZone, test.target)
+		if expected := test.target.Failsafe; (applied.RPM == 100) != expected {
+			t.Errorf("%s: pushed Apply = %+v, expected failsafe: %v",
+				test.name, applied, expected)
+		}
+
+		// Failsafes are not eased
+		now := time.Now()
+		ramp := newRamp(config.Ramp{Time: 60})
+		ramp.Apply(decision{RPM: 40}, now)
+		eased := ramp.Apply(test.target, now.Add(time.Second))
+		if expected := test.target.Failsafe; (eased.RPM == 100) != expected {
+			t.Errorf("%s: ramp Apply = %+v, expected failsafe: %v",
+				test.name, eased, expected)
+		}
+
+		// Failsafes raise fan groups
+		targets := map[string]decision{disksZone: {RPM: 30},
+			"cpu": test.target}
+		zone, _, found := emergencyTarget(targets)
+		if found != test.target.Failsafe || (found && zone != "cpu") {
+			t.Errorf("%s: emergencyTarget = %s, %v, expected failsafe: %v",
+				test.name, zone, found, test.target.Failsafe)
+		}
+	}
+}
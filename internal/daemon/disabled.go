@@ -0,0 +1,133 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"sync"
+	"time"
+)
+
+// disabledZones holds the zones whose automatic control is disabled, with
+// the time they are enabled again, or nil if disabled until enabled
+type disabledZones struct {
+	mutex sync.Mutex
+	zones map[string]*time.Time
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Disable zone for duration, or until enabled if zero
+func (disabled *disabledZones) Disable(name string,
+	duration time.Duration) *time.Time {
+
+	var until *time.Time
+	if duration > 0 {
+		value := time.Now().Add(duration)
+		until = &value
+	}
+
+	disabled.mutex.Lock()
+	defer disabled.mutex.Unlock()
+
+	if disabled.zones == nil {
+		disabled.zones = map[string]*time.Time{}
+	}
+	disabled.zones[name] = until
+
+	return until
+}
+
+// Enable zone
+func (disabled *disabledZones) Enable(name string) {
+	disabled.mutex.Lock()
+	defer disabled.mutex.Unlock()
+	delete(disabled.zones, name)
+}
+
+// Get copy of disabled zones, without expired ones
+func (disabled *disabledZones) Get() map[string]*time.Time {
+	disabled.mutex.Lock()
+	defer disabled.mutex.Unlock()
+
+	result := map[string]*time.Time{}
+	for name, until := range disabled.zones {
+		if until != nil && time.Now().After(*until) {
+			delete(disabled.zones, name)
+			continue
+		}
+		result[name] = until
+	}
+
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Get zone of each fan controlled by a zone
+func fanZones(config config.Config) map[int]string {
+	zones := map[int]string{}
+
+	for _, fan := range config.CurveFans {
+		zones[fan] = disksZone
+	}
+
+	for _, group := range config.FanGroups {
+		for _, fan := range group.Fans {
+			zones[fan] = disksZone
+		}
+	}
+
+	for _, zone := range config.Zones {
+		for _, fan := range zone.Fans {
+			zones[fan] = zone.Name
+		}
+	}
+
+	return zones
+}
+
+// Hold fans of disabled zones at their applied rpm. Returns the held fans.
+func holdDisabledZones(fans []FanStatus, zones map[int]string,
+	disabled map[string]*time.Time, applied map[int]int) map[int]bool {
+
+	held := map[int]bool{}
+	for i := range fans {
+		zone, ok := zones[fans[i].Fan]
+		if !ok {
+			continue
+		}
+		until, ok := disabled[zone]
+		if !ok {
+			continue
+		}
+		rpm, ok := applied[fans[i].Fan]
+		if !ok {
+			continue
+		}
+
+		fans[i].RPM = rpm
+		fans[i].Reason = fmt.Sprintf("zone %s disabled", zone)
+		if until != nil {
+			fans[i].Reason += " until " + until.Format("15:04:05")
+		}
+		held[fans[i].Fan] = true
+	}
+
+	return held
+}
@@ -0,0 +1,85 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/controller"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// dither offsets running fans by a random percentage of their rpm, chosen
+// again for each fan every interval, so that fans do not stay at a speed
+// where the chassis resonates.
+type dither struct {
+	percent  int
+	interval time.Duration
+
+	random  *rand.Rand
+	offsets map[int]int
+	next    time.Time
+}
+
+// Create dither of up to percent, changing every interval
+func newDither(percent int, interval time.Duration) *dither {
+	return &dither{
+		percent:  percent,
+		interval: interval,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		offsets:  map[int]int{},
+	}
+}
+
+// Resume offsets of previous dither, if it had the same percent and interval
+func (dither *dither) Resume(previous *dither) {
+	if previous.percent == dither.percent &&
+		previous.interval == dither.interval {
+		dither.offsets, dither.next = previous.offsets, previous.next
+	}
+}
+
+// Apply dither to fan rpm. Stopped fans stay stopped, fans at full speed (for
+// example on errors or panic temperature) stay at full speed, and other fans
+// stay in the controller range.
+func (dither *dither) Apply(fan int, rpm int) int {
+	if dither.percent == 0 || rpm == 0 || rpm == controller.GridMaxFanRPM {
+		return rpm
+	}
+
+	// Choose new offsets every interval
+	if now := time.Now(); !now.Before(dither.next) {
+		dither.offsets = map[int]int{}
+		dither.next = now.Add(dither.interval)
+	}
+
+	offset, ok := dither.offsets[fan]
+	if !ok {
+		offset = dither.random.Intn(2*dither.percent+1) - dither.percent
+		dither.offsets[fan] = offset
+	}
+
+	rpm = int(math.Round(float64(rpm) * float64(100+offset) / 100))
+	if rpm < controller.GridMinFanRPM {
+		rpm = controller.GridMinFanRPM
+	}
+	if rpm > controller.GridMaxFanRPM {
+		rpm = controller.GridMaxFanRPM
+	}
+
+	return rpm
+}
@@ -0,0 +1,133 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"github.com/cybojanek/gridfan/api"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types, see the api package
+const (
+	EventRPM       = api.EventRPM
+	EventStatus    = api.EventStatus
+	EventOverride  = api.EventOverride
+	EventExternal  = api.EventExternal
+	EventZone      = api.EventZone
+	EventThreshold = api.EventThreshold
+	EventRunaway   = api.EventRunaway
+	EventCritical  = api.EventCritical
+	EventLimit     = api.EventLimit
+	EventSmartd    = api.EventSmartd
+	EventError     = api.EventError
+)
+
+// eventLog appends events as JSON lines to a file, and sends them to its
+// subscribers
+type eventLog struct {
+	path string
+
+	mutex       sync.Mutex
+	file        *os.File
+	subscribers map[chan Event]bool
+}
+
+// Events buffered for each subscriber, before it misses events
+const eventBuffer = 64
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Write event to subscribers, and to the event log, if there is one
+func (events *eventLog) Write(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	for subscriber := range events.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+
+	if len(events.path) == 0 {
+		return
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("ERROR failed to encode event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if events.file == nil {
+		file, err := os.OpenFile(events.path,
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("ERROR failed to open event log: %v", err)
+			return
+		}
+		events.file = file
+	}
+
+	if _, err := events.file.Write(line); err != nil {
+		log.Printf("ERROR failed to write event log: %v", err)
+	}
+}
+
+// Subscribe to events written from now on, until cancel. Events are dropped
+// for subscribers which fall more than eventBuffer events behind.
+func (events *eventLog) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, eventBuffer)
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	if events.subscribers == nil {
+		events.subscribers = map[chan Event]bool{}
+	}
+	events.subscribers[subscriber] = true
+
+	cancel := func() {
+		events.mutex.Lock()
+		defer events.mutex.Unlock()
+		delete(events.subscribers, subscriber)
+	}
+	return subscriber, cancel
+}
+
+// Close event log file, if open
+func (events *eventLog) Close() {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	if events.file == nil {
+		return
+	}
+
+	if err := events.file.Close(); err != nil {
+		log.Printf("ERROR failed to close event log: %v", err)
+	}
+	events.file = nil
+}
@@ -0,0 +1,72 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// follower reads the target rpm computed by a leader daemon, with the
+// api_token shared with the leader, if any.
+type follower struct {
+	url    string
+	token  string
+	client http.Client
+}
+
+// Create follower of leader API address, with token
+func newFollower(leader string, token string) *follower {
+	return &follower{
+		url:    strings.TrimSuffix(leader, "/") + "/status",
+		token:  token,
+		client: http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Get status of leader
+func (follower *follower) Get() (Status, error) {
+	status := Status{}
+
+	request, err := http.NewRequest(http.MethodGet, follower.url, nil)
+	if err != nil {
+		return status, err
+	}
+	if len(follower.token) != 0 {
+		request.Header.Set("Authorization", "Bearer "+follower.token)
+	}
+
+	response, err := follower.client.Do(request)
+	if err != nil {
+		return status, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("Get: Unexpected leader status: %s",
+			response.Status)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("Get: Malformed leader status: %v", err)
+	}
+
+	return status, nil
+}
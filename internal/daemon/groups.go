@@ -0,0 +1,137 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/controller"
+	"math"
+	"sort"
+)
+
+// Get fan group rpm for the curve fan rpm. Stopped curve fans also stop the
+// group, otherwise the rpm is clamped to the controller range.
+func fanGroupRPM(group config.FanGroup, curveRPM int) int {
+	if curveRPM == 0 {
+		return 0
+	}
+
+	rpm := int(math.Round(float64(curveRPM)*group.Ratio)) + group.Offset
+	if rpm < controller.GridMinFanRPM {
+		rpm = controller.GridMinFanRPM
+	}
+	if rpm > controller.GridMaxFanRPM {
+		rpm = controller.GridMaxFanRPM
+	}
+
+	return rpm
+}
+
+// Get status of all configured fans for the zone decisions
+func fanStatuses(config config.Config, targets map[string]decision) []FanStatus {
+	fans := []FanStatus{}
+	curve := targets[disksZone]
+
+	zone, emergency, raise := emergencyTarget(targets)
+	raise = raise && config.ConstantRPMOnPanic
+	for fan, rpm := range config.ConstantRPM {
+		status := FanStatus{Fan: fan, RPM: rpm, Reason: "constant"}
+		if raise && emergency.RPM > rpm {
+			status.RPM = emergency.RPM
+			status.Reason = fmt.Sprintf("constant, raised by zone %s: %s",
+				zone, emergency.Reason)
+		}
+		fans = append(fans, status)
+	}
+
+	for _, fan := range config.CurveFans {
+		fans = append(fans, FanStatus{Fan: fan,
+			RPM: curve.FanRPM(config, fan), Reason: curve.Reason})
+	}
+
+	for _, group := range config.FanGroups {
+		groupRPM := fanGroupRPM(group, curve.RPM)
+		reason := fmt.Sprintf("fan group %s: %v x curve %d %+d (%s)",
+			group.Name, group.Ratio, curve.RPM, group.Offset, curve.Reason)
+		if len(group.Cooldown) != 0 && curve.Cooldown != nil {
+			groupRPM = group.Cooldown.At(*curve.Cooldown)
+			reason = fmt.Sprintf("fan group %s: cooldown (%s)", group.Name,
+				curve.Reason)
+		}
+		for _, fan := range group.Fans {
+			fans = append(fans, FanStatus{Fan: fan, RPM: groupRPM,
+				Reason: reason})
+		}
+	}
+
+	for _, zone := range config.Zones {
+		target := targets[zone.Name]
+		for _, fan := range zone.Fans {
+			fans = append(fans, FanStatus{Fan: fan,
+				RPM:    target.FanRPM(config, fan),
+				Reason: fmt.Sprintf("zone %s: %s", zone.Name, target.Reason)})
+		}
+	}
+
+	sort.Slice(fans, func(i, j int) bool { return fans[i].Fan < fans[j].Fan })
+
+	return fans
+}
+
+// Zone and emergency decision of targets with the highest rpm, if any
+func emergencyTarget(targets map[string]decision) (string, decision, bool) {
+	names := []string{}
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zone := ""
+	emergency := decision{}
+	found := false
+	for _, name := range names {
+		target := targets[name]
+		if target.Failsafe && (!found || target.RPM > emergency.RPM) {
+			zone, emergency, found = name, target, true
+		}
+	}
+
+	return zone, emergency, found
+}
+
+// Stall action to stop fans
+const stallStop = config.StallStop
+
+// Apply stall duty of a fan: a running fan below its stall duty is raised to
+// it, or stopped, depending on the stall action.
+func applyStallDuty(config config.Config, fan FanStatus) FanStatus {
+	duty, ok := config.StallDuty[fan.Fan]
+	if !ok || fan.RPM == 0 || fan.RPM >= duty {
+		return fan
+	}
+
+	if config.StallAction == stallStop {
+		fan.Reason += fmt.Sprintf(", stopped below stall duty %d", duty)
+		fan.RPM = 0
+	} else {
+		fan.Reason += fmt.Sprintf(", raised to stall duty %d", duty)
+		fan.RPM = duty
+	}
+
+	return fan
+}
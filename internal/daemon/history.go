@@ -0,0 +1,101 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"sync"
+	"time"
+)
+
+// Number of samples kept per series
+const historySize = 120
+
+// Series name of the disk temperature
+const disksSeries = config.DisksSensor
+
+// ring buffer of the last historySize samples
+type ring struct {
+	samples [historySize]Sample
+	next    int
+	count   int
+}
+
+// history of the last samples of named series, such as "disks",
+// "sensor/cpu" and "fan/4".
+type history struct {
+	mutex  sync.Mutex
+	series map[string]*ring
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Add sample to a series, overwriting the oldest sample if full
+func (history *history) Add(name string, value int, sampleTime time.Time) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	if history.series == nil {
+		history.series = map[string]*ring{}
+	}
+
+	series, ok := history.series[name]
+	if !ok {
+		series = &ring{}
+		history.series[name] = series
+	}
+
+	series.samples[series.next] = Sample{Time: sampleTime, Value: value}
+	series.next = (series.next + 1) % historySize
+	if series.count < historySize {
+		series.count++
+	}
+}
+
+// Get copy of all series, with samples from oldest to newest
+func (history *history) Get() map[string][]Sample {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	result := map[string][]Sample{}
+	for name, series := range history.series {
+		samples := make([]Sample, 0, series.count)
+		start := (series.next - series.count + historySize) % historySize
+		for i := 0; i < series.count; i++ {
+			samples = append(samples, series.samples[(start+i)%historySize])
+		}
+		result[name] = samples
+	}
+
+	return result
+}
+
+// AddStatus samples of disk and sensor temperatures, and fan rpm
+func (history *history) AddStatus(status Status) {
+	if status.Temperature != nil {
+		history.Add(disksSeries, *status.Temperature, status.Time)
+	}
+
+	for _, sensor := range status.Sensors {
+		history.Add("sensor/"+sensor.Name, sensor.Temperature, status.Time)
+	}
+
+	for _, fan := range status.Fans {
+		history.Add(fmt.Sprintf("fan/%d", fan.Fan), fan.RPM, status.Time)
+	}
+}
@@ -0,0 +1,124 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// speedHooks of commands to run before and after significant fan changes,
+// which change a fan by at least minChange, or set it for the first time
+type speedHooks struct {
+	before    []string
+	after     []string
+	minChange int
+	timeout   time.Duration
+}
+
+// Create speed hooks of config
+func newSpeedHooks(config config.Config) *speedHooks {
+	return &speedHooks{
+		before:    config.Hooks.BeforeChange,
+		after:     config.Hooks.AfterChange,
+		minChange: config.Hooks.MinChange,
+		timeout:   time.Duration(config.Hooks.Timeout) * time.Second,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Whether change is significant
+func (hooks *speedHooks) significant(change Change) bool {
+	if change.From == nil {
+		return true
+	}
+	delta := change.To - *change.From
+	if delta < 0 {
+		delta = -delta
+	}
+	return delta >= hooks.minChange
+}
+
+// Whether Before runs the before hook of change
+func (hooks *speedHooks) HasBefore(change Change) bool {
+	return len(hooks.before) != 0 && hooks.significant(change)
+}
+
+// Before change, run the before hook, and wait for it, up to the timeout.
+// Emergency changes, such as full speed on errors, do not wait for it.
+func (hooks *speedHooks) Before(change Change, emergency bool) {
+	if !hooks.HasBefore(change) {
+		return
+	}
+
+	if emergency {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(),
+				hooks.timeout)
+			defer cancel()
+			hooks.run(ctx, "before_change", hooks.before, change)
+		}()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hooks.timeout)
+	defer cancel()
+	hooks.run(ctx, "before_change", hooks.before, change)
+}
+
+// After change, run the after hook, without waiting for it
+func (hooks *speedHooks) After(change Change) {
+	if len(hooks.after) == 0 || !hooks.significant(change) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			hooks.timeout)
+		defer cancel()
+		hooks.run(ctx, "after_change", hooks.after, change)
+	}()
+}
+
+// Run hook command with the change in its environment
+func (hooks *speedHooks) run(ctx context.Context, name string, args []string,
+	change Change) {
+
+	from := ""
+	if change.From != nil {
+		from = fmt.Sprintf("%d", *change.From)
+	}
+
+	countCommand("hook")
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Env = append(os.Environ(),
+		fmt.Sprintf("GRIDFAN_FAN=%d", change.Fan),
+		"GRIDFAN_FROM="+from,
+		fmt.Sprintf("GRIDFAN_TO=%d", change.To),
+		"GRIDFAN_ZONE="+change.Zone,
+		"GRIDFAN_REASON="+change.Reason)
+	if output, err := command.CombinedOutput(); err != nil {
+		log.Printf("ERROR %s hook of fan %d failed: %v: %s", name,
+			change.Fan, err, output)
+	}
+}
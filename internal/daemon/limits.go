@@ -0,0 +1,112 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/disk"
+	"log"
+)
+
+// Levels of disk temperatures against their limits
+const (
+	// Within the margin of the rated maximum temperature
+	limitWarning = "warning"
+
+	// At or above the rated maximum temperature
+	limitCritical = "critical"
+)
+
+// driveLimits of disks, which warn at margin below their rated maximum
+// temperature, and are critical at it
+type driveLimits struct {
+	margin int
+	levels map[string]string
+	events *eventLog
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Evaluate last temperatures of disks with limits, logging the levels
+// reached and left, and writing them as events. Returns the disk furthest
+// above its rated maximum temperature, if any is.
+func (limits *driveLimits) Evaluate(disks []*disk.Disk) *disk.Disk {
+	var critical *disk.Disk
+	criticalExcess := 0
+
+	for _, d := range disks {
+		if d.Limits.Max == 0 {
+			continue
+		}
+
+		temperature, read := d.LastTemperature()
+		if read.IsZero() {
+			continue
+		}
+
+		level := ""
+		if temperature >= d.Limits.Max {
+			level = limitCritical
+			if excess := temperature - d.Limits.Max; critical == nil ||
+				excess > criticalExcess {
+				critical, criticalExcess = d, excess
+			}
+		} else if temperature >= d.Limits.Max-limits.margin {
+			level = limitWarning
+		}
+
+		last := limits.levels[d.DevicePath]
+		if level == last {
+			continue
+		}
+		limits.levels[d.DevicePath] = level
+
+		switch level {
+		case limitCritical:
+			log.Printf("ERROR Disk %s at %d°C reached its rated max %d°C (%s)",
+				d.DevicePath, temperature, d.Limits.Max, d.Limits.Source)
+		case limitWarning:
+			log.Printf("WARNING Disk %s at %d°C is within %d°C of its rated max %d°C (%s)",
+				d.DevicePath, temperature, limits.margin, d.Limits.Max,
+				d.Limits.Source)
+		default:
+			log.Printf("INFO Disk %s at %d°C is back below its limits",
+				d.DevicePath, temperature)
+		}
+
+		if limits.events != nil {
+			limits.events.Write(Event{Type: EventLimit, Disk: d.DevicePath,
+				From: last, To: level})
+		}
+	}
+
+	return critical
+}
+
+// Status of the limits of disks with limits, by device path
+func (limits *driveLimits) Status(disks []*disk.Disk) map[string]DiskLimit {
+	statuses := map[string]DiskLimit{}
+	for _, d := range disks {
+		if d.Limits.Max == 0 {
+			continue
+		}
+		statuses[d.DevicePath] = DiskLimit{Max: d.Limits.Max,
+			Source:  d.Limits.Source,
+			Warning: d.Limits.Max - limits.margin,
+			Level:   limits.levels[d.DevicePath]}
+	}
+	return statuses
+}
@@ -0,0 +1,147 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Metric types
+const (
+	// Value which goes up and down
+	MetricGauge = "gauge"
+
+	// Value which only goes up, until the daemon restarts
+	MetricCounter = "counter"
+)
+
+// Metric exported in Prometheus text format, by name, with its labels
+type Metric struct {
+	Name   string
+	Type   string
+	Help   string
+	Labels []string
+}
+
+// Metrics of the daemon. Names and labels are those exported, for tools
+// which generate queries, such as dashboards.
+var (
+	metricUptime = Metric{Name: "gridfan_uptime_seconds",
+		Type: MetricGauge, Help: "Seconds since the daemon started."}
+	metricBuildInfo = Metric{Name: "gridfan_build_info",
+		Type: MetricGauge, Help: "Build version and commit.",
+		Labels: []string{"version", "commit", "goversion"}}
+	metricConfigInfo = Metric{Name: "gridfan_config_info",
+		Type: MetricGauge, Help: "Loaded config file, by path, SHA-256 and profile.",
+		Labels: []string{"path", "sha256", "profile"}}
+	metricConfigLoaded = Metric{
+		Name: "gridfan_config_loaded_timestamp_seconds",
+		Type: MetricGauge, Help: "Time the config was last loaded."}
+	metricState = Metric{Name: "gridfan_state", Type: MetricGauge,
+		Help: "Daemon state: 0 ok, 1 failsafe, 2 controller lost."}
+	metricZoneRunaway = Metric{Name: "gridfan_zone_thermal_runaway",
+		Type:   MetricGauge,
+		Help:   "Whether the zone temperature is still rising with all of its fans at 100.",
+		Labels: []string{"zone"}}
+	metricZonePoint = Metric{Name: "gridfan_zone_curve_point",
+		Type:   MetricGauge,
+		Help:   "Index of the highest curve point reached by the zone curve input, or -1.",
+		Labels: []string{"zone"}}
+	metricDiskPowerState = Metric{Name: "gridfan_disk_power_state",
+		Type:   MetricGauge,
+		Help:   "Disk power state: 0 sleeping, 1 standby, 2 unknown, 3 idle, 4 active.",
+		Labels: []string{"disk"}}
+	metricDiskStatus = Metric{Name: "gridfan_disk_status", Type: MetricGauge,
+		Help: "Disk status: 0 sleeping, 1 standby, 2 unknown, 3 idle, 4 active."}
+	metricDiskTemperature = Metric{Name: "gridfan_disk_temperature_celsius",
+		Type: MetricGauge, Help: "Maximum disk temperature."}
+	metricTargetRPM = Metric{Name: "gridfan_curve_target_rpm",
+		Type: MetricGauge, Help: "Target rpm of curve fans."}
+	metricFanSpeed = Metric{Name: "gridfan_fan_speed_rpm", Type: MetricGauge,
+		Help: "Filtered fan speed reading.", Labels: []string{"fan"}}
+	metricDiskWakeups = Metric{Name: "gridfan_disk_wakeups_total",
+		Type:   MetricCounter,
+		Help:   "Temperature probes in the same poll as the disk spun up.",
+		Labels: []string{"disk"}}
+	metricFanChanges = Metric{Name: "gridfan_fan_changes_total",
+		Type:   MetricCounter,
+		Help:   "Fan speed changes, with the zone and temperature of the last one as exemplar.",
+		Labels: []string{"fan"}}
+	metricFanChangeTemperature = Metric{
+		Name:   "gridfan_fan_change_temperature_celsius",
+		Type:   MetricGauge,
+		Help:   "Zone temperature which triggered the last fan speed change.",
+		Labels: []string{"fan", "zone"}}
+	metricFanDutySeconds = Metric{Name: "gridfan_fan_duty_seconds_total",
+		Type: MetricCounter, Help: "Seconds of fan at duty range.",
+		Labels: []string{"fan", "duty"}}
+	metricCommands = Metric{Name: "gridfan_commands_total",
+		Type:   MetricCounter,
+		Help:   "Subprocesses run, such as hdparm, smartctl, exec sensors and hooks.",
+		Labels: []string{"command"}}
+	metricCycleCommands = Metric{Name: "gridfan_cycle_commands",
+		Type: MetricGauge, Help: "Subprocesses run during the last cycle."}
+	metricProcessCPU = Metric{Name: "process_cpu_seconds_total",
+		Type: MetricCounter, Help: "User and system CPU time of the daemon."}
+	metricProcessResident = Metric{Name: "process_resident_memory_bytes",
+		Type: MetricGauge, Help: "Resident memory of the daemon."}
+	metricGoroutines = Metric{Name: "go_goroutines", Type: MetricGauge,
+		Help: "Goroutines of the daemon."}
+	metricHeapBytes = Metric{Name: "go_memstats_heap_alloc_bytes",
+		Type: MetricGauge, Help: "Bytes of allocated heap objects."}
+)
+
+// Metrics of the daemon, in order of export
+var Metrics = []Metric{
+	metricUptime,
+	metricBuildInfo,
+	metricConfigInfo,
+	metricConfigLoaded,
+	metricState,
+	metricZoneRunaway,
+	metricZonePoint,
+	metricDiskPowerState,
+	metricDiskStatus,
+	metricDiskTemperature,
+	metricTargetRPM,
+	metricFanSpeed,
+	metricDiskWakeups,
+	metricFanChanges,
+	metricFanChangeTemperature,
+	metricFanDutySeconds,
+	metricCommands,
+	metricCycleCommands,
+	metricProcessCPU,
+	metricProcessResident,
+	metricGoroutines,
+	metricHeapBytes,
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Write HELP and TYPE lines of metric. In OpenMetrics, these name the
+// family of a counter, without its _total suffix.
+func (metric Metric) writeHeader(w io.Writer, openMetrics bool) {
+	name := metric.Name
+	if openMetrics && metric.Type == MetricCounter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, metric.Help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metric.Type)
+}
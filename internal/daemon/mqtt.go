@@ -0,0 +1,359 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/controller"
+	"github.com/cybojanek/gridfan/internal/mqtt"
+	"github.com/cybojanek/gridfan/internal/version"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay before reconnecting to the mqtt broker, doubling up to the max
+const (
+	mqttRetryDelay    = 5 * time.Second
+	mqttMaxRetryDelay = 5 * time.Minute
+)
+
+// Interval of publishing zone states, which are only published on change
+const mqttStateInterval = time.Second
+
+// Preset mode of Home Assistant fans without a preset override, which clears
+// the override when set
+const mqttPresetAuto = "auto"
+
+// Payloads of the availability and state topics
+const (
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+	mqttOn      = "ON"
+	mqttOff     = "OFF"
+)
+
+// mqttBridge of zones to Home Assistant MQTT fans. Each zone publishes its
+// state, percentage and preset mode, and takes commands to set them, which
+// become pushed targets and preset overrides, as through the API.
+type mqttBridge struct {
+	server *statusServer
+
+	// Config at start, whose broker and topics only change on restart
+	config config.Config
+
+	stop chan struct{}
+	done chan struct{}
+
+	// Retained payloads by topic, published on the current connection
+	published map[string]string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Start mqtt bridge of server in the background
+func startMQTTBridge(server *statusServer) *mqttBridge {
+	bridge := &mqttBridge{server: server, config: server.Config(),
+		stop: make(chan struct{}), done: make(chan struct{})}
+
+	go func() {
+		defer close(bridge.done)
+		bridge.run()
+	}()
+
+	return bridge
+}
+
+// Stop bridge, publishing that gridfan is offline
+func (bridge *mqttBridge) Stop() {
+	close(bridge.stop)
+	<-bridge.done
+}
+
+// Connect to the broker, and serve, until stopped, reconnecting with backoff
+func (bridge *mqttBridge) run() {
+	delay := mqttRetryDelay
+	for {
+		client, err := bridge.connect()
+		if err != nil {
+			log.Printf("ERROR failed to connect to mqtt broker: %v", err)
+		} else {
+			log.Printf("INFO connected to mqtt broker: %s",
+				bridge.config.MQTT.Broker)
+			delay = mqttRetryDelay
+			if !bridge.serve(client) {
+				return
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-bridge.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > mqttMaxRetryDelay {
+			delay = mqttMaxRetryDelay
+		}
+	}
+}
+
+// Connect to the broker, with a will that gridfan is offline, and subscribe
+// to the command topics of all zones
+func (bridge *mqttBridge) connect() (*mqtt.Client, error) {
+	settings := bridge.config.MQTT
+	var rootCAs *x509.CertPool
+	if len(settings.CAFile) != 0 {
+		contents, err := ioutil.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("connect: No certificates in: %s",
+				settings.CAFile)
+		}
+	}
+
+	client, err := mqtt.Dial(mqtt.Options{Address: settings.Broker,
+		RootCAs: rootCAs, ClientID: settings.ClientID,
+		Username: settings.Username,
+		Password: settings.Password,
+		Will: &mqtt.Message{Topic: bridge.topic("availability"),
+			Payload: []byte(mqttOffline), Retain: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Subscribe(bridge.topic("+", "set"),
+		bridge.topic("+", "percentage", "set"),
+		bridge.topic("+", "preset_mode", "set")); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Serve connected client, until it is lost, or the bridge is stopped.
+// Returns false if stopped.
+func (bridge *mqttBridge) serve(client *mqtt.Client) bool {
+	bridge.published = map[string]string{}
+	ticker := time.NewTicker(mqttStateInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := bridge.publishStates(client); err != nil {
+			log.Printf("ERROR failed to publish to mqtt broker: %v", err)
+			client.Close()
+			return true
+		}
+
+		select {
+		case <-bridge.stop:
+			if err := client.Publish(bridge.topic("availability"),
+				[]byte(mqttOffline), true); err != nil {
+				log.Printf("ERROR failed to publish to mqtt broker: %v", err)
+			}
+			client.Close()
+			return false
+
+		case message, ok := <-client.Messages():
+			if !ok {
+				log.Printf("ERROR lost mqtt broker: %v", client.Err())
+				return true
+			}
+			bridge.command(message)
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// Topic of parts under the topic prefix
+func (bridge *mqttBridge) topic(parts ...string) string {
+	return strings.Join(append([]string{bridge.config.MQTT.TopicPrefix},
+		parts...), "/")
+}
+
+// Publish retained availability, and the discovery config and state of each
+// zone, which changed since last published. Topics of zones removed by a
+// reload are cleared, so Home Assistant removes their fans.
+func (bridge *mqttBridge) publishStates(client *mqtt.Client) error {
+	payloads := map[string]string{bridge.topic("availability"): mqttOnline}
+
+	presetMode := mqttPresetAuto
+	if override := bridge.server.overrides.Get(); override != nil {
+		presetMode = override.Preset
+	}
+
+	presetModes := []string{}
+	for name := range bridge.server.Config().Presets {
+		presetModes = append(presetModes, name)
+	}
+	sort.Strings(presetModes)
+	presetModes = append([]string{mqttPresetAuto}, presetModes...)
+
+	for _, zone := range bridge.server.Get().Zones {
+		discovery, err := json.Marshal(bridge.discovery(zone.Name, presetModes))
+		if err != nil {
+			return err
+		}
+		payloads[bridge.discoveryTopic(zone.Name)] = string(discovery)
+
+		state := mqttOff
+		if zone.TargetRPM > 0 {
+			state = mqttOn
+		}
+		payloads[bridge.topic(zone.Name, "state")] = state
+		payloads[bridge.topic(zone.Name, "percentage")] =
+			strconv.Itoa(zone.TargetRPM)
+		payloads[bridge.topic(zone.Name, "preset_mode")] = presetMode
+	}
+
+	for topic := range bridge.published {
+		if _, ok := payloads[topic]; !ok {
+			payloads[topic] = ""
+		}
+	}
+
+	topics := []string{}
+	for topic := range payloads {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		payload := payloads[topic]
+		if previous, ok := bridge.published[topic]; ok && previous == payload {
+			continue
+		}
+
+		if err := client.Publish(topic, []byte(payload), true); err != nil {
+			return err
+		}
+
+		if len(payload) == 0 {
+			delete(bridge.published, topic)
+		} else {
+			bridge.published[topic] = payload
+		}
+	}
+
+	return nil
+}
+
+// Discovery topic of zone, with the client id as node id
+func (bridge *mqttBridge) discoveryTopic(zone string) string {
+	return strings.Join([]string{bridge.config.MQTT.DiscoveryPrefix, "fan",
+		bridge.config.MQTT.ClientID, zone, "config"}, "/")
+}
+
+// Discovery config of zone, as a Home Assistant MQTT fan
+func (bridge *mqttBridge) discovery(zone string,
+	presetModes []string) map[string]interface{} {
+
+	clientID := bridge.config.MQTT.ClientID
+	return map[string]interface{}{
+		"name":                      zone,
+		"unique_id":                 clientID + "_" + zone,
+		"availability_topic":        bridge.topic("availability"),
+		"command_topic":             bridge.topic(zone, "set"),
+		"state_topic":               bridge.topic(zone, "state"),
+		"percentage_command_topic":  bridge.topic(zone, "percentage", "set"),
+		"percentage_state_topic":    bridge.topic(zone, "percentage"),
+		"preset_mode_command_topic": bridge.topic(zone, "preset_mode", "set"),
+		"preset_mode_state_topic":   bridge.topic(zone, "preset_mode"),
+		"preset_modes":              presetModes,
+		"device": map[string]interface{}{
+			"identifiers":  []string{clientID},
+			"name":         clientID,
+			"manufacturer": "gridfan",
+			"sw_version":   version.String(),
+		},
+	}
+}
+
+// TTL of targets pushed by commands, which is override_ttl, like every manual
+// override
+func (bridge *mqttBridge) ttl() time.Duration {
+	return time.Duration(bridge.server.Config().OverrideTTL) * time.Second
+}
+
+// Command of message on a command topic. Percentage pushes a target of the
+// zone, for override_ttl, raising percentages below the lowest duty to it,
+// and OFF pushes a target of 0, which fan_limits and failsafes still raise;
+// ON clears the pushed target. A preset mode applies the preset to all fans,
+// and auto clears it. Commands are coalesced by override_debounce, and saved
+// to the state file, like those of the API.
+func (bridge *mqttBridge) command(message mqtt.Message) {
+	parts := strings.Split(strings.TrimPrefix(message.Topic,
+		bridge.topic()+"/"), "/")
+	zone, command := parts[0], strings.Join(parts[1:], "/")
+	payload := strings.TrimSpace(string(message.Payload))
+
+	if !bridge.server.Config().HasZone(zone) {
+		log.Printf("ERROR mqtt command of unknown zone: %s", zone)
+		return
+	}
+
+	switch command {
+	case "set":
+		switch payload {
+		case mqttOn:
+			log.Printf("INFO mqtt turning on zone: %s", zone)
+			bridge.server.clearTarget(zone)
+		case mqttOff:
+			log.Printf("INFO mqtt turning off zone: %s", zone)
+			bridge.server.pushTarget(zone, 0, bridge.ttl())
+		default:
+			log.Printf("ERROR mqtt bad state of zone %s: %s", zone, payload)
+		}
+
+	case "percentage/set":
+		rpm, err := strconv.Atoi(payload)
+		if err != nil || rpm < 0 || rpm > controller.GridMaxFanRPM {
+			log.Printf("ERROR mqtt bad percentage of zone %s: %s", zone,
+				payload)
+			return
+		}
+
+		// Home Assistant sliders go below the lowest duty of the controller
+		if rpm != 0 && rpm < controller.GridMinFanRPM {
+			log.Printf("INFO mqtt raising percentage of zone %s from: %d to: %d",
+				zone, rpm, controller.GridMinFanRPM)
+			rpm = controller.GridMinFanRPM
+		}
+		log.Printf("INFO mqtt pushing zone %s target: %d", zone, rpm)
+		bridge.server.pushTarget(zone, rpm, bridge.ttl())
+
+	case "preset_mode/set":
+		if payload == mqttPresetAuto {
+			bridge.server.clearPreset()
+		} else if _, ok := bridge.server.applyPreset(payload); !ok {
+			log.Printf("ERROR mqtt unknown preset: %s", payload)
+		}
+	}
+}
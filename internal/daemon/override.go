@@ -0,0 +1,70 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/config"
+	"sync"
+	"time"
+)
+
+// overrides holds the current override, if any
+type overrides struct {
+	mutex   sync.Mutex
+	current *Override
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Override of preset from now. A preset without TTL does not expire.
+func newOverride(name string, preset config.Preset) *Override {
+	override := &Override{Preset: name, Fans: preset.Fans}
+	if preset.TTL > 0 {
+		until := time.Now().Add(time.Duration(preset.TTL) * time.Second)
+		override.Until = &until
+	}
+	return override
+}
+
+// Set override
+func (overrides *overrides) Set(override *Override) {
+	overrides.mutex.Lock()
+	defer overrides.mutex.Unlock()
+	overrides.current = override
+}
+
+// Clear override
+func (overrides *overrides) Clear() {
+	overrides.mutex.Lock()
+	defer overrides.mutex.Unlock()
+	overrides.current = nil
+}
+
+// Get current override, or nil if none or expired
+func (overrides *overrides) Get() *Override {
+	overrides.mutex.Lock()
+	defer overrides.mutex.Unlock()
+
+	override := overrides.current
+	if override != nil && override.Until != nil &&
+		time.Now().After(*override.Until) {
+		overrides.current = nil
+		return nil
+	}
+
+	return override
+}
@@ -0,0 +1,157 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Name of the override file requests, once taken by the daemon
+const overrideFileTaken = ".taken"
+
+// Take the request of the override file at path, if any. The file is renamed
+// before it is read, so that a request written meanwhile is read on the next
+// cycle, instead of removed unread. Returns false if there is no request.
+func takeOverrideFile(path string) (string, bool, error) {
+	taken := path + overrideFileTaken
+	if err := os.Rename(path, taken); os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	contents, err := ioutil.ReadFile(taken)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := os.Remove(taken); err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimSpace(string(contents)), true, nil
+}
+
+// Parse override file request: clear, or FAN=DUTY pairs of fan numbers or
+// aliases, an optional preset=NAME whose fans they add to, and an optional
+// ttl=SECONDS. Returns a nil override for clear.
+func parseOverrideRequest(config config.Config,
+	request string) (*Override, error) {
+
+	if request == "clear" {
+		return nil, nil
+	}
+
+	preset := overrideFilePreset
+	name := overrideFileName
+	fans := map[int]int{}
+	chain := config.Controller()
+	for _, field := range strings.Fields(request) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("parseOverrideRequest: Bad field: %s", field)
+		}
+		key, value := parts[0], parts[1]
+
+		switch key {
+		case "preset":
+			named, ok := config.Presets[value]
+			if !ok {
+				return nil, fmt.Errorf(
+					"parseOverrideRequest: Unknown preset: %s", value)
+			}
+			for fan, rpm := range named.Fans {
+				if _, ok := fans[fan]; !ok {
+					fans[fan] = rpm
+				}
+			}
+			if preset.TTL == 0 {
+				preset.TTL = named.TTL
+			}
+			name = value
+
+		case "ttl":
+			ttl, err := strconv.Atoi(value)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("parseOverrideRequest: Bad ttl: %s",
+					value)
+			}
+			preset.TTL = ttl
+
+		default:
+			fan, err := config.Fan(key)
+			if err != nil || !chain.IsValidFan(fan) {
+				return nil, fmt.Errorf("parseOverrideRequest: Bad fan: %s",
+					key)
+			}
+			rpm, err := strconv.Atoi(value)
+			if err != nil || !chain.IsValidRPM(rpm) {
+				return nil, fmt.Errorf("parseOverrideRequest: Bad duty: %s",
+					value)
+			}
+			fans[fan] = rpm
+		}
+	}
+
+	if len(fans) == 0 {
+		return nil, fmt.Errorf("parseOverrideRequest: No fans in: %s", request)
+	}
+
+	if preset.TTL == 0 {
+		preset.TTL = config.OverrideTTL
+	}
+	preset.Fans = fans
+	return newOverride(name, preset), nil
+}
+
+// Preset of override file requests, before the preset and ttl fields
+var overrideFilePreset = config.Preset{}
+
+// Name of override file requests of fans, without a preset
+const overrideFileName = config.OverrideFilePreset
+
+// Apply the request of the override file, if any
+func (loop *loop) readOverrideFile() {
+	request, ok, err := takeOverrideFile(loop.config.OverrideFile)
+	if err != nil {
+		log.Printf("ERROR failed to read override file: %v", err)
+		return
+	} else if !ok {
+		return
+	}
+
+	override, err := parseOverrideRequest(loop.config, request)
+	if err != nil {
+		log.Printf("ERROR bad override file request: %v", err)
+		return
+	}
+
+	if override == nil {
+		log.Printf("INFO clearing override from override file")
+		loop.server.overrides.Clear()
+	} else {
+		log.Printf("INFO applying override file: %s", request)
+		loop.server.overrides.Set(override)
+	}
+	loop.server.saveState()
+}
@@ -0,0 +1,105 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/config"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOverrideRequest(t *testing.T) {
+	cfg := config.Config{
+		OverrideTTL: 600,
+		FanAliases:  map[int]string{4: "rear"},
+		Presets: map[string]config.Preset{
+			"quiet": {Fans: map[int]int{1: 20, 2: 30}, TTL: 60},
+			"night": {Fans: map[int]int{3: 40}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		preset  string
+		fans    map[int]int
+		ttl     int
+		err     bool
+	}{
+		{"fans", "1=50 rear=80", overrideFileName,
+			map[int]int{1: 50, 4: 80}, 600, false},
+		{"ttl", "ttl=30 2=40", overrideFileName,
+			map[int]int{2: 40}, 30, false},
+		{"preset ttl", "preset=quiet", "quiet",
+			map[int]int{1: 20, 2: 30}, 60, false},
+		{"preset fans first", "1=90 preset=quiet", "quiet",
+			map[int]int{1: 90, 2: 30}, 60, false},
+		{"preset fans last", "preset=quiet 1=90", "quiet",
+			map[int]int{1: 90, 2: 30}, 60, false},
+		{"ttl before preset", "ttl=5 preset=quiet", "quiet",
+			map[int]int{1: 20, 2: 30}, 5, false},
+		{"ttl after preset", "preset=quiet ttl=5", "quiet",
+			map[int]int{1: 20, 2: 30}, 5, false},
+		{"preset without ttl", "preset=night 4=60", "night",
+			map[int]int{3: 40, 4: 60}, 600, false},
+		{"unknown preset", "preset=loud", "", nil, 0, true},
+		{"bad ttl", "1=50 ttl=0", "", nil, 0, true},
+		{"bad fan", "7=50", "", nil, 0, true},
+		{"bad alias", "front=50", "", nil, 0, true},
+		{"bad duty", "1=101", "", nil, 0, true},
+		{"bad field", "1", "", nil, 0, true},
+		{"no fans", "ttl=30", "", nil, 0, true},
+	}
+
+	for _, test := range tests {
+		override, err := parseOverrideRequest(cfg, test.request)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", test.name, override)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if override.Preset != test.preset {
+			t.Errorf("%s: preset = %s, expected %s", test.name,
+				override.Preset, test.preset)
+		}
+		if !reflect.DeepEqual(override.Fans, test.fans) {
+			t.Errorf("%s: fans = %v, expected %v", test.name, override.Fans,
+				test.fans)
+		}
+		if override.Until == nil {
+			t.Errorf("%s: expected ttl of %d, got none", test.name, test.ttl)
+		} else if ttl := int(math.Round(time.Until(
+			*override.Until).Seconds())); ttl != test.ttl {
+			t.Errorf("%s: ttl = %d, expected %d", test.name, ttl, test.ttl)
+		}
+	}
+}
+
+func TestParseOverrideRequestClear(t *testing.T) {
+	override, err := parseOverrideRequest(config.Config{}, "clear")
+	if override != nil || err != nil {
+		t.Errorf("clear = %+v, %v, expected nil override", override, err)
+	}
+}
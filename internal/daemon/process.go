@@ -0,0 +1,78 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/disk"
+	"github.com/cybojanek/gridfan/internal/sensor"
+	"sort"
+	"sync"
+)
+
+// processStats of the daemon process
+type processStats struct {
+	CPUSeconds    float64
+	ResidentBytes int64
+}
+
+// Commands run by the daemon itself, such as hooks, by kind
+var daemonCommands = struct {
+	mutex sync.Mutex
+	runs  map[string]uint64
+}{runs: map[string]uint64{}}
+
+// Count a command of kind run by the daemon
+func countCommand(kind string) {
+	daemonCommands.mutex.Lock()
+	defer daemonCommands.mutex.Unlock()
+	daemonCommands.runs[kind]++
+}
+
+// Runs of all subprocesses since start, by command: disk commands by their
+// name, exec sensors as sensor, and the commands of the daemon by kind
+func commandRuns() map[string]uint64 {
+	runs := disk.CommandRuns()
+	if execRuns := sensor.ExecRuns(); execRuns != 0 {
+		runs["sensor"] = execRuns
+	}
+
+	daemonCommands.mutex.Lock()
+	defer daemonCommands.mutex.Unlock()
+	for kind, count := range daemonCommands.runs {
+		runs[kind] += count
+	}
+	return runs
+}
+
+// Total of command runs
+func totalRuns(runs map[string]uint64) uint64 {
+	total := uint64(0)
+	for _, count := range runs {
+		total += count
+	}
+	return total
+}
+
+// Sorted command names of runs
+func runNames(runs map[string]uint64) []string {
+	names := []string{}
+	for name := range runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
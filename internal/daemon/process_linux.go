@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Process stat file, and the clock ticks per second of its cpu times, which
+// is 100 on all Linux architectures in practice
+var (
+	procSelfStat  = "/proc/self/stat"
+	procClockTick = 100.0
+)
+
+// Read stats of the daemon process from procfs
+func readProcessStats() (processStats, error) {
+	contents, err := ioutil.ReadFile(procSelfStat)
+	if err != nil {
+		return processStats{}, err
+	}
+
+	// Fields after the command name, which is in parentheses and may
+	// contain spaces: state is field 3, utime 14, stime 15 and rss 24
+	stat := string(contents)
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return processStats{}, fmt.Errorf(
+			"readProcessStats: Malformed %s", procSelfStat)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return processStats{}, fmt.Errorf(
+			"readProcessStats: Malformed %s", procSelfStat)
+	}
+
+	values := []int64{}
+	for _, field := range []string{fields[11], fields[12], fields[21]} {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return processStats{}, fmt.Errorf("readProcessStats: %v", err)
+		}
+		values = append(values, value)
+	}
+
+	return processStats{
+		CPUSeconds:    float64(values[0]+values[1]) / procClockTick,
+		ResidentBytes: values[2] * int64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+)
+
+// Read stats of the daemon process, which are only read on Linux
+func readProcessStats() (processStats, error) {
+	return processStats{}, fmt.Errorf(
+		"readProcessStats: Process stats are only supported on Linux")
+}
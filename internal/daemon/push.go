@@ -0,0 +1,102 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pushedTargets holds the pushed targets by zone name
+type pushedTargets struct {
+	mutex   sync.Mutex
+	targets map[string]PushedTarget
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Set pushed target of zone, for timeout
+func (pushed *pushedTargets) Set(zone string, rpm int,
+	timeout time.Duration) PushedTarget {
+
+	target := PushedTarget{RPM: rpm, Until: time.Now().Add(timeout)}
+
+	pushed.mutex.Lock()
+	defer pushed.mutex.Unlock()
+
+	if pushed.targets == nil {
+		pushed.targets = map[string]PushedTarget{}
+	}
+	pushed.targets[zone] = target
+
+	return target
+}
+
+// Clear pushed target of zone
+func (pushed *pushedTargets) Clear(zone string) {
+	pushed.mutex.Lock()
+	defer pushed.mutex.Unlock()
+	delete(pushed.targets, zone)
+}
+
+// Get pushed target of zone, if any and not expired
+func (pushed *pushedTargets) Get(zone string) (PushedTarget, bool) {
+	pushed.mutex.Lock()
+	defer pushed.mutex.Unlock()
+
+	target, ok := pushed.targets[zone]
+	if ok && time.Now().After(target.Until) {
+		delete(pushed.targets, zone)
+		return target, false
+	}
+
+	return target, ok
+}
+
+// All pushed targets, without expired ones
+func (pushed *pushedTargets) All() map[string]PushedTarget {
+	pushed.mutex.Lock()
+	defer pushed.mutex.Unlock()
+
+	result := map[string]PushedTarget{}
+	for zone, target := range pushed.targets {
+		if time.Now().After(target.Until) {
+			delete(pushed.targets, zone)
+			continue
+		}
+		result[zone] = target
+	}
+
+	return result
+}
+
+// Apply pushed target of zone, if any, to the zone decision. Errors and panic
+// temperatures still raise the pushed target, as failsafes.
+func (pushed *pushedTargets) Apply(zone string, target decision) decision {
+	pushedTarget, ok := pushed.Get(zone)
+	if !ok {
+		return target
+	}
+
+	if target.RPM >= pushedTarget.RPM && target.Failsafe {
+		return target
+	}
+
+	return decision{RPM: pushedTarget.RPM, Reason: fmt.Sprintf(
+		"pushed until %s", pushedTarget.Until.Format("15:04:05"))}
+}
@@ -0,0 +1,126 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"sync"
+)
+
+// Command priorities, from lowest to highest
+const (
+	// Routine curve, zone and constant fan updates
+	priorityRoutine = iota
+
+	// Full speed and preset overrides, which must not wait behind a slow
+	// batch of routine updates
+	priorityEmergency
+)
+
+// command to set a fan, with the change to record once set
+type command struct {
+	fan      FanStatus
+	change   Change
+	priority int
+	sequence int
+}
+
+// commandQueue of fan commands in front of the controller. Commands are
+// popped by priority, and in order of pushing within a priority. A command
+// replaces the queued command of the same fan.
+type commandQueue struct {
+	mutex    sync.Mutex
+	commands []command
+	sequence int
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Push command, replacing the queued command of its fan, if any
+func (queue *commandQueue) Push(fan FanStatus, change Change, priority int) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.sequence++
+	pushed := command{fan: fan, change: change, priority: priority,
+		sequence: queue.sequence}
+
+	for i := range queue.commands {
+		if queue.commands[i].fan.Fan == fan.Fan {
+			queue.commands[i] = pushed
+			return
+		}
+	}
+	queue.commands = append(queue.commands, pushed)
+}
+
+// Pop the next command, if any
+func (queue *commandQueue) Pop() (command, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if len(queue.commands) == 0 {
+		return command{}, false
+	}
+
+	next := 0
+	for i, queued := range queue.commands {
+		if queued.priority > queue.commands[next].priority ||
+			(queued.priority == queue.commands[next].priority &&
+				queued.sequence < queue.commands[next].sequence) {
+			next = i
+		}
+	}
+
+	popped := queue.commands[next]
+	queue.commands = append(queue.commands[:next], queue.commands[next+1:]...)
+	return popped, true
+}
+
+// Clear queued commands
+func (queue *commandQueue) Clear() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.commands = nil
+}
+
+// Len of queue
+func (queue *commandQueue) Len() int {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	return len(queue.commands)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Priority of setting fan from its applied rpm, if any: preset overrides and
+// raising a fan to full speed, such as on panic temp or errors, are
+// emergencies
+func commandPriority(fan FanStatus, applied map[int]int,
+	override *Override) int {
+
+	if override != nil {
+		if _, ok := override.Fans[fan.Fan]; ok {
+			return priorityEmergency
+		}
+	}
+
+	if rpm, ok := applied[fan.Fan]; fan.RPM == 100 && (!ok || rpm < 100) {
+		return priorityEmergency
+	}
+
+	return priorityRoutine
+}
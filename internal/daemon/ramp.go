@@ -0,0 +1,142 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"math"
+	"time"
+)
+
+// ramp eases the target of a zone from its previous value to a new one over
+// a time, instead of stepping to it, so that large slow fans change speed
+// less perceptibly. Emergencies, and fans starting or stopping, are not eased.
+type ramp struct {
+	duration time.Duration
+	easing   string
+
+	// Value ramped from and to, and the value of the last cycle, which is
+	// the percent of relative decisions, or the rpm otherwise
+	from     int
+	to       int
+	current  int
+	relative bool
+	start    time.Time
+	started  bool
+}
+
+// Create ramps of zones with a ramp time, by zone name
+func newRamps(config config.Config) map[string]*ramp {
+	ramps := map[string]*ramp{}
+	if config.DiskCurve.Ramp.Time != 0 {
+		ramps[disksZone] = newRamp(config.DiskCurve.Ramp)
+	}
+	for _, zone := range config.Zones {
+		if zone.Ramp.Time != 0 {
+			ramps[zone.Name] = newRamp(zone.Ramp)
+		}
+	}
+	return ramps
+}
+
+// Create ramp of config
+func newRamp(rampConfig config.Ramp) *ramp {
+	easing := rampConfig.Easing
+	if len(easing) == 0 {
+		easing = config.EasingLinear
+	}
+	return &ramp{duration: time.Duration(rampConfig.Time) * time.Second,
+		easing: easing}
+}
+
+// Apply ramp to target at now, and return the eased target
+func (ramp *ramp) Apply(target decision, now time.Time) decision {
+	if ramp == nil {
+		return target
+	}
+
+	value, relative := target.RPM, target.Percent != nil
+	if relative {
+		value = *target.Percent
+	}
+
+	stopped := !relative && (value == 0 || ramp.current == 0)
+	if !ramp.started || target.Failsafe || relative != ramp.relative ||
+		stopped {
+		ramp.from, ramp.to, ramp.current = value, value, value
+		ramp.relative = relative
+		ramp.start = now
+		ramp.started = true
+		return target
+	}
+
+	// Start a new ramp from where the last one got to
+	if value != ramp.to {
+		ramp.from = ramp.current
+		ramp.to = value
+		ramp.start = now
+	}
+
+	progress := float64(now.Sub(ramp.start)) / float64(ramp.duration)
+	if progress > 1 {
+		progress = 1
+	}
+	ramp.current = ramp.from + int(math.Round(
+		float64(ramp.to-ramp.from)*ease(ramp.easing, progress)))
+	if ramp.current == ramp.to {
+		return target
+	}
+
+	target.Reason = fmt.Sprintf("%s, %s ramp to %s", target.Reason,
+		ramp.easing, config.FormatRPM(ramp.to, relative))
+	if !relative {
+		target.RPM = ramp.current
+		return target
+	}
+	percent := ramp.current
+	target.RPM = config.Resolve(percent, 20, 100)
+	target.Percent = &percent
+	return target
+}
+
+// Resume progress of previous ramp of the zone, if any, with the time and
+// easing of this ramp
+func (ramp *ramp) Resume(previous *ramp) {
+	if previous == nil {
+		return
+	}
+	ramp.from, ramp.to, ramp.current = previous.from, previous.to,
+		previous.current
+	ramp.relative = previous.relative
+	ramp.start = previous.start
+	ramp.started = previous.started
+}
+
+// Eased fraction of progress in [0, 1]: linear moves evenly, smoothstep
+// starts and ends slowly, and exponential moves quickly at first and
+// settles slowly.
+func ease(easing string, progress float64) float64 {
+	switch easing {
+	case config.EasingSmoothstep:
+		return progress * progress * (3 - 2*progress)
+	case config.EasingExponential:
+		return (1 - math.Pow(2, -10*progress)) / (1 - math.Pow(2, -10))
+	default:
+		return progress
+	}
+}
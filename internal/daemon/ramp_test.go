@@ -0,0 +1,144 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/cybojanek/gridfan/internal/config"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEase(t *testing.T) {
+	tests := []struct {
+		easing   string
+		progress float64
+		expected float64
+	}{
+		{config.EasingLinear, 0, 0},
+		{config.EasingLinear, 0.25, 0.25},
+		{config.EasingLinear, 1, 1},
+		{config.EasingSmoothstep, 0, 0},
+		{config.EasingSmoothstep, 0.25, 0.15625},
+		{config.EasingSmoothstep, 0.5, 0.5},
+		{config.EasingSmoothstep, 1, 1},
+		{config.EasingExponential, 0, 0},
+		{config.EasingExponential, 0.5, 0.96969697},
+		{config.EasingExponential, 1, 1},
+	}
+
+	for _, test := range tests {
+		if eased := ease(test.easing, test.progress); math.Abs(
+			eased-test.expected) > 1e-6 {
+			t.Errorf("%s: ease(%v) = %v, expected %v", test.easing,
+				test.progress, eased, test.expected)
+		}
+	}
+}
+
+func TestRampApply(t *testing.T) {
+	// Target at seconds after the start, and the rpm it is eased to
+	type step struct {
+		seconds  int
+		target   decision
+		expected int
+	}
+	percent := func(value int) decision {
+		return decision{RPM: config.Resolve(value, 20, 100), Percent: &value}
+	}
+
+	tests := []struct {
+		name   string
+		easing string
+		steps  []step
+	}{
+		{"linear", config.EasingLinear, []step{
+			{0, decision{RPM: 40}, 40},
+			{0, decision{RPM: 100}, 40},
+			{15, decision{RPM: 100}, 55},
+			{30, decision{RPM: 100}, 70},
+			{60, decision{RPM: 100}, 100},
+			{120, decision{RPM: 100}, 100},
+		}},
+		{"smoothstep", config.EasingSmoothstep, []step{
+			{0, decision{RPM: 40}, 40},
+			{0, decision{RPM: 100}, 40},
+			{15, decision{RPM: 100}, 49},
+			{30, decision{RPM: 100}, 70},
+			{60, decision{RPM: 100}, 100},
+		}},
+		{"exponential", config.EasingExponential, []step{
+			{0, decision{RPM: 40}, 40},
+			{0, decision{RPM: 100}, 40},
+			{15, decision{RPM: 100}, 89},
+			{30, decision{RPM: 100}, 98},
+			{60, decision{RPM: 100}, 100},
+		}},
+		{"down", config.EasingLinear, []step{
+			{0, decision{RPM: 100}, 100},
+			{0, decision{RPM: 40}, 100},
+			{30, decision{RPM: 40}, 70},
+			{60, decision{RPM: 40}, 40},
+		}},
+		{"new target from current", config.EasingLinear, []step{
+			{0, decision{RPM: 40}, 40},
+			{0, decision{RPM: 100}, 40},
+			{30, decision{RPM: 100}, 70},
+			{30, decision{RPM: 40}, 70},
+			{45, decision{RPM: 40}, 62},
+			{90, decision{RPM: 40}, 40},
+		}},
+		{"failsafe", config.EasingLinear, []step{
+			{0, decision{RPM: 40}, 40},
+			{10, decision{RPM: 100, Failsafe: true}, 100},
+			{20, decision{RPM: 40}, 100},
+			{50, decision{RPM: 40}, 70},
+		}},
+		{"stop and start", config.EasingLinear, []step{
+			{0, decision{RPM: 40}, 40},
+			{10, decision{RPM: 0}, 0},
+			{20, decision{RPM: 60}, 60},
+		}},
+		{"relative", config.EasingLinear, []step{
+			{0, percent(0), 20},
+			{0, percent(100), 20},
+			{30, percent(100), 60},
+			{40, decision{RPM: 40}, 40},
+		}},
+	}
+
+	start := time.Now()
+	for _, test := range tests {
+		ramp := newRamp(config.Ramp{Time: 60, Easing: test.easing})
+		for i, step := range test.steps {
+			now := start.Add(time.Duration(step.seconds) * time.Second)
+			if rpm := ramp.Apply(step.target, now).RPM; rpm != step.expected {
+				t.Errorf("%s: step %d rpm = %d, expected %d", test.name, i,
+					rpm, step.expected)
+			}
+		}
+	}
+}
+
+// Zones without a ramp time have no ramp, which does not ease
+func TestRampNil(t *testing.T) {
+	var ramp *ramp
+	target := decision{RPM: 60}
+	if eased := ramp.Apply(target, time.Now()); eased.RPM != target.RPM {
+		t.Errorf("nil ramp Apply = %d, expected %d", eased.RPM, target.RPM)
+	}
+}
@@ -0,0 +1,158 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// thermalRunaway detects zones whose temperature keeps rising while all of
+// their fans are at 100, since more airflow can not help at that point
+type thermalRunaway struct {
+	cycles  int
+	command []string
+	fans    map[string][]int
+	last    map[string]int
+	rising  map[string]int
+	reached map[string]bool
+}
+
+// Create thermal runaway detection of config zones
+func newThermalRunaway(config config.Config) *thermalRunaway {
+	fans := map[string][]int{}
+	for fan, zone := range fanZones(config) {
+		fans[zone] = append(fans[zone], fan)
+	}
+
+	return &thermalRunaway{
+		cycles:  config.ThermalRunaway.Cycles,
+		command: config.ThermalRunaway.Command,
+		fans:    fans,
+		last:    map[string]int{},
+		rising:  map[string]int{},
+		reached: map[string]bool{},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Resume counts and alerts of previous thermal runaway detection, for zones
+// which still have fans
+func (runaway *thermalRunaway) Resume(previous *thermalRunaway) {
+	for zone := range runaway.fans {
+		if last, ok := previous.last[zone]; ok {
+			runaway.last[zone] = last
+		}
+		if rising, ok := previous.rising[zone]; ok {
+			runaway.rising[zone] = rising
+		}
+		if previous.reached[zone] {
+			runaway.reached[zone] = true
+		}
+	}
+}
+
+// Evaluate zone temperature with the applied fan rpms of the last cycle.
+// Counts cycles in which the temperature rose while all zone fans were at
+// 100, and raises the alert once cycles are reached. A steady temperature
+// keeps the count, and a falling temperature, or slower fans, clear it.
+// Returns whether the zone is in thermal runaway.
+func (runaway *thermalRunaway) Evaluate(zone ZoneStatus,
+	applied map[int]int, events *eventLog) bool {
+
+	if runaway.cycles == 0 {
+		return false
+	}
+
+	fans := runaway.fans[zone.Name]
+	atFull := len(fans) != 0 && zone.Temperature != nil
+	for _, fan := range fans {
+		if rpm, ok := applied[fan]; !ok || rpm != 100 {
+			atFull = false
+		}
+	}
+
+	if !atFull {
+		runaway.clear(zone.Name)
+		return false
+	}
+
+	temperature := *zone.Temperature
+	last, ok := runaway.last[zone.Name]
+	runaway.last[zone.Name] = temperature
+	if !ok {
+		return runaway.reached[zone.Name]
+	}
+
+	if temperature < last {
+		runaway.clear(zone.Name)
+		runaway.last[zone.Name] = temperature
+		return false
+	} else if temperature > last {
+		runaway.rising[zone.Name]++
+	}
+
+	if runaway.rising[zone.Name] >= runaway.cycles &&
+		!runaway.reached[zone.Name] {
+
+		runaway.reached[zone.Name] = true
+		runaway.raise(zone.Name, temperature, events)
+	}
+
+	return runaway.reached[zone.Name]
+}
+
+// Clear count and alert of zone
+func (runaway *thermalRunaway) clear(zone string) {
+	if runaway.reached[zone] {
+		log.Printf("INFO zone %s thermal runaway cleared", zone)
+	}
+	delete(runaway.last, zone)
+	delete(runaway.rising, zone)
+	delete(runaway.reached, zone)
+}
+
+// Raise alert of zone, and run the command, if any
+func (runaway *thermalRunaway) raise(zone string, temperature int,
+	events *eventLog) {
+
+	log.Printf("WARNING zone %s thermal runaway: temperature %d still rising "+
+		"after %d cycles at 100", zone, temperature, runaway.cycles)
+	events.Write(Event{Type: EventRunaway, Zone: zone,
+		Message: fmt.Sprintf("rising at %d°C with fans at 100",
+			temperature)})
+
+	if len(runaway.command) == 0 {
+		return
+	}
+
+	countCommand("thermal_runaway")
+	command := exec.Command(runaway.command[0], runaway.command[1:]...)
+	command.Env = append(os.Environ(),
+		"GRIDFAN_ZONE="+zone,
+		fmt.Sprintf("GRIDFAN_TEMPERATURE=%d", temperature))
+	go func() {
+		if output, err := command.CombinedOutput(); err != nil {
+			log.Printf("ERROR thermal runaway command failed: %v: %s", err,
+				output)
+		}
+	}()
+}
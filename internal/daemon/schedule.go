@@ -0,0 +1,55 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Random delay in [0, jitter) before the first cycle, so that daemons of
+// hosts starting together, such as after a power outage, do not all spin up
+// their fans at once
+func startDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(startRandom().Int63n(int64(jitter)))
+}
+
+// Random source of start delays
+var startRandom = func() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// Wait from now until the next cycle of interval at phase: the cycles run
+// when the wall clock time modulo interval is phase, so that daemons of
+// hosts with different phases poll, and change fan speeds, at different
+// times
+func phaseWait(now time.Time, interval time.Duration,
+	phase time.Duration) time.Duration {
+
+	if interval <= 0 {
+		return interval
+	}
+
+	next := now.Truncate(interval).Add(phase % interval)
+	for !next.After(now) {
+		next = next.Add(interval)
+	}
+	return next.Sub(now)
+}
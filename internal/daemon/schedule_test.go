@@ -0,0 +1,99 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStartDelay(t *testing.T) {
+	defer func(previous func() *rand.Rand) {
+		startRandom = previous
+	}(startRandom)
+
+	for _, jitter := range []time.Duration{-time.Second, 0} {
+		if delay := startDelay(jitter); delay != 0 {
+			t.Errorf("startDelay(%v) = %v, expected 0", jitter, delay)
+		}
+	}
+
+	jitter := 30 * time.Second
+	for seed := int64(0); seed < 100; seed++ {
+		startRandom = func() *rand.Rand {
+			return rand.New(rand.NewSource(seed))
+		}
+		expected := time.Duration(rand.New(rand.NewSource(seed)).Int63n(
+			int64(jitter)))
+
+		delay := startDelay(jitter)
+		if delay != expected {
+			t.Errorf("seed %d: startDelay = %v, expected %v", seed, delay,
+				expected)
+		}
+		if delay < 0 || delay >= jitter {
+			t.Errorf("seed %d: startDelay = %v, not in [0, %v)", seed, delay,
+				jitter)
+		}
+	}
+
+	// Hosts started together spread their delays
+	startRandom = func() *rand.Rand { return rand.New(rand.NewSource(1)) }
+	first := startDelay(jitter)
+	startRandom = func() *rand.Rand { return rand.New(rand.NewSource(2)) }
+	if second := startDelay(jitter); first == second {
+		t.Errorf("startDelay of seeds 1 and 2 = %v, expected different", first)
+	}
+}
+
+func TestPhaseWait(t *testing.T) {
+	minute := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time {
+		return minute.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		phase    time.Duration
+		expected time.Duration
+	}{
+		{"before phase", at(0), time.Minute, 15 * time.Second,
+			15 * time.Second},
+		{"just before phase", at(14.5), time.Minute, 15 * time.Second,
+			500 * time.Millisecond},
+		{"at phase", at(15), time.Minute, 15 * time.Second, time.Minute},
+		{"after phase", at(50), time.Minute, 15 * time.Second,
+			25 * time.Second},
+		{"phase above interval", at(50), time.Minute, 75 * time.Second,
+			25 * time.Second},
+		{"zero phase", at(20), time.Minute, 0, 40 * time.Second},
+		{"short interval", at(7), 5 * time.Second, 1 * time.Second,
+			4 * time.Second},
+		{"no interval", at(7), 0, 15 * time.Second, 0},
+	}
+
+	for _, test := range tests {
+		if wait := phaseWait(test.now, test.interval,
+			test.phase); wait != test.expected {
+			t.Errorf("%s: phaseWait = %v, expected %v", test.name, wait,
+				test.expected)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/simulator"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Config of a zone of fans 1 and 2 on a simulated controller at address,
+// whose sensor reads the file at path
+const simulatedConfig = `serial_device_path: tcp://%s
+zones:
+  - name: case
+    sensor: room
+    fans: [1, 2]
+    points: [{temp: 0, rpm: 30}, {temp: 40, rpm: 60}]
+sensors:
+  room: {type: file, path: %s}
+`
+
+// Serve simulator on a local address, until the listener is closed
+func serveSimulator(t *testing.T, sim *simulator.Simulator) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sim.Serve(conn)
+			}()
+		}
+	}()
+
+	return listener
+}
+
+// Daemon cycles against a simulated controller, whose faults are retried on
+// the next cycle, and which still receives the failsafe of a lost sensor
+func TestSimulatedFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gridfan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	setSpeed := func(action string) simulator.Fault {
+		return simulator.Fault{Command: simulator.CommandSetSpeed, Fan: 1,
+			Every: 1, Limit: 1, Action: action, Delay: 200 * time.Millisecond}
+	}
+
+	// The faults are in the replies, so the fans are always at duty, but a
+	// failed command is not applied, and is sent again on the next cycle
+	tests := []struct {
+		name       string
+		faults     []simulator.Fault
+		sensorLost bool
+		duty       int
+
+		// State, and whether fan 1 was applied, after the first cycle
+		firstState   string
+		firstApplied bool
+
+		// State after the second cycle
+		state string
+	}{
+		{"no faults", nil, false, 30, StateOK, true, StateOK},
+		{"drop", []simulator.Fault{setSpeed(simulator.ActionDrop)}, false,
+			30, StateControllerLost, false, StateOK},
+		{"corrupt", []simulator.Fault{setSpeed(simulator.ActionCorrupt)},
+			false, 30, StateControllerLost, false, StateOK},
+		{"delay", []simulator.Fault{setSpeed(simulator.ActionDelay)}, false,
+			30, StateOK, true, StateOK},
+		{"failsafe", nil, true, 100, StateFailsafe, true, StateFailsafe},
+		{"failsafe corrupt", []simulator.Fault{
+			setSpeed(simulator.ActionCorrupt)}, true, 100,
+			StateControllerLost, false, StateFailsafe},
+	}
+
+	for _, test := range tests {
+		sim := simulator.New()
+		sim.Scenario = simulator.Scenario{Faults: test.faults}
+		listener := serveSimulator(t, sim)
+
+		path := filepath.Join(dir, "room")
+		os.Remove(path)
+		if !test.sensorLost {
+			if err := ioutil.WriteFile(path, []byte("30\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		configPath := filepath.Join(dir, "config.yaml")
+		if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(
+			simulatedConfig, listener.Addr(), path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := config.Read(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := &statusServer{started: time.Now()}
+		server.SetConfig(cfg)
+		loop := newLoop(cfg, server, nil, nil, nil)
+
+		for cycle, expected := range []struct {
+			state   string
+			applied bool
+		}{{test.firstState, test.firstApplied}, {test.state, true}} {
+			loop.cycle()
+			if state := server.Get().State; state != expected.state {
+				t.Errorf("%s: cycle %d state = %s, expected %s", test.name,
+					cycle, state, expected.state)
+			}
+			if _, applied := loop.applied[1]; applied != expected.applied {
+				t.Errorf("%s: cycle %d fan 1 applied = %v, expected %v",
+					test.name, cycle, applied, expected.applied)
+			}
+			for _, fan := range []int{1, 2} {
+				if duty := sim.Duty(fan); duty != test.duty {
+					t.Errorf("%s: cycle %d fan %d duty = %d, expected %d",
+						test.name, cycle, fan, duty, test.duty)
+				}
+			}
+		}
+
+		listener.Close()
+	}
+}
@@ -0,0 +1,143 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"github.com/cybojanek/gridfan/internal/config"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// savedState of the manual overrides of the daemon, so that a restart does
+// not drop them
+type savedState struct {
+	Override      *Override               `json:"override,omitempty"`
+	DisabledZones map[string]*time.Time   `json:"disabled_zones,omitempty"`
+	PushedTargets map[string]PushedTarget `json:"pushed_targets,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Save manual overrides to the state file, if any. The file is written under
+// a temporary name, and renamed, so that it is never partially written.
+func (server *statusServer) saveState() {
+	path := server.Config().StateFile
+	if len(path) == 0 {
+		return
+	}
+
+	state := savedState{
+		Override:      server.overrides.Get(),
+		DisabledZones: server.disabled.Get(),
+		PushedTargets: server.pushed.All(),
+	}
+
+	contents, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("ERROR failed to save state: %v", err)
+		return
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), ".gridfan-state-*.tmp")
+	if err != nil {
+		log.Printf("ERROR failed to save state: %v", err)
+		return
+	}
+
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		log.Printf("ERROR failed to save state: %v", err)
+	}
+}
+
+// Load manual overrides from the state file, if any, dropping expired ones
+// and those of presets and zones no longer in the config. Must be called
+// before serving.
+func (server *statusServer) loadState() {
+	path := server.Config().StateFile
+	if len(path) == 0 {
+		return
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Printf("ERROR failed to load state: %v", err)
+		return
+	}
+
+	state := savedState{}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		log.Printf("ERROR failed to load state: %v", err)
+		return
+	}
+
+	now := time.Now()
+	if override := state.Override; override != nil && override.Until != nil &&
+		now.Before(*override.Until) {
+		// Override file requests are not config presets, and any request
+		// may have added fans to its preset, so restore the stored fans
+		_, ok := server.Config().Presets[override.Preset]
+		if (ok || override.Preset == config.OverrideFilePreset) &&
+			validFans(server.Config(), override.Fans) {
+			log.Printf("INFO restoring preset: %s until: %s", override.Preset,
+				override.Until.Format(time.RFC3339))
+			server.overrides.current = override
+		}
+	}
+
+	for name, until := range state.DisabledZones {
+		if until != nil && now.Before(*until) && server.Config().HasZone(name) {
+			log.Printf("INFO restoring disabled zone: %s until: %s", name,
+				until.Format(time.RFC3339))
+			server.disabled.Disable(name, until.Sub(now))
+		}
+	}
+
+	for name, target := range state.PushedTargets {
+		if now.Before(target.Until) && (server.Config().PushTargets ||
+			len(server.Config().MQTT.Broker) != 0) &&
+			server.Config().HasZone(name) {
+			log.Printf("INFO restoring pushed target of zone: %s until: %s",
+				name, target.Until.Format(time.RFC3339))
+			server.pushed.Set(name, target.RPM, target.Until.Sub(now))
+		}
+	}
+}
+
+// Check that fans and their rpms of a saved override are valid for config
+func validFans(config config.Config, fans map[int]int) bool {
+	chain := config.Controller()
+	for fan, rpm := range fans {
+		if !chain.IsValidFan(fan) || !chain.IsValidRPM(rpm) {
+			return false
+		}
+	}
+	return len(fans) != 0
+}
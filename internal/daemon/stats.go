@@ -0,0 +1,90 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// Duty ranges of fan time histograms, as labels
+const (
+	dutyOff    = "0"
+	dutyLow    = "20-40"
+	dutyMedium = "40-70"
+	dutyHigh   = "70-100"
+)
+
+// Duty range labels, in order
+var dutyRanges = []string{dutyOff, dutyLow, dutyMedium, dutyHigh}
+
+// dutyHistogram of seconds each fan spent in each duty range
+type dutyHistogram struct {
+	seconds map[int]map[string]float64
+	last    time.Time
+}
+
+// Create empty duty histogram
+func newDutyHistogram() *dutyHistogram {
+	return &dutyHistogram{seconds: map[int]map[string]float64{}}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// dutyRange label of rpm
+func dutyRange(rpm int) string {
+	switch {
+	case rpm == 0:
+		return dutyOff
+	case rpm < 40:
+		return dutyLow
+	case rpm < 70:
+		return dutyMedium
+	default:
+		return dutyHigh
+	}
+}
+
+// Add time since the last call to the duty range of each fan's applied rpm
+func (histogram *dutyHistogram) Add(applied map[int]int, now time.Time) {
+	if !histogram.last.IsZero() {
+		elapsed := now.Sub(histogram.last).Seconds()
+		for fan, rpm := range applied {
+			seconds, ok := histogram.seconds[fan]
+			if !ok {
+				seconds = map[string]float64{}
+				for _, label := range dutyRanges {
+					seconds[label] = 0
+				}
+				histogram.seconds[fan] = seconds
+			}
+			seconds[dutyRange(rpm)] += elapsed
+		}
+	}
+	histogram.last = now
+}
+
+// Get copy of seconds by fan, and duty range
+func (histogram *dutyHistogram) Get() map[int]map[string]float64 {
+	result := map[int]map[string]float64{}
+	for fan, seconds := range histogram.seconds {
+		result[fan] = map[string]float64{}
+		for label, value := range seconds {
+			result[fan][label] = value
+		}
+	}
+	return result
+}
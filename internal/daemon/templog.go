@@ -0,0 +1,59 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"log"
+)
+
+// temperatureLog of temperature lines, which only logs a line when its
+// temperature moved by at least delta since the last logged line, or every
+// line if delta is 0
+type temperatureLog struct {
+	delta int
+	last  map[string]int
+}
+
+// Create temperature log for delta
+func newTemperatureLog(delta int) *temperatureLog {
+	return &temperatureLog{delta: delta, last: map[string]int{}}
+}
+
+// Resume last logged temperatures of previous temperature log
+func (temperatureLog *temperatureLog) Resume(previous *temperatureLog) {
+	for name, temperature := range previous.last {
+		temperatureLog.last[name] = temperature
+	}
+}
+
+// Printf line of temperature, by name of what was measured
+func (temperatureLog *temperatureLog) Printf(name string, temperature int,
+	format string, v ...interface{}) {
+
+	if last, ok := temperatureLog.last[name]; ok && temperatureLog.delta > 0 {
+		change := temperature - last
+		if change < 0 {
+			change = -change
+		}
+		if change < temperatureLog.delta {
+			return
+		}
+	}
+
+	temperatureLog.last[name] = temperature
+	log.Printf(format, v...)
+}
@@ -0,0 +1,141 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// zoneThresholds of a zone temperature, and which of them are reached
+type zoneThresholds struct {
+	zone       string
+	thresholds map[string]config.Threshold
+	reached    map[string]bool
+}
+
+// Create thresholds of a zone
+func newZoneThresholds(zone string,
+	thresholds map[string]config.Threshold) *zoneThresholds {
+
+	return &zoneThresholds{
+		zone:       zone,
+		thresholds: thresholds,
+		reached:    map[string]bool{},
+	}
+}
+
+// Resume reached thresholds of previous thresholds of the zone, which still
+// exist, so that a reload does not run their actions again
+func (thresholds *zoneThresholds) Resume(previous *zoneThresholds) {
+	for name := range previous.reached {
+		if _, ok := thresholds.thresholds[name]; ok {
+			thresholds.reached[name] = true
+		}
+	}
+}
+
+// Reached threshold names, sorted
+func (thresholds *zoneThresholds) Reached() []string {
+	names := []string{}
+	for name := range thresholds.reached {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Evaluate thresholds at temperature, running the actions of thresholds
+// which were reached or left. Returns the target, boosted by the reached
+// boost thresholds. Without a temperature, nothing changes.
+func (thresholds *zoneThresholds) Evaluate(temperature *int, target decision,
+	events *eventLog) decision {
+
+	if temperature == nil {
+		return target
+	}
+
+	names := []string{}
+	for name := range thresholds.thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		threshold := thresholds.thresholds[name]
+		reached := *temperature >= threshold.Temperature
+
+		if reached != thresholds.reached[name] {
+			thresholds.cross(name, threshold, *temperature, reached, events)
+		}
+
+		if reached && threshold.Action == config.ThresholdBoost &&
+			target.RPM < threshold.RPM {
+			target.RPM = threshold.RPM
+			target.Percent = nil
+			target.Reason = fmt.Sprintf("threshold %s %d°C", name,
+				threshold.Temperature)
+		}
+	}
+
+	return target
+}
+
+// Run action of a threshold which was reached or left
+func (thresholds *zoneThresholds) cross(name string, threshold config.Threshold,
+	temperature int, reached bool, events *eventLog) {
+
+	state := "left"
+	if reached {
+		thresholds.reached[name] = true
+		state = "reached"
+		log.Printf("WARNING zone %s threshold %s %s: %d >= %d", thresholds.zone,
+			name, state, temperature, threshold.Temperature)
+	} else {
+		delete(thresholds.reached, name)
+		log.Printf("INFO zone %s threshold %s %s: %d < %d", thresholds.zone,
+			name, state, temperature, threshold.Temperature)
+	}
+
+	switch threshold.Action {
+	case config.ThresholdAlert:
+		events.Write(Event{Type: EventThreshold, Zone: thresholds.zone,
+			Message: fmt.Sprintf("%s %s at %d°C", name, state, temperature)})
+
+	case config.ThresholdCommand:
+		if !reached {
+			return
+		}
+
+		countCommand("threshold")
+		command := exec.Command(threshold.Command[0], threshold.Command[1:]...)
+		command.Env = append(os.Environ(),
+			"GRIDFAN_ZONE="+thresholds.zone,
+			"GRIDFAN_THRESHOLD="+name,
+			fmt.Sprintf("GRIDFAN_TEMPERATURE=%d", temperature))
+		go func() {
+			if output, err := command.CombinedOutput(); err != nil {
+				log.Printf("ERROR threshold %s command failed: %v: %s", name,
+					err, output)
+			}
+		}()
+	}
+}
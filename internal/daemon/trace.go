@@ -0,0 +1,59 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"log"
+)
+
+// decisionTrace of each cycle, which logs every step from sensor readings to
+// fan commands, for tuning curves and for bug reports. A nil trace logs
+// nothing.
+type decisionTrace struct{}
+
+// Printf a step of the trace, if enabled
+func (trace *decisionTrace) Printf(format string, args ...interface{}) {
+	if trace == nil {
+		return
+	}
+	log.Printf("DEBUG "+format, args...)
+}
+
+// Segment of curve at temperature: below the first point, at a point, or
+// between two points
+func curveSegment(curve config.Curve, temp int) string {
+	index := curve.PointIndex(temp)
+	switch {
+	case len(curve.Points) == 0:
+		return "no points"
+	case index < 0:
+		first := curve.Points[0]
+		return fmt.Sprintf("below first point %d°C→%s", first.Temperature,
+			first.RPMString())
+	case index == len(curve.Points)-1 || !curve.Interpolate:
+		point := curve.Points[index]
+		return fmt.Sprintf("point %d %d°C→%s", index, point.Temperature,
+			point.RPMString())
+	default:
+		point, next := curve.Points[index], curve.Points[index+1]
+		return fmt.Sprintf("between points %d°C→%s and %d°C→%s",
+			point.Temperature, point.RPMString(), next.Temperature,
+			next.RPMString())
+	}
+}
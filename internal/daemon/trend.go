@@ -0,0 +1,61 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// trend of temperature samples over a time window
+type trend struct {
+	window  time.Duration
+	samples []Sample
+}
+
+// Add sample, and drop samples older than the window
+func (trend *trend) Add(value int, sampleTime time.Time) {
+	trend.samples = append(trend.samples, Sample{Time: sampleTime, Value: value})
+
+	start := 0
+	for start < len(trend.samples)-1 &&
+		sampleTime.Sub(trend.samples[start].Time) > trend.window {
+		start++
+	}
+	trend.samples = trend.samples[start:]
+}
+
+// Reset all samples
+func (trend *trend) Reset() {
+	trend.samples = nil
+}
+
+// Slope in degrees per minute between the oldest and newest sample, or zero
+// if there are less than two samples.
+func (trend *trend) Slope() float64 {
+	if len(trend.samples) < 2 {
+		return 0
+	}
+
+	oldest := trend.samples[0]
+	newest := trend.samples[len(trend.samples)-1]
+	minutes := newest.Time.Sub(oldest.Time).Minutes()
+	if minutes <= 0 {
+		return 0
+	}
+
+	return float64(newest.Value-oldest.Value) / minutes
+}
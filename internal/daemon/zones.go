@@ -0,0 +1,160 @@
+package daemon
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/internal/config"
+	"github.com/cybojanek/gridfan/internal/sensor"
+	"log"
+)
+
+// zoneCurve computes the target rpm of a zone other than the disks zone, from
+// its sensor temperature and the targets of the zones it follows.
+type zoneCurve struct {
+	config config.Zone
+	sensor sensor.Sensor
+
+	lastRPM        int
+	temperatureLog *temperatureLog
+	trace          *decisionTrace
+}
+
+// Create zone curves for config, in order of evaluation
+func newZoneCurves(config config.Config, trace *decisionTrace) []*zoneCurve {
+	zones := []*zoneCurve{}
+	for _, zoneConfig := range config.Zones {
+		zone := &zoneCurve{config: zoneConfig,
+			temperatureLog: newTemperatureLog(config.LogTemperatureDelta),
+			trace:          trace}
+		if sensorConfig, ok := config.Sensors[zoneConfig.Sensor]; ok {
+			zone.sensor = newSensor(sensorConfig)
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// Resume hysteresis and logged temperatures of previous zone curves, by zone
+// name
+func resumeZoneCurves(zones []*zoneCurve, previous []*zoneCurve) {
+	for _, zone := range zones {
+		for _, last := range previous {
+			if last.config.Name == zone.config.Name {
+				zone.lastRPM = last.lastRPM
+				zone.temperatureLog.Resume(last.temperatureLog)
+			}
+		}
+	}
+}
+
+// Target of zone, for the disks temperature and the targets of the zones
+// evaluated before it
+func (zone *zoneCurve) Target(disksTemperature *int,
+	targets map[string]decision) (ZoneStatus, decision) {
+
+	status := ZoneStatus{Name: zone.config.Name}
+	target := decision{RPM: 0, Reason: "no curve"}
+
+	// Own curve
+	if len(zone.config.Points) != 0 {
+		var temperature *int
+		if zone.sensor != nil {
+			value, err := zone.sensor.GetTemperature()
+			if err != nil {
+				log.Printf("ERROR zone %s failed to check sensor temperature: %v",
+					zone.config.Name, err)
+			} else {
+				temperature = &value
+			}
+		} else {
+			temperature = disksTemperature
+		}
+
+		switch {
+		case temperature == nil && zone.sensor != nil:
+			target = failedDecision(
+				"error: failed to check sensor temperature")
+
+		case temperature == nil:
+			target = decision{RPM: 0, Reason: "no disk temperature"}
+			zone.lastRPM = 0
+
+		default:
+			status.Temperature = temperature
+			status.Input = temperature
+			rpm := zone.config.EvaluateFrom(*temperature, zone.lastRPM)
+			zone.trace.Printf("zone %s sensor %s %d°C, curve %s, rpm %s",
+				zone.config.Name, zone.config.Sensor, *temperature,
+				curveSegment(zone.config.Curve, *temperature),
+				config.FormatRPM(rpm, zone.config.Relative()))
+			if plain := zone.config.Evaluate(*temperature); plain != rpm {
+				zone.trace.Printf("zone %s hysteresis holds %s instead of %s",
+					zone.config.Name, config.FormatRPM(rpm, zone.config.Relative()),
+					config.FormatRPM(plain, zone.config.Relative()))
+			}
+			target = relativeDecision(rpm, zone.config.Relative(),
+				fmt.Sprintf("curve %s %d°C→%s", zone.config.Sensor,
+					*temperature, config.FormatRPM(rpm, zone.config.Relative())))
+			zone.lastRPM = rpm
+		}
+	}
+
+	// Followed zones
+	for _, follow := range zone.config.Follow {
+		followed := targets[follow]
+		zone.trace.Printf("zone %s follows %s at %d", zone.config.Name, follow,
+			followed.RPM)
+		if followed.RPM > target.RPM {
+			target = decision{RPM: followed.RPM, Percent: followed.Percent,
+				Reason:   fmt.Sprintf("follow %s (%s)", follow, followed.Reason),
+				Failsafe: followed.Failsafe}
+		}
+	}
+
+	if status.Temperature != nil {
+		zone.temperatureLog.Printf(zone.config.Name, *status.Temperature,
+			"INFO Zone %s target RPM: %d (%s)", zone.config.Name, target.RPM,
+			target.Reason)
+	} else {
+		log.Printf("INFO Zone %s target RPM: %d (%s)", zone.config.Name,
+			target.RPM, target.Reason)
+	}
+
+	status.TargetRPM = target.RPM
+	status.Reason = target.Reason
+
+	return status, target
+}
+
+// AddReading of the zone sensor to readings, unless already there
+func (zone *zoneCurve) AddReading(readings []SensorReading,
+	status ZoneStatus) []SensorReading {
+
+	if zone.sensor == nil || status.Temperature == nil {
+		return readings
+	}
+
+	for _, reading := range readings {
+		if reading.Name == zone.config.Sensor {
+			return readings
+		}
+	}
+
+	return append(readings, SensorReading{Name: zone.config.Sensor,
+		Temperature: *status.Temperature})
+}
@@ -0,0 +1,138 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Temperature backends: the drivetemp kernel driver, smartctl, and hddtemp
+const (
+	BackendDrivetemp = "drivetemp"
+	BackendSmartctl  = "smartctl"
+	BackendHddtemp   = "hddtemp"
+)
+
+// Backends of disk temperatures, in order of preference
+var Backends = []string{BackendDrivetemp, BackendSmartctl, BackendHddtemp}
+
+// smartctl message of a disk it skipped with -n standby, since it is spun down
+var smartctlSkipped = regexp.MustCompile(`Device is in (STANDBY|SLEEP) mode`)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// DetectBackend of disk temperature, which is the first of backends that is
+// available: the drivetemp driver has a sensor of the disk, or the command is
+// installed. Disks behind a bridge, and on Windows, are always read with
+// smartctl. Returns an error if none is.
+func (disk *Disk) DetectBackend(backends []string) (string, error) {
+	if disk.hasBridge() || nativeDisks {
+		return BackendSmartctl, nil
+	}
+
+	for _, backend := range backends {
+		switch backend {
+		case BackendDrivetemp:
+			if _, err := disk.drivetempPath(); err == nil {
+				return backend, nil
+			}
+
+		case BackendSmartctl, BackendHddtemp:
+			if commandAvailable(backend) {
+				return backend, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("DetectBackend: Disk [%v] has none of backends: %v",
+		disk.DevicePath, backends)
+}
+
+// Check a command is configured or in PATH, and exists
+func commandAvailable(name string) bool {
+	path, err := commandPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = exec.LookPath(path)
+	return err == nil
+}
+
+// Path of the drivetemp sensor of disk, in millidegrees celcius
+func (disk *Disk) drivetempPath() (string, error) {
+	paths, err := filepath.Glob(filepath.Join(sysBlock, disk.blockName(),
+		"device", "hwmon", "hwmon*", "temp1_input"))
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("Disk [%v] has no drivetemp sensor",
+			disk.DevicePath)
+	}
+	return paths[0], nil
+}
+
+// Get temperature of disk from its drivetemp sensor
+func (disk *Disk) getDrivetempTemperature() (int, error) {
+	path, err := disk.drivetempPath()
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: Disk [%v] %v", disk.DevicePath,
+			err)
+	}
+
+	millidegrees, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: Disk [%v] bad drivetemp: %v",
+			disk.DevicePath, err)
+	}
+
+	return (millidegrees + 500) / 1000, nil
+}
+
+// Get temperature of disk from smartctl JSON output, without waking it
+func (disk *Disk) getSmartctlTemperature() (int, error) {
+	stdout, stderr, err := runCommand("smartctl", "-n", "standby", "-j",
+		"-A", disk.DevicePath)
+	if smartctlSkipped.MatchString(stdout) {
+		return 0, &ErrSleepingDisk{message: fmt.Sprintf(
+			"GetTemperature: Disk [%v] is sleeping", disk.DevicePath)}
+	}
+
+	temperature, parseErr := parseSmartctlJSONTemperature(stdout)
+	if parseErr != nil {
+		if err != nil {
+			return 0, fmt.Errorf(
+				"GetTemperature: smartctl failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
+				disk.DevicePath, stdout, stderr, err)
+		}
+		return 0, fmt.Errorf("GetTemperature: Disk [%v] %v", disk.DevicePath,
+			parseErr)
+	}
+
+	return temperature, nil
+}
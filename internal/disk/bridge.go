@@ -0,0 +1,104 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+)
+
+// Bridge hints of disks behind USB-SATA bridges, which need SCSI-ATA
+// Translation passthrough through smartctl, since hdparm -C and hddtemp
+// misreport them
+const (
+	// No bridge, use hdparm and hddtemp
+	BridgeNone = "none"
+
+	// Standard SAT passthrough
+	BridgeSAT = "sat"
+
+	// JMicron bridges
+	BridgeJMicron = "jmicron"
+)
+
+// Bridges which are valid Disk Bridge values, besides empty
+var Bridges = []string{BridgeNone, BridgeSAT, BridgeJMicron}
+
+// smartctl device types of bridges
+var bridgeDeviceTypes = map[string]string{
+	BridgeSAT:     "sat",
+	BridgeJMicron: "usbjmicron",
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Check if disk is behind a bridge
+func (disk *Disk) hasBridge() bool {
+	_, ok := bridgeDeviceTypes[disk.Bridge]
+	return ok
+}
+
+// Run smartctl through the disk bridge, without waking it. smartctl exits
+// with a non-zero status for a sleeping disk, or failing SMART checks, so the
+// output is returned along with the error.
+func (disk *Disk) smartctl(flag string) (string, error) {
+	stdout, stderr, err := runCommand("smartctl", "-n", "standby", flag,
+		"-d", bridgeDeviceTypes[disk.Bridge], disk.DevicePath)
+	if err != nil {
+		err = fmt.Errorf(
+			"smartctl failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
+			disk.DevicePath, stdout, stderr, err)
+	}
+	return stdout, err
+}
+
+// Get status of a disk behind a bridge from its power mode
+func (disk *Disk) getBridgeStatus() (Status, error) {
+	stdout, err := disk.smartctl("-i")
+
+	status, parseErr := parseSmartctlPowerMode(stdout)
+	if parseErr != nil {
+		if err != nil {
+			return 0, fmt.Errorf("GetStatus: %v", err)
+		}
+		return 0, fmt.Errorf("GetStatus: Disk [%v] %v", disk.DevicePath,
+			parseErr)
+	}
+
+	return status, nil
+}
+
+// Get temperature of a disk behind a bridge from its SMART attributes
+func (disk *Disk) getBridgeTemperature() (int, error) {
+	stdout, err := disk.smartctl("-A")
+
+	if status, parseErr := parseSmartctlPowerMode(stdout); parseErr == nil &&
+		status <= DiskStatusStandby {
+		return 0, &ErrSleepingDisk{message: fmt.Sprintf(
+			"GetTemperature: Disk [%v] is sleeping", disk.DevicePath)}
+	}
+
+	temperature, parseErr := parseSmartctlTemperature(stdout)
+	if parseErr != nil {
+		if err != nil {
+			return 0, fmt.Errorf("GetTemperature: %v", err)
+		}
+		return 0, fmt.Errorf("GetTemperature: Disk [%v] %v", disk.DevicePath,
+			parseErr)
+	}
+
+	return temperature, nil
+}
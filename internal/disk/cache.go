@@ -0,0 +1,121 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// cache of the last successful disk readings
+type cache struct {
+	status     Status
+	statusTime time.Time
+	spunUp     bool
+
+	temperature     int
+	temperatureTime time.Time
+
+	// Error of the last temperature reading, which fell back to the last
+	// successful reading
+	staleErr error
+}
+
+// Check if a reading taken at a time is still fresh
+func (disk *Disk) isFresh(readingTime time.Time) bool {
+	return disk.PollInterval > 0 && !readingTime.IsZero() &&
+		time.Since(readingTime) < disk.PollInterval
+}
+
+// LastStatus of the disk, if it was polled successfully
+func (disk *Disk) LastStatus() (Status, bool) {
+	return disk.cache.status, !disk.cache.statusTime.IsZero()
+}
+
+// LastTemperature of the disk, and when it was read, which is zero if it
+// never was
+func (disk *Disk) LastTemperature() (int, time.Time) {
+	return disk.cache.temperature, disk.cache.temperatureTime
+}
+
+// StaleTemperature error and age of the last successful temperature
+// reading, if the last reading failed and fell back to it
+func (disk *Disk) StaleTemperature() (time.Duration, error) {
+	if disk.cache.staleErr == nil {
+		return 0, nil
+	}
+	return time.Since(disk.cache.temperatureTime), disk.cache.staleErr
+}
+
+// Get status, from cache if polled within PollInterval
+func (disk *Disk) getCachedStatus() (Status, error) {
+	if disk.isFresh(disk.cache.statusTime) {
+		return disk.cache.status, nil
+	}
+
+	status, err := disk.GetStatus()
+	if err != nil {
+		return status, err
+	}
+
+	// Disk spun up since the last poll
+	disk.cache.spunUp = !disk.cache.statusTime.IsZero() &&
+		disk.cache.status <= DiskStatusStandby && status >= DiskStatusIdle
+
+	disk.cache.status = status
+	disk.cache.statusTime = time.Now()
+
+	return status, nil
+}
+
+// Get temperature, from cache if polled within PollInterval
+func (disk *Disk) getCachedTemperature() (int, error) {
+	if disk.isFresh(disk.cache.temperatureTime) {
+		return disk.cache.temperature, nil
+	}
+
+	// Probing right as the disk spins up may be what woke it
+	if disk.cache.spunUp {
+		disk.cache.spunUp = false
+		disk.Wakeups++
+	}
+
+	temperature, err := disk.GetTemperature()
+	return disk.storeTemperature(temperature, err, time.Now())
+}
+
+// Store temperature reading at readTime, or its error, in the cache. A failed
+// reading falls back to the last successful one within StaleTTL, unless the
+// disk is sleeping.
+func (disk *Disk) storeTemperature(temperature int, err error,
+	readTime time.Time) (int, error) {
+
+	if err != nil {
+		if _, sleeping := err.(*ErrSleepingDisk); !sleeping &&
+			disk.StaleTTL > 0 && !disk.cache.temperatureTime.IsZero() &&
+			time.Since(disk.cache.temperatureTime) < disk.StaleTTL {
+			disk.cache.staleErr = err
+			return disk.cache.temperature, nil
+		}
+		return temperature, err
+	}
+	disk.cache.staleErr = nil
+
+	disk.cache.temperature = temperature
+	disk.cache.temperatureTime = readTime
+
+	return temperature, nil
+}
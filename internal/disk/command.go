@@ -0,0 +1,123 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// CommandNames of the commands run for disks
+var CommandNames = []string{"hddtemp", "hdparm", "nvme", "smartctl"}
+
+// Configured command paths, and runs of each command
+var commands = struct {
+	mutex  sync.Mutex
+	paths  map[string]string
+	strict bool
+	runs   map[string]uint64
+}{paths: map[string]string{}, runs: map[string]uint64{}}
+
+// SetCommands paths by command name. Commands without a path are looked up in
+// PATH, unless strict.
+func SetCommands(paths map[string]string, strict bool) {
+	commands.mutex.Lock()
+	defer commands.mutex.Unlock()
+
+	commands.paths = map[string]string{}
+	for name, path := range paths {
+		commands.paths[name] = path
+	}
+	commands.strict = strict
+}
+
+// Get path of a command
+func commandPath(name string) (string, error) {
+	commands.mutex.Lock()
+	defer commands.mutex.Unlock()
+
+	if path, ok := commands.paths[name]; ok {
+		return path, nil
+	}
+
+	if commands.strict {
+		return "", fmt.Errorf("runCommand: No path configured for command: %s",
+			name)
+	}
+
+	return name, nil
+}
+
+// CommandRuns of each command since start, by command name
+func CommandRuns() map[string]uint64 {
+	commands.mutex.Lock()
+	defer commands.mutex.Unlock()
+
+	runs := map[string]uint64{}
+	for name, count := range commands.runs {
+		runs[name] = count
+	}
+	return runs
+}
+
+// CheckCommand path is absolute, and is a regular file that only root can
+// modify, since it is run as root.
+func CheckCommand(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("CheckCommand: Path is not absolute: %s", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("CheckCommand: %v", err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("CheckCommand: Not a regular file: %s", path)
+	}
+
+	return checkRootOwner(path, info)
+}
+
+// Run a command in the C locale, so that its output can be parsed regardless
+// of the system language. Returns stdout and stderr.
+func runCommand(name string, args ...string) (string, string, error) {
+	path, err := commandPath(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	commands.mutex.Lock()
+	commands.runs[name]++
+	commands.mutex.Unlock()
+
+	command := exec.Command(path, args...)
+	command.Env = append(os.Environ(), "LC_ALL=C", "LANG=C")
+
+	// Save stdout and stderr
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err = command.Run()
+
+	return stdout.String(), stderr.String(), err
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"os"
+	"syscall"
+)
+
+// Duplicates of paths which resolve to the same device, such as a by-id link
+// and its /dev/sdX node, by path, to the first path of that device. Paths
+// which can not be resolved to a device are never duplicates.
+func Duplicates(paths []string) map[string]string {
+	duplicates := map[string]string{}
+	devices := map[uint64]string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode()&os.ModeDevice == 0 {
+			continue
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			continue
+		}
+
+		device := uint64(stat.Rdev)
+		if first, ok := devices[device]; ok {
+			duplicates[path] = first
+		} else {
+			devices[device] = path
+		}
+	}
+	return duplicates
+}
+
+// Removed disk, whose device path no longer exists, such as after its
+// enclosure was powered off
+func (disk *Disk) Removed() bool {
+	_, err := os.Stat(disk.DevicePath)
+	return os.IsNotExist(err)
+}
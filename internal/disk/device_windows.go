@@ -0,0 +1,28 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Duplicates of paths which resolve to the same device, which are not
+// detected on Windows
+func Duplicates(paths []string) map[string]string {
+	return map[string]string{}
+}
+
+// Removed disk, which is not detected on Windows
+func (disk *Disk) Removed() bool {
+	return false
+}
@@ -18,25 +18,57 @@ limitations under the License.
 */
 
 import (
-	"bytes"
 	"fmt"
-	"os/exec"
-	"strconv"
+	"github.com/cybojanek/gridfan/api"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
-// Disk reference.
+// Disk reference. If Target is set, the group normalizes the disk
+// temperature against it. If PollInterval is set, the group reuses status and
+// temperature readings for that long, so that disks can be polled less often
+// than others. Wakeups counts the group temperature probes in the same poll
+// as the disk spun up from sleep or standby. If StaleTTL is set, a failed
+// temperature reading falls back to the last reading, while it is younger.
+// Bridge is the USB-SATA bridge of the disk, if any. If Gentle, the disk is
+// never sent a command unless it is known to be active: its status is derived
+// from kernel I/O statistics, and its temperature only read while active, and
+// reused while idle. Backend reads the temperature, which is hddtemp by
+// default. Identity and Limits are those read by Identify and ReadLimits, if
+// any.
 type Disk struct {
-	DevicePath string
+	DevicePath   string
+	Target       int
+	PollInterval time.Duration
+	StaleTTL     time.Duration
+	Bridge       string
+	Gentle       bool
+	Backend      string
+	Identity     Identity
+	Limits       Limits
+	Wakeups      int
+
+	cache  cache
+	gentle gentle
+	probe  *probe
 }
 
-// Disk status
+// Status of a disk, defined in the api package for clients
+type Status = api.DiskStatus
+
+// Disk status, ordered by activity, see the api package
 const (
-	DiskStatusSleep = iota
-	DiskStatusStandby
-	DiskStatusActive
+	DiskStatusSleep   = api.DiskStatusSleep
+	DiskStatusStandby = api.DiskStatusStandby
+	DiskStatusUnknown = api.DiskStatusUnknown
+	DiskStatusIdle    = api.DiskStatusIdle
+	DiskStatusActive  = api.DiskStatusActive
 )
 
+// Statuses from least to most active
+var Statuses = api.DiskStatuses
+
 ////////////////////////////////////////////////////////////////////////////////
 
 // ErrSleepingDisk error.
@@ -50,131 +82,117 @@ func (e *ErrSleepingDisk) Error() string {
 
 ////////////////////////////////////////////////////////////////////////////////
 
-// GetStatusString for status enum
-func GetStatusString(status int) string {
-	switch status {
-	case DiskStatusSleep:
-		return "Sleeping"
-
-	case DiskStatusStandby:
-		return "Standby"
-
-	case DiskStatusActive:
-		return "Active"
-
-	default:
-		return "Unknown"
-	}
+// ParseStatus from its case insensitive string
+func ParseStatus(value string) (Status, error) {
+	return api.ParseDiskStatus(value)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
 // GetTemperature of a disk in degrees celcius.
 func (disk *Disk) GetTemperature() (int, error) {
+	if disk.Gentle {
+		return disk.getGentleTemperature()
+	}
+	return disk.readTemperature()
+}
 
-	// Get command output
-	command := exec.Command("hddtemp", disk.DevicePath)
+// Read temperature of a disk
+func (disk *Disk) readTemperature() (int, error) {
+	if disk.hasBridge() {
+		return disk.getBridgeTemperature()
+	}
 
-	// Save stdout and stderr
-	var stdoutBuffer, stderrBuffer bytes.Buffer
-	command.Stdout = &stdoutBuffer
-	command.Stderr = &stderrBuffer
+	if nativeDisks {
+		return disk.getNativeTemperature()
+	}
 
-	err := command.Run()
-	stdout := stdoutBuffer.String()
-	stderr := stderrBuffer.String()
+	switch disk.Backend {
+	case BackendDrivetemp:
+		return disk.getDrivetempTemperature()
+	case BackendSmartctl:
+		return disk.getSmartctlTemperature()
+	}
 
+	stdout, stderr, err := runCommand("hddtemp", disk.DevicePath)
 	if err != nil {
 		return 0, err
 	}
 
-	// Check for error, since hddtemp returns exit cide 0
-	if strings.Contains(stderr, "No such file or directory") {
+	temperature, err := parseHddtemp(stdout, stderr)
+	switch err {
+	case nil:
+		return temperature, nil
+
+	case errHddtempNotFound:
 		return 0, fmt.Errorf("GetTemperature: Disk [%v] not found",
 			disk.DevicePath)
-	}
 
-	// Check if drive is asleep
-	if strings.Contains(stderr, "drive is sleeping") {
+	case errHddtempSleeping:
 		return 0, &ErrSleepingDisk{message: fmt.Sprintf(
 			"GetTemperature: Disk [%v] is sleeping", disk.DevicePath)}
-	}
 
-	// Split into lines
-	lines := strings.Split(strings.TrimSpace(stdout), "\n")
-	if len(lines) != 1 {
-		return 0, fmt.Errorf(
-			"GetTemperature: Disk [%v] output is not one line: [%v]",
-			disk.DevicePath, stdout)
+	default:
+		return 0, fmt.Errorf("GetTemperature: Disk [%v] %v",
+			disk.DevicePath, err)
 	}
+}
 
-	// Get temperature
-	fields := strings.Split(lines[0], ":")
-	if len(fields) != 3 {
-		return 0, fmt.Errorf(
-			"GetTemperature: Disk [%v] output is not three fields: [%v]",
-			disk.DevicePath, lines[0])
+// GetStatus of status of a disk.
+func (disk *Disk) GetStatus() (Status, error) {
+	if disk.Gentle {
+		return disk.getGentleStatus()
 	}
 
-	field := strings.TrimSpace(fields[2])
-	tempStr := field[0:0]
-	for i, c := range field {
-		if c < '0' || c > '9' {
-			break
-		}
-		tempStr = field[0 : i+1]
+	if disk.hasBridge() {
+		return disk.getBridgeStatus()
 	}
 
-	temperature, err := strconv.Atoi(tempStr)
-	if err != nil {
-		return 0, fmt.Errorf(
-			"GetTemperature: Disk [%v] output temperature error: [%v] %v",
-			disk.DevicePath, stdout, err)
+	if nativeDisks {
+		return disk.getNativeStatus()
 	}
 
-	return temperature, nil
-}
-
-// GetStatus of status of a disk.
-func (disk *Disk) GetStatus() (int, error) {
-	var status int
-
-	// Get command output
-	command := exec.Command("hdparm", "-C", disk.DevicePath)
-
-	// Save stdout and stderr
-	var stdout, stderr bytes.Buffer
-	command.Stdout = &stdout
-	command.Stderr = &stderr
+	if disk.isNVMe() {
+		return disk.getNVMeStatus()
+	}
 
-	if err := command.Run(); err != nil {
+	stdout, stderr, err := runCommand("hdparm", "-C", disk.DevicePath)
+	if err != nil {
 		return 0, fmt.Errorf(
 			"GetStatus: hdparm failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
-			disk.DevicePath, stdout.String(), stderr.String(), err)
+			disk.DevicePath, stdout, stderr, err)
 	}
-	stringOutput := stdout.String()
 
-	// Split into lines
-	lines := strings.Split(strings.TrimSpace(stringOutput), "\n")
-	if len(lines) != 2 {
-		return 0, fmt.Errorf("GetStatus: output is not two lines: %v",
-			stringOutput)
+	status, err := parseHdparmStatus(stdout)
+	if err != nil {
+		return 0, fmt.Errorf("GetStatus: Disk [%v] %v", disk.DevicePath, err)
 	}
 
-	// NOTE: our notion of standby differs from what hdparm reports...
-	statusLine := lines[1]
-	switch {
-	case strings.Contains(statusLine, "standby"):
-		status = DiskStatusSleep
+	return status, nil
+}
 
-	case strings.Contains(statusLine, "unknown"):
-		status = DiskStatusStandby
+// Check if disk is an NVMe device
+func (disk *Disk) isNVMe() bool {
+	devicePath, err := filepath.EvalSymlinks(disk.DevicePath)
+	if err != nil {
+		devicePath = disk.DevicePath
+	}
+	return strings.HasPrefix(filepath.Base(devicePath), "nvme")
+}
 
-	case strings.Contains(statusLine, "active/idle"):
-		status = DiskStatusActive
+// Get status of an NVMe disk from its power state feature
+func (disk *Disk) getNVMeStatus() (Status, error) {
+	stdout, stderr, err := runCommand("nvme", "get-feature", "-f", "2",
+		disk.DevicePath)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"GetStatus: nvme failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
+			disk.DevicePath, stdout, stderr, err)
+	}
 
-	default:
-		return 0, fmt.Errorf("GetStatus: bad status line: [%s]", statusLine)
+	status, err := parseNVMePowerState(stdout)
+	if err != nil {
+		return 0, fmt.Errorf("GetStatus: Disk [%v] %v", disk.DevicePath, err)
 	}
 
 	return status, nil
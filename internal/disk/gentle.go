@@ -0,0 +1,148 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kernel block device statistics, and block devices
+var (
+	procDiskstats = "/proc/diskstats"
+	sysBlock      = "/sys/block"
+)
+
+// Time after the last I/O of a gentle disk, during which it is idle, with
+// the temperature read while it was last active
+const gentleIdleTime = 10 * time.Minute
+
+// gentle state of a disk, of its last I/O counts and status, when it was last
+// active, and its temperature then
+type gentle struct {
+	ios        uint64
+	read       bool
+	status     Status
+	lastActive time.Time
+
+	temperature     int
+	haveTemperature bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Block device name of disk, such as sda
+func (disk *Disk) blockName() string {
+	devicePath, err := filepath.EvalSymlinks(disk.DevicePath)
+	if err != nil {
+		devicePath = disk.DevicePath
+	}
+	return filepath.Base(devicePath)
+}
+
+// Read completed reads and writes, and I/Os in flight, of block device name
+// from /proc/diskstats, whose lines look like "8 0 sda 1 2 3 4 5 6 7 8 9 10
+// 11", with completed reads and writes in the 4th and 8th fields, and I/Os in
+// flight in the 12th
+func readDiskstats(name string) (uint64, uint64, error) {
+	contents, err := ioutil.ReadFile(procDiskstats)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 12 || fields[2] != name {
+			continue
+		}
+
+		values := []uint64{}
+		for _, index := range []int{3, 7, 11} {
+			value, err := strconv.ParseUint(fields[index], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("bad diskstats line: [%v]", line)
+			}
+			values = append(values, value)
+		}
+		return values[0] + values[1], values[2], nil
+	}
+
+	return 0, 0, fmt.Errorf("no diskstats for %s", name)
+}
+
+// Get status of a disk without sending it any command: sleeping if the kernel
+// suspended the device, active if it completed or has I/O in flight since the
+// last check, idle for gentleIdleTime after that, and unknown otherwise,
+// including the first check
+func (disk *Disk) getGentleStatus() (Status, error) {
+	name := disk.blockName()
+
+	runtimeStatus, err := ioutil.ReadFile(filepath.Join(sysBlock, name,
+		"device", "power", "runtime_status"))
+	if err == nil && strings.TrimSpace(string(runtimeStatus)) == "suspended" {
+		disk.gentle.status = DiskStatusSleep
+		return disk.gentle.status, nil
+	}
+
+	ios, inFlight, err := readDiskstats(name)
+	if err != nil {
+		disk.gentle.status = DiskStatusUnknown
+		return 0, fmt.Errorf("GetStatus: Disk [%v] %v", disk.DevicePath, err)
+	}
+
+	switch {
+	case inFlight > 0 || (disk.gentle.read && ios != disk.gentle.ios):
+		disk.gentle.status = DiskStatusActive
+		disk.gentle.lastActive = time.Now()
+	case !disk.gentle.lastActive.IsZero() &&
+		time.Since(disk.gentle.lastActive) < gentleIdleTime:
+		disk.gentle.status = DiskStatusIdle
+	default:
+		disk.gentle.status = DiskStatusUnknown
+	}
+	disk.gentle.ios = ios
+	disk.gentle.read = true
+
+	return disk.gentle.status, nil
+}
+
+// Get temperature of a gentle disk: read while it is active, the temperature
+// read then while it is idle, and none otherwise
+func (disk *Disk) getGentleTemperature() (int, error) {
+	switch {
+	case disk.gentle.status == DiskStatusActive:
+		temperature, err := disk.readTemperature()
+		if err != nil {
+			return 0, err
+		}
+		disk.gentle.temperature = temperature
+		disk.gentle.haveTemperature = true
+		return temperature, nil
+
+	case disk.gentle.status == DiskStatusIdle && disk.gentle.haveTemperature:
+		return disk.gentle.temperature, nil
+
+	default:
+		return 0, &ErrSleepingDisk{message: fmt.Sprintf(
+			"GetTemperature: Disk [%v] is not known to be active",
+			disk.DevicePath)}
+	}
+}
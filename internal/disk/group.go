@@ -16,9 +16,44 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Group of disks
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Group of disks. Temperatures of disks with a Target are normalized to the
+// group Target, so that disks with different targets (SSD and HDD) can be
+// compared, while RawTemperature keeps the hottest actual temperature. If TemperatureOnly, the disks are not checked for their power
+// state, but are active if any disk temperature can be read, and in standby
+// otherwise. With Stagger, the temperature probes of the disks, which may
+// wake them, are spread at random offsets over that time, instead of being
+// sent all at once. They run in the background, starting a read Interval
+// before the cached temperature goes stale, so that they are done by the
+// next read of the group temperature.
 type Group struct {
-	Disks []*Disk
+	Disks           []*Disk
+	Target          int
+	TemperatureOnly bool
+	Stagger         time.Duration
+	Interval        time.Duration
+
+	// Temperature read for the status if TemperatureOnly, until the next
+	// GetTemperature
+	probed *groupTemperature
+
+	// Maximum disk temperature of the last reading, before normalizing
+	raw int
+
+	// Random source of the Stagger offsets
+	random *rand.Rand
+}
+
+// groupTemperature reading of a group
+type groupTemperature struct {
+	temperature int
+	disk        *Disk
+	err         error
 }
 
 // AddDisk to the group.
@@ -26,13 +61,53 @@ func (group *Group) AddDisk(disk *Disk) {
 	group.Disks = append(group.Disks, disk)
 }
 
-// GetTemperature maximum of all disks
-func (group *Group) GetTemperature() (int, error) {
-	maxTemperature := 0
-
+// PollInterval is the shortest disk PollInterval, or zero if not set.
+func (group *Group) PollInterval() time.Duration {
+	interval := time.Duration(0)
 	for _, disk := range group.Disks {
+		if disk.PollInterval > 0 &&
+			(interval == 0 || disk.PollInterval < interval) {
+			interval = disk.PollInterval
+		}
+	}
+	return interval
+}
 
-		temperature, err := disk.GetTemperature()
+// GetTemperature maximum of all normalized disk temperatures, and the disk
+// with that temperature, which is nil if all disks are sleeping.
+func (group *Group) GetTemperature() (int, *Disk, error) {
+	if probed := group.probed; probed != nil {
+		group.probed = nil
+		return probed.temperature, probed.disk, probed.err
+	}
+
+	return group.readTemperature()
+}
+
+// RawTemperature maximum of all disk temperatures of the last GetTemperature,
+// before normalizing them to the group Target, for checks of absolute limits
+func (group *Group) RawTemperature() int {
+	return group.raw
+}
+
+// Read maximum of all normalized disk temperatures
+func (group *Group) readTemperature() (int, *Disk, error) {
+	maxTemperature := 0
+	var maxDisk *Disk
+	group.raw = 0
+	read := false
+
+	offsets := group.staggerOffsets()
+	for i, disk := range group.Disks {
+
+		var temperature int
+		var err error
+		if offsets != nil && !disk.Gentle {
+			temperature, err = disk.getStaggeredTemperature(offsets[i],
+				group.Interval)
+		} else {
+			temperature, err = disk.getCachedTemperature()
+		}
 
 		if err != nil {
 			switch err.(type) {
@@ -40,25 +115,69 @@ func (group *Group) GetTemperature() (int, error) {
 				continue
 
 			default:
-				return maxTemperature, err
+				return maxTemperature, disk, err
 			}
 		}
 
-		if temperature > maxTemperature {
+		if !read || temperature > group.raw {
+			group.raw = temperature
+			read = true
+		}
+
+		if disk.Target != 0 {
+			temperature += group.Target - disk.Target
+		}
+
+		if maxDisk == nil || temperature > maxTemperature {
 			maxTemperature = temperature
+			maxDisk = disk
 		}
 	}
 
-	return maxTemperature, nil
+	return maxTemperature, maxDisk, nil
+}
+
+// Random offsets within Stagger to probe each disk at, in order, or nil
+// without Stagger
+func (group *Group) staggerOffsets() []time.Duration {
+	if group.Stagger <= 0 {
+		return nil
+	}
+
+	if group.random == nil {
+		group.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	offsets := []time.Duration{}
+	for range group.Disks {
+		offsets = append(offsets,
+			time.Duration(group.random.Int63n(int64(group.Stagger))))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// Removed if the group has disks, and all of them are removed
+func (group *Group) Removed() bool {
+	for _, disk := range group.Disks {
+		if !disk.Removed() {
+			return false
+		}
+	}
+	return len(group.Disks) != 0
 }
 
 // GetStatus of highest activity disk
-func (group *Group) GetStatus() (int, error) {
+func (group *Group) GetStatus() (Status, error) {
+	if group.TemperatureOnly {
+		return group.getTemperatureStatus(), nil
+	}
+
 	maxStatus := DiskStatusSleep
 
 	for _, disk := range group.Disks {
 
-		status, err := disk.GetStatus()
+		status, err := disk.getCachedStatus()
 
 		if err != nil {
 			return status, err
@@ -71,3 +190,18 @@ func (group *Group) GetStatus() (int, error) {
 
 	return maxStatus, nil
 }
+
+// Get status from temperatures: active if any disk temperature can be read,
+// and standby if all disks are sleeping or fail
+func (group *Group) getTemperatureStatus() Status {
+	temperature, disk, err := group.readTemperature()
+	group.probed = &groupTemperature{temperature: temperature, disk: disk,
+		err: err}
+
+	if err != nil || disk == nil {
+		group.probed = nil
+		return DiskStatusStandby
+	}
+
+	return DiskStatusActive
+}
@@ -0,0 +1,116 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"github.com/cybojanek/gridfan/api"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Identity of a disk, defined in the api package for clients
+type Identity = api.DiskIdentity
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Identify disk from its IDENTIFY data with smartctl, through its bridge, if
+// any, or from the kernel without smartctl. Neither wakes the disk, so a
+// sleeping disk may fail to be identified with smartctl. A Gentle disk is
+// only identified from the kernel, since smartctl still sends it a power mode
+// check.
+func (disk *Disk) Identify() (Identity, error) {
+	if disk.Gentle {
+		return disk.identifySysfs()
+	}
+	if disk.hasBridge() || nativeDisks || commandAvailable("smartctl") {
+		return disk.identifySmartctl()
+	}
+	return disk.identifySysfs()
+}
+
+// Identify disk with smartctl -i
+func (disk *Disk) identifySmartctl() (Identity, error) {
+	args := []string{"-n", "standby", "-j", "-i"}
+	if disk.hasBridge() {
+		args = append(args, "-d", bridgeDeviceTypes[disk.Bridge])
+	}
+	stdout, stderr, err := runCommand("smartctl",
+		append(args, disk.DevicePath)...)
+
+	identity, parseErr := parseSmartctlJSONIdentity(stdout)
+	if parseErr != nil {
+		if smartctlSkipped.MatchString(stdout) {
+			return identity, &ErrSleepingDisk{message: fmt.Sprintf(
+				"Identify: Disk [%v] is sleeping", disk.DevicePath)}
+		}
+		if err != nil {
+			return identity, fmt.Errorf(
+				"Identify: smartctl failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
+				disk.DevicePath, stdout, stderr, err)
+		}
+		return identity, fmt.Errorf("Identify: Disk [%v] %v", disk.DevicePath,
+			parseErr)
+	}
+
+	return identity, nil
+}
+
+// Identify disk from its block device attributes, of which serial and
+// firmware are only there for some drivers
+func (disk *Disk) identifySysfs() (Identity, error) {
+	identity := Identity{}
+	directory := filepath.Join(sysBlock, disk.blockName())
+
+	sectors, err := readAttribute(directory, "size")
+	if err != nil {
+		return identity, fmt.Errorf("Identify: Disk [%v] %v", disk.DevicePath,
+			err)
+	}
+	if value, err := strconv.ParseInt(sectors, 10, 64); err == nil {
+		// Always in 512 byte sectors, regardless of the disk
+		identity.Capacity = value * 512
+	}
+
+	identity.Model, _ = readAttribute(directory, "device/model")
+	identity.Serial, _ = readAttribute(directory, "device/serial")
+	for _, name := range []string{"device/rev", "device/firmware_rev"} {
+		if value, err := readAttribute(directory, name); err == nil {
+			identity.Firmware = value
+			break
+		}
+	}
+
+	return identity, nil
+}
+
+// Read attribute name of sysfs directory, without surrounding whitespace
+func readAttribute(directory string, name string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(directory, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// FormatCapacity of bytes in decimal units, as drives are labeled, such as
+// 4.0 TB
+func FormatCapacity(bytes int64) string {
+	return api.FormatCapacity(bytes)
+}
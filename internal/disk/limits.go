@@ -0,0 +1,98 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Sources of disk limits
+const (
+	// Recommended maximum operating temperature of the SCT status, or the
+	// trip temperature of SCSI disks
+	LimitsSMART = "smart"
+
+	// Data sheet of the disk model
+	LimitsModel = "model"
+
+	// Disk max_temp in the config
+	LimitsConfig = "config"
+)
+
+// Limits of disk temperature: its rated maximum operating temperature, and
+// where it is from
+type Limits struct {
+	Max    int    `json:"max"`
+	Source string `json:"source"`
+}
+
+// Rated maximum operating temperatures of disk families, by model, from their
+// data sheets
+var modelLimits = []struct {
+	model *regexp.Regexp
+	max   int
+}{
+	// WD Red and Red Plus
+	{regexp.MustCompile(`^WDC WD\d+EF[ARZ]X`), 65},
+	// Seagate IronWolf
+	{regexp.MustCompile(`^ST\d+VN`), 70},
+	// Seagate Exos
+	{regexp.MustCompile(`^ST\d+NM`), 60},
+	// Seagate BarraCuda
+	{regexp.MustCompile(`^ST\d+DM`), 60},
+	// HGST and WD Ultrastar
+	{regexp.MustCompile(`^(HGST |WDC )?HU[HS]7`), 60},
+	// Toshiba MG enterprise
+	{regexp.MustCompile(`^TOSHIBA MG`), 55},
+	// Toshiba N300
+	{regexp.MustCompile(`^TOSHIBA HDWG`), 65},
+	// Samsung SSDs
+	{regexp.MustCompile(`^Samsung SSD`), 70},
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ReadLimits of disk, from its SMART data with smartctl, or else from the
+// data sheet of its model, which must be identified first. Does not wake the
+// disk, so a sleeping disk has only the limits of its model. A Gentle disk
+// only has the limits of its model, since smartctl still sends it a power
+// mode check.
+func (disk *Disk) ReadLimits() (Limits, error) {
+	if !disk.Gentle && (disk.hasBridge() || nativeDisks ||
+		commandAvailable("smartctl")) {
+		args := []string{"-n", "standby", "-j", "-l", "scttempsts", "-A"}
+		if disk.hasBridge() {
+			args = append(args, "-d", bridgeDeviceTypes[disk.Bridge])
+		}
+		stdout, _, _ := runCommand("smartctl",
+			append(args, disk.DevicePath)...)
+		if max, err := parseSmartctlJSONLimit(stdout); err == nil {
+			return Limits{Max: max, Source: LimitsSMART}, nil
+		}
+	}
+
+	for _, limits := range modelLimits {
+		if limits.model.MatchString(disk.Identity.Model) {
+			return Limits{Max: limits.max, Source: LimitsModel}, nil
+		}
+	}
+
+	return Limits{}, fmt.Errorf(
+		"ReadLimits: Disk [%v] has no rated maximum temperature",
+		disk.DevicePath)
+}
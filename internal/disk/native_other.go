@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+)
+
+// Disks are read with hdparm and hddtemp, except on Windows
+const nativeDisks = false
+
+// Get status of disk natively, which only applies to Windows
+func (disk *Disk) getNativeStatus() (Status, error) {
+	return 0, fmt.Errorf("GetStatus: Native disk status is only supported on Windows")
+}
+
+// Get temperature of disk natively, which only applies to Windows
+func (disk *Disk) getNativeTemperature() (int, error) {
+	return 0, fmt.Errorf("GetTemperature: Native disk temperature is only supported on Windows")
+}
@@ -0,0 +1,95 @@
+//go:build windows
+// +build windows
+
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"syscall"
+	"unsafe"
+)
+
+// Disks are read natively on Windows, instead of with hdparm and hddtemp
+const nativeDisks = true
+
+// Device paths in the form of smartctl for Windows, such as /dev/sdb
+var windowsSmartctlPath = regexp.MustCompile(`^/dev/sd([a-z])$`)
+
+// GetDevicePowerState of kernel32, which does not wake the device
+var getDevicePowerState = syscall.NewLazyDLL("kernel32.dll").NewProc(
+	"GetDevicePowerState")
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Windows path of disk, such as \\.\PhysicalDrive1, for a device path of
+// either that form, or the smartctl form of /dev/sdb
+func (disk *Disk) windowsPath() string {
+	match := windowsSmartctlPath.FindStringSubmatch(disk.DevicePath)
+	if match == nil {
+		return disk.DevicePath
+	}
+	return fmt.Sprintf(`\\.\PhysicalDrive%d`, match[1][0]-'a')
+}
+
+// Get status of disk from the power state of its device, which is only on,
+// or spun down
+func (disk *Disk) getNativeStatus() (Status, error) {
+	path, err := syscall.UTF16PtrFromString(disk.windowsPath())
+	if err != nil {
+		return 0, fmt.Errorf("GetStatus: Disk [%v] %v", disk.DevicePath, err)
+	}
+
+	// Open without read or write access, which does not spin up the disk
+	handle, err := syscall.CreateFile(path, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("GetStatus: Disk [%v] not found: %v",
+			disk.DevicePath, err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var on int32
+	result, _, err := getDevicePowerState.Call(uintptr(handle),
+		uintptr(unsafe.Pointer(&on)))
+	if result == 0 {
+		return 0, fmt.Errorf("GetStatus: Disk [%v] power state: %v",
+			disk.DevicePath, err)
+	}
+
+	if on == 0 {
+		return DiskStatusStandby, nil
+	}
+	return DiskStatusActive, nil
+}
+
+// Get temperature of disk from smartctl JSON output, unless it is spun down
+func (disk *Disk) getNativeTemperature() (int, error) {
+	status, err := disk.getNativeStatus()
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: %v", err)
+	}
+	if status <= DiskStatusStandby {
+		return 0, &ErrSleepingDisk{message: fmt.Sprintf(
+			"GetTemperature: Disk [%v] is sleeping", disk.DevicePath)}
+	}
+
+	return disk.getSmartctlTemperature()
+}
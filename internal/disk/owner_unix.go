@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Check file is owned by root, and not writable by group or others
+func checkRootOwner(path string, info os.FileInfo) error {
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("CheckCommand: Writable by group or others: %s", path)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("CheckCommand: Unknown owner: %s", path)
+	}
+
+	if stat.Uid != 0 {
+		return fmt.Errorf("CheckCommand: Not owned by root: %s", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Errors of parsing hddtemp output
+var (
+	errHddtempNotFound = fmt.Errorf("not found")
+	errHddtempSleeping = fmt.Errorf("sleeping")
+)
+
+// Parse hddtemp output of one disk into degrees celcius. The output looks
+// like "/dev/sda: WDC WD40EFRX: 35°C", where the model may contain colons,
+// the degree sign may be in any encoding or missing, and the unit may be F.
+func parseHddtemp(stdout string, stderr string) (int, error) {
+	output := stdout + "\n" + stderr
+
+	// Check for error, since hddtemp returns exit code 0
+	if strings.Contains(output, "No such file or directory") {
+		return 0, errHddtempNotFound
+	}
+
+	// Check if drive is asleep
+	if strings.Contains(output, "drive is sleeping") ||
+		strings.Contains(output, ": SLP") {
+		return 0, errHddtempSleeping
+	}
+
+	// Split into lines
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 1 {
+		return 0, fmt.Errorf("output is not one line: [%v]", stdout)
+	}
+
+	// Temperature is in the last field
+	separator := strings.LastIndex(lines[0], ":")
+	if separator < 0 {
+		return 0, fmt.Errorf("output has no fields: [%v]", lines[0])
+	}
+	field := strings.TrimSpace(lines[0][separator+1:])
+
+	// Leading digits are the temperature
+	digits := 0
+	for digits < len(field) && field[digits] >= '0' && field[digits] <= '9' {
+		digits++
+	}
+
+	temperature, err := strconv.Atoi(field[:digits])
+	if err != nil {
+		return 0, fmt.Errorf("bad temperature: [%v]", field)
+	}
+
+	// First letter after the digits is the unit, skipping any degree sign
+	unit := byte('C')
+	for i := digits; i < len(field); i++ {
+		c := field[i] &^ 0x20
+		if c >= 'A' && c <= 'Z' {
+			unit = c
+			break
+		}
+	}
+
+	switch unit {
+	case 'C':
+		return temperature, nil
+
+	case 'F':
+		return int(math.Round(float64(temperature-32) * 5 / 9)), nil
+
+	default:
+		return 0, fmt.Errorf("bad temperature unit: [%v]", field)
+	}
+}
+
+// Parse hdparm -C output into a status. The output looks like
+// "/dev/sda:\n drive state is:  active/idle".
+func parseHdparmStatus(stdout string) (Status, error) {
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.SplitN(line, "drive state is:", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		state := strings.TrimSpace(fields[1])
+		switch {
+		case strings.Contains(state, "sleeping"):
+			return DiskStatusSleep, nil
+
+		case strings.Contains(state, "standby"):
+			return DiskStatusStandby, nil
+
+		case strings.Contains(state, "unknown"):
+			return DiskStatusUnknown, nil
+
+		case strings.Contains(state, "active"):
+			return DiskStatusActive, nil
+
+		case strings.Contains(state, "idle"):
+			return DiskStatusIdle, nil
+
+		default:
+			return 0, fmt.Errorf("bad status: [%s]", state)
+		}
+	}
+
+	return 0, fmt.Errorf("output has no drive state: [%v]", stdout)
+}
+
+// Parse nvme get-feature -f 2 output into a status. The output looks like
+// "get-feature:0x02 (Power Management), Current value:0x00000000", where the
+// low 5 bits are the power state.
+func parseNVMePowerState(stdout string) (Status, error) {
+	fields := strings.SplitN(stdout, "Current value:", 2)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("output has no current value: [%v]", stdout)
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad current value: [%v]", fields[1])
+	}
+
+	if value&0x1f == 0 {
+		return DiskStatusActive, nil
+	}
+
+	return DiskStatusIdle, nil
+}
+
+// Parse smartctl -n standby output into a status. A spun down disk is
+// skipped with "Device is in STANDBY mode, exit(2)", and otherwise the output
+// includes "Power mode is:    ACTIVE or IDLE", or "Power mode was: IDLE_A".
+func parseSmartctlPowerMode(stdout string) (Status, error) {
+	for _, line := range strings.Split(stdout, "\n") {
+		var mode string
+		if strings.HasPrefix(line, "Device is in ") {
+			mode = strings.TrimPrefix(line, "Device is in ")
+		} else if fields := strings.SplitN(line, ":", 2); len(fields) == 2 &&
+			strings.HasPrefix(fields[0], "Power mode ") {
+			mode = fields[1]
+		} else {
+			continue
+		}
+
+		mode = strings.ToUpper(strings.TrimSpace(mode))
+		switch {
+		case strings.HasPrefix(mode, "SLEEP"):
+			return DiskStatusSleep, nil
+
+		case strings.HasPrefix(mode, "STANDBY"):
+			return DiskStatusStandby, nil
+
+		case strings.HasPrefix(mode, "ACTIVE"):
+			return DiskStatusActive, nil
+
+		case strings.HasPrefix(mode, "IDLE"):
+			return DiskStatusIdle, nil
+
+		default:
+			return DiskStatusUnknown, nil
+		}
+	}
+
+	return 0, fmt.Errorf("output has no power mode: [%v]", stdout)
+}
+
+// Parse smartctl -A output into degrees celcius, from the raw value of the
+// Temperature_Celsius attribute (194), or else Airflow_Temperature_Cel (190),
+// which look like "194 Temperature_Celsius 0x0022 119 100 000 Old_age Always
+// - 31 (Min/Max 20/45)", or from "Current Drive Temperature: 31 C".
+func parseSmartctlTemperature(stdout string) (int, error) {
+	attributes := map[string]string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 10 && (fields[0] == "194" || fields[0] == "190") {
+			attributes[fields[0]] = fields[9]
+		} else if len(fields) >= 4 &&
+			strings.HasPrefix(line, "Current Drive Temperature:") {
+			attributes["current"] = fields[3]
+		}
+	}
+
+	for _, id := range []string{"194", "190", "current"} {
+		value, ok := attributes[id]
+		if !ok {
+			continue
+		}
+
+		temperature, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("bad temperature: [%v]", value)
+		}
+		return temperature, nil
+	}
+
+	return 0, fmt.Errorf("output has no temperature: [%v]", stdout)
+}
+
+// Parse smartctl -j -A output into degrees celcius, from the current
+// temperature, which looks like {"temperature": {"current": 31}}
+func parseSmartctlJSONTemperature(stdout string) (int, error) {
+	output := struct {
+		Temperature *struct {
+			Current *int `json:"current"`
+		} `json:"temperature"`
+	}{}
+
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		return 0, fmt.Errorf("bad output: %v", err)
+	}
+
+	if output.Temperature == nil || output.Temperature.Current == nil {
+		return 0, fmt.Errorf("output has no temperature: [%v]", stdout)
+	}
+
+	return *output.Temperature.Current, nil
+}
+
+// Parse smartctl -j -i output into a disk identity, which looks like
+// {"model_name": "WDC WD40EFRX", "serial_number": "WD-WCC7K1234567",
+// "firmware_version": "82.00A82", "user_capacity": {"bytes": 4000787030016}},
+// with NVMe disks having nvme_total_capacity instead of user_capacity
+func parseSmartctlJSONIdentity(stdout string) (Identity, error) {
+	output := struct {
+		ModelName       string `json:"model_name"`
+		SerialNumber    string `json:"serial_number"`
+		FirmwareVersion string `json:"firmware_version"`
+		UserCapacity    struct {
+			Bytes int64 `json:"bytes"`
+		} `json:"user_capacity"`
+		NVMeTotalCapacity int64 `json:"nvme_total_capacity"`
+	}{}
+
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		return Identity{}, fmt.Errorf("bad output: %v", err)
+	}
+
+	if len(output.ModelName) == 0 && len(output.SerialNumber) == 0 {
+		return Identity{}, fmt.Errorf("output has no identity: [%v]", stdout)
+	}
+
+	identity := Identity{Model: output.ModelName,
+		Serial:   output.SerialNumber,
+		Firmware: output.FirmwareVersion,
+		Capacity: output.UserCapacity.Bytes}
+	if identity.Capacity == 0 {
+		identity.Capacity = output.NVMeTotalCapacity
+	}
+
+	return identity, nil
+}
+
+// Parse smartctl -j -l scttempsts -A output into the rated maximum operating
+// temperature in degrees celcius, which looks like {"temperature":
+// {"op_limit_max": 60}} for SCT status, and {"temperature": {"drive_trip":
+// 65}} for SCSI disks
+func parseSmartctlJSONLimit(stdout string) (int, error) {
+	output := struct {
+		Temperature struct {
+			OpLimitMax int `json:"op_limit_max"`
+			DriveTrip  int `json:"drive_trip"`
+		} `json:"temperature"`
+	}{}
+
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		return 0, fmt.Errorf("bad output: %v", err)
+	}
+
+	if output.Temperature.OpLimitMax > 0 {
+		return output.Temperature.OpLimitMax, nil
+	}
+	if output.Temperature.DriveTrip > 0 {
+		return output.Temperature.DriveTrip, nil
+	}
+
+	return 0, fmt.Errorf("output has no temperature limit: [%v]", stdout)
+}
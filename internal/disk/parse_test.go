@@ -0,0 +1,194 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"testing"
+)
+
+func TestParseHddtemp(t *testing.T) {
+	tests := []struct {
+		name        string
+		stdout      string
+		stderr      string
+		temperature int
+		err         error
+		fails       bool
+	}{
+		{name: "utf-8 degree sign, en_US.UTF-8 locale",
+			stdout:      "/dev/sda: WDC WD40EFRX-68N32N0: 35°C\n",
+			temperature: 35},
+		{name: "latin-1 degree sign, de_DE.ISO-8859-1 locale",
+			stdout:      "/dev/sda: WDC WD40EFRX-68N32N0: 35\xb0C\n",
+			temperature: 35},
+		{name: "no degree sign, C locale",
+			stdout:      "/dev/sda: ST4000VN008-2DR166: 31 C\n",
+			temperature: 31},
+		{name: "no separator",
+			stdout:      "/dev/sdb: TOSHIBA HDWG480: 41C\n",
+			temperature: 41},
+		{name: "fahrenheit",
+			stdout:      "/dev/sda: WDC WD40EFRX-68N32N0: 95°F\n",
+			temperature: 35},
+		{name: "lowercase fahrenheit",
+			stdout:      "/dev/sda: WDC WD40EFRX-68N32N0: 104 f\n",
+			temperature: 40},
+		{name: "colon in model",
+			stdout:      "/dev/sdc: SAMSUNG: HD204UI: 29°C\n",
+			temperature: 29},
+		{name: "beta15 unknown drive warning",
+			stdout: "/dev/sdd: Hitachi HDS5C3020ALA632: 33°C\n",
+			stderr: "WARNING: Drive /dev/sdd doesn't appear in the " +
+				"database of supported drives\n",
+			temperature: 33},
+		{name: "not available",
+			stdout: "/dev/sde: Samsung SSD 860 EVO 500GB: S.M.A.R.T. " +
+				"not available\n",
+			fails: true},
+		{name: "no sensor",
+			stdout: "/dev/sdf: KINGSTON SA400S37240G:  drive supported, " +
+				"but it doesn't have a temperature sensor.\n",
+			fails: true},
+		{name: "drive is sleeping",
+			stdout: "/dev/sda: WDC WD40EFRX-68N32N0: drive is sleeping\n",
+			err:    errHddtempSleeping},
+		{name: "sleeping, numeric",
+			stdout: "/dev/sda: WDC WD40EFRX-68N32N0: SLP\n",
+			err:    errHddtempSleeping},
+		{name: "not found",
+			stderr: "/dev/sdz: open: No such file or directory\n",
+			err:    errHddtempNotFound},
+		{name: "several disks",
+			stdout: "/dev/sda: WDC WD40EFRX-68N32N0: 35°C\n" +
+				"/dev/sdb: WDC WD40EFRX-68N32N0: 36°C\n",
+			fails: true},
+		{name: "empty", fails: true},
+	}
+
+	for _, test := range tests {
+		temperature, err := parseHddtemp(test.stdout, test.stderr)
+		switch {
+		case test.err != nil || test.fails:
+			if err == nil || (test.err != nil && err != test.err) {
+				t.Errorf("%s: parseHddtemp = %d, %v, expected error %v",
+					test.name, temperature, err, test.err)
+			}
+		case err != nil || temperature != test.temperature:
+			t.Errorf("%s: parseHddtemp = %d, %v, expected %d", test.name,
+				temperature, err, test.temperature)
+		}
+	}
+}
+
+func TestParseHdparmStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		stdout string
+		status Status
+		fails  bool
+	}{
+		{name: "active/idle",
+			stdout: "\n/dev/sda:\n drive state is:  active/idle\n",
+			status: DiskStatusActive},
+		{name: "idle",
+			stdout: "\n/dev/sda:\n drive state is:  idle\n",
+			status: DiskStatusIdle},
+		{name: "standby",
+			stdout: "\n/dev/sda:\n drive state is:  standby\n",
+			status: DiskStatusStandby},
+		{name: "sleeping",
+			stdout: "\n/dev/sda:\n drive state is:  sleeping\n",
+			status: DiskStatusSleep},
+		{name: "unknown",
+			stdout: "\n/dev/sda:\n drive state is:  unknown\n",
+			status: DiskStatusUnknown},
+		{name: "sense data warning",
+			stdout: "\n/dev/sdb:\n SG_IO: bad/missing sense data, sb[]:  " +
+				"70 00 05 00\n drive state is:  standby\n",
+			status: DiskStatusStandby},
+		{name: "bad state",
+			stdout: "\n/dev/sda:\n drive state is:  spinning\n",
+			fails:  true},
+		{name: "no drive state",
+			stdout: "\n/dev/sda:\n SG_IO: questionable sense data\n",
+			fails:  true},
+		{name: "empty", fails: true},
+	}
+
+	for _, test := range tests {
+		status, err := parseHdparmStatus(test.stdout)
+		switch {
+		case test.fails:
+			if err == nil {
+				t.Errorf("%s: parseHdparmStatus = %v, expected error",
+					test.name, status)
+			}
+		case err != nil || status != test.status:
+			t.Errorf("%s: parseHdparmStatus = %v, %v, expected %v",
+				test.name, status, err, test.status)
+		}
+	}
+}
+
+func TestParseNVMePowerState(t *testing.T) {
+	tests := []struct {
+		name   string
+		stdout string
+		status Status
+		fails  bool
+	}{
+		{name: "power state 0",
+			stdout: "get-feature:0x02 (Power Management), " +
+				"Current value:0x00000000\n",
+			status: DiskStatusActive},
+		{name: "power state 3",
+			stdout: "get-feature:0x02 (Power Management), " +
+				"Current value:0x00000003\n",
+			status: DiskStatusIdle},
+		{name: "power state 4",
+			stdout: "get-feature:0x02 (Power Management), " +
+				"Current value:0x00000004\n",
+			status: DiskStatusIdle},
+		{name: "workload hint, power state 0",
+			stdout: "get-feature:0x02 (Power Management), " +
+				"Current value:0x00000020\n",
+			status: DiskStatusActive},
+		{name: "bad value",
+			stdout: "get-feature:0x02 (Power Management), " +
+				"Current value:unknown\n",
+			fails: true},
+		{name: "no value",
+			stdout: "NVMe status: INVALID_FIELD: A reserved coded value " +
+				"or an unsupported value in a defined field(0x4002)\n",
+			fails: true},
+		{name: "empty", fails: true},
+	}
+
+	for _, test := range tests {
+		status, err := parseNVMePowerState(test.stdout)
+		switch {
+		case test.fails:
+			if err == nil {
+				t.Errorf("%s: parseNVMePowerState = %v, expected error",
+					test.name, status)
+			}
+		case err != nil || status != test.status:
+			t.Errorf("%s: parseNVMePowerState = %v, %v, expected %v",
+				test.name, status, err, test.status)
+		}
+	}
+}
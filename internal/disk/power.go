@@ -0,0 +1,79 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PowerManagement settings of a disk, as reported by hdparm. Fields are empty
+// if not reported.
+type PowerManagement struct {
+	// APM level 1-254, "off", or "not supported"
+	APMLevel string
+
+	// Standby timer capabilities
+	StandbyTimer string
+}
+
+// GetPowerManagement settings of a disk. Neither hdparm -B nor hdparm -I wake
+// a sleeping disk.
+func (disk *Disk) GetPowerManagement() (PowerManagement, error) {
+	settings := PowerManagement{}
+
+	// APM level
+	output, err := disk.hdparm("-B")
+	if err != nil {
+		return settings, err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "APM_level" {
+			settings.APMLevel = strings.TrimSpace(fields[1])
+		}
+	}
+
+	// Standby timer
+	output, err = disk.hdparm("-I")
+	if err != nil {
+		return settings, err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) == 2 &&
+			strings.TrimSpace(fields[0]) == "Standby timer values" {
+			settings.StandbyTimer = strings.TrimSpace(fields[1])
+		}
+	}
+
+	return settings, nil
+}
+
+// Run hdparm with a flag and return stdout
+func (disk *Disk) hdparm(flag string) (string, error) {
+	stdout, stderr, err := runCommand("hdparm", flag, disk.DevicePath)
+	if err != nil {
+		return "", fmt.Errorf(
+			"hdparm: %s failed for disk [%v]: stdout:[%v] stderr:[%v] err: %v",
+			flag, disk.DevicePath, stdout, stderr, err)
+	}
+
+	return stdout, nil
+}
@@ -0,0 +1,94 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"time"
+)
+
+// probe of a disk temperature in the background, whose reading, and the time
+// it was read, are set once done is closed
+type probe struct {
+	done        chan struct{}
+	temperature int
+	err         error
+	time        time.Time
+}
+
+// Get temperature of a staggered disk, from cache if polled within
+// PollInterval. Once the cached reading would go stale by the next call,
+// which is interval away, the next one is probed in the background after
+// offset, which is below interval, so that it is ready by then. A stale cache
+// waits for the probe, if any, or is read right away, such as for the first
+// reading, and those after the disk was sleeping, so that the temperature
+// returned is never older than PollInterval.
+func (disk *Disk) getStaggeredTemperature(offset time.Duration,
+	interval time.Duration) (int, error) {
+
+	if probe := disk.probe; probe != nil {
+		if !disk.isFresh(disk.cache.temperatureTime) {
+			<-probe.done
+		}
+
+		select {
+		case <-probe.done:
+			disk.probe = nil
+			if probe.err != nil {
+				temperature, err := disk.storeTemperature(probe.temperature,
+					probe.err, probe.time)
+				if _, sleeping := err.(*ErrSleepingDisk); sleeping {
+					disk.cache.temperatureTime = time.Time{}
+				}
+				return temperature, err
+			}
+			disk.storeTemperature(probe.temperature, nil, probe.time)
+		default:
+		}
+	}
+
+	if !disk.isFresh(disk.cache.temperatureTime) {
+		temperature, err := disk.getCachedTemperature()
+		if err != nil || !disk.isFresh(disk.cache.temperatureTime) {
+			return temperature, err
+		}
+	}
+
+	if disk.probe == nil && time.Since(disk.cache.temperatureTime)+
+		interval >= disk.PollInterval {
+		disk.startProbe(offset)
+	}
+
+	return disk.cache.temperature, nil
+}
+
+// Start probe of the disk temperature in the background, after delay
+func (disk *Disk) startProbe(delay time.Duration) {
+	// Probing right as the disk spins up may be what woke it
+	if disk.cache.spunUp {
+		disk.cache.spunUp = false
+		disk.Wakeups++
+	}
+
+	probe := &probe{done: make(chan struct{})}
+	disk.probe = probe
+	go func() {
+		time.Sleep(delay)
+		probe.temperature, probe.err = disk.readTemperature()
+		probe.time = time.Now()
+		close(probe.done)
+	}()
+}
@@ -0,0 +1,124 @@
+package disk
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SmartdWarning of smartd, as passed to its -M exec scripts
+type SmartdWarning struct {
+	Time     time.Time `json:"time"`
+	Device   string    `json:"device"`
+	FailType string    `json:"fail_type"`
+	Message  string    `json:"message"`
+}
+
+// SmartdWarningFromEnv of the SMARTD_* environment variables set by smartd
+func SmartdWarningFromEnv() (SmartdWarning, error) {
+	warning := SmartdWarning{
+		Time:     time.Now(),
+		Device:   os.Getenv("SMARTD_DEVICE"),
+		FailType: os.Getenv("SMARTD_FAILTYPE"),
+		Message:  os.Getenv("SMARTD_MESSAGE"),
+	}
+
+	if len(warning.Device) == 0 && len(warning.Message) == 0 {
+		return warning, fmt.Errorf(
+			"SmartdWarningFromEnv: Missing SMARTD_DEVICE and SMARTD_MESSAGE")
+	}
+
+	return warning, nil
+}
+
+// WriteSmartdWarning to a new file in a directory. The file is written under
+// a temporary name, and renamed, so that readers never see partial files.
+func WriteSmartdWarning(dir string, warning SmartdWarning) error {
+	contents, err := json.Marshal(warning)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, ".smartd-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	name := fmt.Sprintf("smartd-%d-%d.json", warning.Time.UnixNano(),
+		os.Getpid())
+	return os.Rename(file.Name(), filepath.Join(dir, name))
+}
+
+// ReadSmartdWarnings written to a directory, oldest first, and remove them
+func ReadSmartdWarnings(dir string) ([]SmartdWarning, error) {
+	warnings := []SmartdWarning{}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return warnings, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, "smartd-") && strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return warnings, err
+		}
+
+		// Remove bad files too, so they are only reported once
+		if err := os.Remove(path); err != nil {
+			return warnings, err
+		}
+
+		warning := SmartdWarning{}
+		if err := json.Unmarshal(contents, &warning); err != nil {
+			return warnings, fmt.Errorf("ReadSmartdWarnings: Bad file [%s]: %v",
+				path, err)
+		}
+
+		warnings = append(warnings, warning)
+	}
+
+	return warnings, nil
+}
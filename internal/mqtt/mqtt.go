@@ -0,0 +1,438 @@
+// Package mqtt is a minimal MQTT 3.1.1 client, which publishes and subscribes
+// at QoS 0, over plain TCP, or TLS.
+package mqtt
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	protocolLevel     = 4
+	subackFailure     = 0x80
+	maxRemainingBytes = 268435455
+)
+
+// Max size of packets read from the broker, whose messages are short
+// commands, so that a bad remaining length does not allocate up to 256MiB
+const maxReadBytes = 1 << 20
+
+// Timeout to connect to the broker, and to receive its CONNACK
+const connectTimeout = 10 * time.Second
+
+// TLSPrefix of addresses of brokers connected to over TLS
+const TLSPrefix = "tls://"
+
+// Options of a connection to a broker
+type Options struct {
+	// Address of the broker, as host:port, or tls://host:port for TLS, whose
+	// certificate is verified against RootCAs, or else the system roots
+	Address  string
+	RootCAs  *x509.CertPool
+	ClientID string
+	Username string
+	Password string
+
+	// KeepAlive interval of pings, which defaults to 30 seconds
+	KeepAlive time.Duration
+
+	// Will published by the broker, if the connection is lost
+	Will *Message
+}
+
+// Message published to, or received from a topic
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Client connected to a broker
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+	messages  chan Message
+	done      chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mutex    sync.Mutex
+	err      error
+	packetID uint16
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Dial broker, and connect with options
+func Dial(options Options) (*Client, error) {
+	if options.KeepAlive == 0 {
+		options.KeepAlive = 30 * time.Second
+	}
+
+	conn, err := dial(options)
+	if err != nil {
+		return nil, fmt.Errorf("Dial: %v", err)
+	}
+
+	client := &Client{conn: conn, keepAlive: options.KeepAlive,
+		messages: make(chan Message, 16), done: make(chan struct{}),
+		closing: make(chan struct{})}
+
+	if err := conn.SetDeadline(time.Now().Add(connectTimeout)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: %v", err)
+	}
+
+	if err := client.write(packetConnect<<4, connectBody(options)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	header, body, err := readPacket(reader)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: %v", err)
+	} else if header>>4 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: Expected CONNACK, got packet type: %d",
+			header>>4)
+	} else if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: Connection refused, return code: %d",
+			body[1])
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial: %v", err)
+	}
+
+	go client.read(reader)
+	go client.ping()
+
+	return client, nil
+}
+
+// Dial connection to the broker, over TLS for addresses with TLSPrefix
+func dial(options Options) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if !strings.HasPrefix(options.Address, TLSPrefix) {
+		return dialer.Dial("tcp", options.Address)
+	}
+
+	address := strings.TrimPrefix(options.Address, TLSPrefix)
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return tls.DialWithDialer(dialer, "tcp", address,
+		&tls.Config{ServerName: host, RootCAs: options.RootCAs})
+}
+
+// Publish payload to topic at QoS 0
+func (client *Client) Publish(topic string, payload []byte,
+	retain bool) error {
+
+	header := byte(packetPublish << 4)
+	if retain {
+		header |= 1
+	}
+
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	if err := client.write(header, body); err != nil {
+		return fmt.Errorf("Publish: %v", err)
+	}
+	return nil
+}
+
+// Subscribe to topic filters at QoS 0. A refused subscription closes the
+// connection.
+func (client *Client) Subscribe(filters ...string) error {
+	client.mutex.Lock()
+	client.packetID++
+	if client.packetID == 0 {
+		client.packetID = 1
+	}
+	packetID := client.packetID
+	client.mutex.Unlock()
+
+	body := []byte{byte(packetID >> 8), byte(packetID)}
+	for _, filter := range filters {
+		body = appendString(body, filter)
+		body = append(body, 0)
+	}
+
+	if err := client.write(packetSubscribe<<4|2, body); err != nil {
+		return fmt.Errorf("Subscribe: %v", err)
+	}
+	return nil
+}
+
+// Messages received on subscribed topics. The channel is closed when the
+// connection is lost or closed, after which Err returns the reason.
+func (client *Client) Messages() <-chan Message {
+	return client.messages
+}
+
+// Err of the lost connection, or nil
+func (client *Client) Err() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.err
+}
+
+// Close connection, after a DISCONNECT, so the broker discards the will
+func (client *Client) Close() error {
+	client.closeOnce.Do(func() { close(client.closing) })
+	client.write(packetDisconnect<<4, nil)
+	return client.conn.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Body of CONNECT packet of options, with a clean session
+func connectBody(options Options) []byte {
+	flags := byte(0x02)
+	if options.Will != nil {
+		flags |= 0x04
+		if options.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if len(options.Username) != 0 {
+		flags |= 0x80
+		if len(options.Password) != 0 {
+			flags |= 0x40
+		}
+	}
+
+	keepAlive := uint16(options.KeepAlive / time.Second)
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags, byte(keepAlive>>8),
+		byte(keepAlive))
+	body = appendString(body, options.ClientID)
+	if options.Will != nil {
+		body = appendString(body, options.Will.Topic)
+		body = appendString(body, string(options.Will.Payload))
+	}
+	if len(options.Username) != 0 {
+		body = appendString(body, options.Username)
+		if len(options.Password) != 0 {
+			body = appendString(body, options.Password)
+		}
+	}
+
+	return body
+}
+
+// Append length prefixed string to buffer
+func appendString(buffer []byte, value string) []byte {
+	buffer = append(buffer, byte(len(value)>>8), byte(len(value)))
+	return append(buffer, value...)
+}
+
+// Write packet of header and body
+func (client *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingBytes {
+		return fmt.Errorf("write: Packet too large: %d bytes", len(body))
+	}
+
+	packet := []byte{header}
+	for length := len(body); ; {
+		encoded := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			encoded |= 0x80
+		}
+		packet = append(packet, encoded)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	_, err := client.conn.Write(packet)
+	return err
+}
+
+// Read packet, returning its header and body
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for shift := uint(0); ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, fmt.Errorf("readPacket: Bad remaining length")
+		}
+		encoded, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(encoded&0x7f) << shift
+		if encoded&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxReadBytes {
+		return 0, nil, fmt.Errorf("readPacket: Packet too large: %d bytes",
+			length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header, body, nil
+}
+
+// Read packets until the connection is lost, passing on published messages.
+// A broker which is silent for more than one and a half keep alive intervals
+// is lost, since it answers every ping.
+func (client *Client) read(reader *bufio.Reader) {
+	err := client.readPackets(reader)
+
+	client.mutex.Lock()
+	client.err = err
+	client.mutex.Unlock()
+
+	client.conn.Close()
+	close(client.done)
+	close(client.messages)
+}
+
+// Read packets, until an error
+func (client *Client) readPackets(reader *bufio.Reader) error {
+	for {
+		deadline := time.Now().Add(client.keepAlive * 3 / 2)
+		if err := client.conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+
+		header, body, err := readPacket(reader)
+		if err != nil {
+			return err
+		}
+
+		switch header >> 4 {
+		case packetPublish:
+			message, packetID, err := parsePublish(header, body)
+			if err != nil {
+				return err
+			}
+			if packetID != 0 {
+				if err := client.write(packetPuback<<4,
+					[]byte{byte(packetID >> 8), byte(packetID)}); err != nil {
+					return err
+				}
+			}
+			select {
+			case client.messages <- message:
+			case <-client.closing:
+				return fmt.Errorf("readPackets: Closed")
+			}
+
+		case packetSuback:
+			if len(body) < 2 {
+				return fmt.Errorf("readPackets: Short SUBACK")
+			}
+			for _, code := range body[2:] {
+				if code == subackFailure {
+					return fmt.Errorf("readPackets: Subscription refused")
+				}
+			}
+
+		case packetPingresp:
+
+		default:
+			return fmt.Errorf("readPackets: Unexpected packet type: %d",
+				header>>4)
+		}
+	}
+}
+
+// Parse PUBLISH packet of header and body, returning its message, and its
+// packet id, if above QoS 0
+func parsePublish(header byte, body []byte) (Message, uint16, error) {
+	if len(body) < 2 {
+		return Message{}, 0, fmt.Errorf("parsePublish: Short packet")
+	}
+	length := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < length {
+		return Message{}, 0, fmt.Errorf("parsePublish: Short topic")
+	}
+	message := Message{Topic: string(body[:length]), Retain: header&1 != 0}
+	body = body[length:]
+
+	packetID := uint16(0)
+	if qos := (header >> 1) & 3; qos != 0 {
+		if len(body) < 2 {
+			return Message{}, 0, fmt.Errorf("parsePublish: Short packet id")
+		}
+		packetID = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	message.Payload = body
+
+	return message, packetID, nil
+}
+
+// Ping broker every keep alive interval, until the connection is lost
+func (client *Client) ping() {
+	ticker := time.NewTicker(client.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-ticker.C:
+			if err := client.write(packetPingreq<<4, nil); err != nil {
+				client.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package mqtt
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		header byte
+		body   []byte
+		err    bool
+	}{
+		{"empty body", []byte{0xd0, 0}, 0xd0, []byte{}, false},
+		{"body", []byte{0x30, 3, 1, 2, 3}, 0x30, []byte{1, 2, 3}, false},
+		{"two byte length", append([]byte{0x30, 0x80, 1},
+			make([]byte, 128)...), 0x30, make([]byte, 128), false},
+		{"no header", []byte{}, 0, nil, true},
+		{"truncated length", []byte{0x30, 0x80}, 0, nil, true},
+		{"truncated body", []byte{0x30, 5, 1, 2}, 0, nil, true},
+		{"five byte length", []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01},
+			0, nil, true},
+		{"oversized length", []byte{0x30, 0xff, 0xff, 0xff, 0x7f}, 0, nil,
+			true},
+		{"above read limit", []byte{0x30, 0x81, 0x80, 0x40}, 0, nil, true},
+	}
+
+	for _, test := range tests {
+		header, body, err := readPacket(bufio.NewReader(
+			bytes.NewReader(test.packet)))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %x %v", test.name, header,
+					body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if header != test.header || !bytes.Equal(body, test.body) {
+			t.Errorf("%s: readPacket = %x %v, expected %x %v", test.name,
+				header, body, test.header, test.body)
+		}
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   byte
+		body     []byte
+		message  Message
+		packetID uint16
+		err      bool
+	}{
+		{"qos 0", 0x30, []byte{0, 1, 'a', 'o', 'n'},
+			Message{Topic: "a", Payload: []byte("on")}, 0, false},
+		{"retain", 0x31, []byte{0, 1, 'a'},
+			Message{Topic: "a", Payload: []byte{}, Retain: true}, 0, false},
+		{"qos 1", 0x32, []byte{0, 1, 'a', 0x12, 0x34, 'o', 'n'},
+			Message{Topic: "a", Payload: []byte("on")}, 0x1234, false},
+		{"short packet", 0x30, []byte{0}, Message{}, 0, true},
+		{"short topic", 0x30, []byte{0, 3, 'a'}, Message{}, 0, true},
+		{"short packet id", 0x32, []byte{0, 1, 'a', 0x12}, Message{}, 0,
+			true},
+	}
+
+	for _, test := range tests {
+		message, packetID, err := parsePublish(test.header, test.body)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", test.name, message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !reflect.DeepEqual(message, test.message) ||
+			packetID != test.packetID {
+			t.Errorf("%s: parsePublish = %+v %d, expected %+v %d", test.name,
+				message, packetID, test.message, test.packetID)
+		}
+	}
+}
+
+// QoS 1 messages are acknowledged with a PUBACK of their packet id, before
+// they are passed on
+func TestPuback(t *testing.T) {
+	conn, broker := net.Pipe()
+	defer broker.Close()
+	client := &Client{conn: conn, keepAlive: time.Minute,
+		messages: make(chan Message, 1), done: make(chan struct{}),
+		closing: make(chan struct{})}
+	go client.read(bufio.NewReader(conn))
+
+	go broker.Write([]byte{0x32, 7, 0, 1, 'a', 0x12, 0x34, 'o', 'n'})
+
+	puback := make([]byte, 4)
+	broker.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(broker, puback); err != nil {
+		t.Fatalf("expected PUBACK, got error: %v", err)
+	} else if expected := []byte{0x40, 2, 0x12, 0x34}; !bytes.Equal(
+		puback, expected) {
+		t.Errorf("PUBACK = %x, expected %x", puback, expected)
+	}
+
+	select {
+	case message := <-client.Messages():
+		if message.Topic != "a" || string(message.Payload) != "on" {
+			t.Errorf("message = %+v, expected on to a", message)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected message")
+	}
+}
+
+// Brokers with tls:// addresses are connected to over TLS, verified against
+// RootCAs
+func TestDialTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1),
+		Subject:     pkix.Name{CommonName: "broker"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der},
+			PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Broker which accepts connections
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				header, _, err := readPacket(bufio.NewReader(conn))
+				if err != nil || header>>4 != packetConnect {
+					return
+				}
+				conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+				io.Copy(ioutil.Discard, conn)
+			}()
+		}
+	}()
+
+	address := TLSPrefix + listener.Addr().String()
+	if client, err := Dial(Options{Address: address}); err == nil {
+		client.Close()
+		t.Errorf("expected error for unknown certificate authority")
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(certificate)
+	client, err := Dial(Options{Address: address, RootCAs: rootCAs})
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	client.Close()
+}
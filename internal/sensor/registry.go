@@ -0,0 +1,107 @@
+package sensor
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Options of a sensor, as configured. Options of other sensor types are in
+// Extra, by their yaml key.
+type Options struct {
+	Path    string
+	Command []string
+	URL     string
+	Field   string
+	Scale   Scale
+	Extra   map[string]interface{}
+}
+
+// Factory of a sensor type, which creates a sensor from its options, or
+// returns an error for bad options. Factories must not read temperatures,
+// since config validation calls them.
+type Factory func(options Options) (Sensor, error)
+
+// Registered factories by sensor type
+var registry = struct {
+	mutex     sync.Mutex
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+// Built-in sensor types
+func init() {
+	Register("file", func(options Options) (Sensor, error) {
+		if len(options.Path) == 0 {
+			return nil, fmt.Errorf("missing path")
+		}
+		return &File{Path: options.Path, Scale: options.Scale}, nil
+	})
+
+	Register("exec", func(options Options) (Sensor, error) {
+		if len(options.Command) == 0 {
+			return nil, fmt.Errorf("missing command")
+		}
+		return &Exec{Command: options.Command, Scale: options.Scale}, nil
+	})
+
+	Register("http", func(options Options) (Sensor, error) {
+		if len(options.URL) == 0 {
+			return nil, fmt.Errorf("missing url")
+		}
+		return &HTTP{URL: options.URL, Field: options.Field,
+			Scale: options.Scale}, nil
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Register factory of a sensor type, configured by its type key. Registering
+// a type again replaces its factory.
+func Register(name string, factory Factory) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.factories[name] = factory
+}
+
+// New sensor of a registered type
+func New(name string, options Options) (Sensor, error) {
+	registry.mutex.Lock()
+	factory, ok := registry.factories[name]
+	registry.mutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("invalid type: %s", name)
+	}
+
+	return factory(options)
+}
+
+// Types of registered sensors, sorted
+func Types() []string {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	types := []string{}
+	for name := range registry.factories {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+
+	return types
+}
@@ -0,0 +1,191 @@
+// Package sensor reads temperatures from sources other than disks.
+package sensor
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sensor of a temperature in degrees celcius.
+type Sensor interface {
+	GetTemperature() (int, error)
+}
+
+// Scale of raw sensor values to degrees celcius: the raw value is multiplied
+// by Factor (1 if unset), and Offset is added, for example a Factor of 0.001
+// for millidegrees.
+type Scale struct {
+	Factor float64
+	Offset float64
+}
+
+// Apply scale to raw value, rounding to the nearest degree
+func (scale Scale) Apply(value float64) int {
+	factor := scale.Factor
+	if factor == 0 {
+		factor = 1
+	}
+	return int(math.Round(value*factor + scale.Offset))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// File sensor reads a temperature from a file.
+type File struct {
+	Path  string
+	Scale Scale
+}
+
+// GetTemperature from file contents
+func (sensor *File) GetTemperature() (int, error) {
+	contents, err := ioutil.ReadFile(sensor.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := parseTemperature(string(contents))
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: File [%v] %v", sensor.Path, err)
+	}
+
+	return sensor.Scale.Apply(value), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Exec sensor reads a temperature from the output of a command.
+type Exec struct {
+	Command []string
+	Scale   Scale
+}
+
+// Commands run by exec sensors since start
+var execRuns uint64
+
+// ExecRuns of exec sensor commands since start
+func ExecRuns() uint64 {
+	return atomic.LoadUint64(&execRuns)
+}
+
+// GetTemperature from command stdout
+func (sensor *Exec) GetTemperature() (int, error) {
+	if len(sensor.Command) == 0 {
+		return 0, fmt.Errorf("GetTemperature: Missing command")
+	}
+
+	atomic.AddUint64(&execRuns, 1)
+	command := exec.Command(sensor.Command[0], sensor.Command[1:]...)
+
+	// Save stdout and stderr
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		return 0, fmt.Errorf(
+			"GetTemperature: Command %v failed: stderr:[%v] err: %v",
+			sensor.Command, stderr.String(), err)
+	}
+
+	value, err := parseTemperature(stdout.String())
+	if err != nil {
+		return 0, fmt.Errorf("GetTemperature: Command %v %v",
+			sensor.Command, err)
+	}
+
+	return sensor.Scale.Apply(value), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// HTTP sensor reads a temperature from a URL. If Field is set, the response
+// is a JSON object, and the temperature is read from that field, for example
+// the temperature field of another gridfan daemon's /status.
+type HTTP struct {
+	URL   string
+	Field string
+	Scale Scale
+}
+
+// Timeout for HTTP requests
+const httpTimeout = 10 * time.Second
+
+// GetTemperature from response body
+func (sensor *HTTP) GetTemperature() (int, error) {
+	client := http.Client{Timeout: httpTimeout}
+
+	response, err := client.Get(sensor.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GetTemperature: URL [%v] status: %s",
+			sensor.URL, response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(sensor.Field) == 0 {
+		value, err := parseTemperature(string(body))
+		if err != nil {
+			return 0, fmt.Errorf("GetTemperature: URL [%v] %v", sensor.URL, err)
+		}
+		return sensor.Scale.Apply(value), nil
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return 0, fmt.Errorf("GetTemperature: URL [%v] malformed JSON: %v",
+			sensor.URL, err)
+	}
+
+	value, ok := fields[sensor.Field].(float64)
+	if !ok {
+		return 0, fmt.Errorf("GetTemperature: URL [%v] missing number field: %s",
+			sensor.URL, sensor.Field)
+	}
+
+	return sensor.Scale.Apply(value), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Parse a raw temperature value
+func parseTemperature(value string) (float64, error) {
+	temperature, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad temperature: [%v]", strings.TrimSpace(value))
+	}
+
+	return temperature, nil
+}
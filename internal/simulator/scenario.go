@@ -0,0 +1,149 @@
+package simulator
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"time"
+)
+
+// Commands of faults
+const (
+	CommandAny      = "any"
+	CommandPing     = "ping"
+	CommandGetSpeed = "get_speed"
+	CommandGetDuty  = "get_duty"
+	CommandSetSpeed = "set_speed"
+)
+
+// Fault actions
+const (
+	// Do not reply
+	ActionDrop = "drop"
+
+	// Flip the bits of one reply byte
+	ActionCorrupt = "corrupt"
+
+	// Reply after Delay
+	ActionDelay = "delay"
+
+	// Reply with only the first half of the reply
+	ActionTruncate = "truncate"
+)
+
+// Fault of a scenario, injected into every Every-th reply (default 1) to
+// Command (default any) of Fan (default any), after skipping the first After
+// of them, at most Limit times if set. Corrupt flips the bits of reply byte
+// Byte.
+type Fault struct {
+	Command string        `yaml:"command"`
+	Fan     int           `yaml:"fan"`
+	Every   int           `yaml:"every"`
+	After   int           `yaml:"after"`
+	Limit   int           `yaml:"limit"`
+	Action  string        `yaml:"action"`
+	Delay   time.Duration `yaml:"delay"`
+	Byte    int           `yaml:"byte"`
+
+	matched  int
+	injected int
+}
+
+// Scenario of faults
+type Scenario struct {
+	Faults []Fault `yaml:"faults"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ReadScenario from a yaml file
+func ReadScenario(path string) (Scenario, error) {
+	scenario := Scenario{}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return scenario, err
+	}
+
+	if err := yaml.UnmarshalStrict(contents, &scenario); err != nil {
+		return scenario, err
+	}
+
+	for i := range scenario.Faults {
+		fault := &scenario.Faults[i]
+
+		switch fault.Command {
+		case "":
+			fault.Command = CommandAny
+		case CommandAny, CommandPing, CommandGetSpeed, CommandGetDuty,
+			CommandSetSpeed:
+		default:
+			return scenario, fmt.Errorf(
+				"ReadScenario: Invalid fault %d command: %s", i, fault.Command)
+		}
+
+		switch fault.Action {
+		case ActionDrop, ActionCorrupt, ActionTruncate:
+		case ActionDelay:
+			if fault.Delay <= 0 {
+				return scenario, fmt.Errorf(
+					"ReadScenario: Fault %d delay requires a positive delay", i)
+			}
+		default:
+			return scenario, fmt.Errorf(
+				"ReadScenario: Invalid fault %d action: %s", i, fault.Action)
+		}
+
+		if fault.Fan != 0 && !isValidFan(byte(fault.Fan)) {
+			return scenario, fmt.Errorf("ReadScenario: Invalid fault %d fan: %d",
+				i, fault.Fan)
+		}
+
+		if fault.Every == 0 {
+			fault.Every = 1
+		}
+		if fault.Every < 0 || fault.After < 0 || fault.Limit < 0 ||
+			fault.Byte < 0 {
+			return scenario, fmt.Errorf(
+				"ReadScenario: Invalid fault %d: negative every, after, limit or byte",
+				i)
+		}
+	}
+
+	return scenario, nil
+}
+
+// Check if fault applies to the reply of a command to a fan, counting the
+// replies it matched
+func (fault *Fault) match(command string, fan int) bool {
+	if (fault.Command != CommandAny && fault.Command != command) ||
+		(fault.Fan != 0 && fault.Fan != fan) {
+		return false
+	}
+
+	fault.matched++
+	if fault.matched <= fault.After ||
+		(fault.matched-fault.After)%fault.Every != 0 ||
+		(fault.Limit != 0 && fault.injected >= fault.Limit) {
+		return false
+	}
+
+	fault.injected++
+	return true
+}
@@ -0,0 +1,242 @@
+// Package simulator emulates a Grid+ controller, for testing without hardware.
+package simulator
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Number of fans of a simulated controller
+const simulatorFans = 6
+
+// Simulator of a Grid+ controller. Fans report MaxSpeed rpm at 100% duty,
+// and proportionally less at lower duties. Each reply is delayed by Latency.
+// Faults are injected by dropping DropPercent of replies, and corrupting
+// CorruptPercent of replies, at random, and by the faults of Scenario.
+type Simulator struct {
+	MaxSpeed       int
+	Latency        time.Duration
+	DropPercent    int
+	CorruptPercent int
+	Scenario       Scenario
+
+	mutex  sync.Mutex
+	duties [simulatorFans + 1][2]byte
+	random *rand.Rand
+}
+
+// New simulator with all fans stopped
+func New() *Simulator {
+	return &Simulator{MaxSpeed: 2000,
+		random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Duty of a fan in percent
+func (simulator *Simulator) Duty(fan int) int {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	whole, fraction := simulator.duties[fan][0], simulator.duties[fan][1]
+	if whole < 2 {
+		return 0
+	}
+	return (int(whole)-2)*10 + int(fraction)/0x10
+}
+
+// Speed of a fan in rpm
+func (simulator *Simulator) Speed(fan int) int {
+	return simulator.Duty(fan) * simulator.MaxSpeed / 100
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Serve commands read from a connection, until it fails or is closed
+func (simulator *Simulator) Serve(conn io.ReadWriter) error {
+	buffer := []byte{}
+	data := make([]byte, 64)
+
+	for {
+		n, err := conn.Read(data)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		buffer = append(buffer, data[:n]...)
+
+		for len(buffer) != 0 {
+			reply, length := simulator.handle(buffer)
+			if length == 0 {
+				// Incomplete command
+				break
+			}
+			command, fan := commandName(buffer[0]), 0
+			if length > 1 {
+				fan = int(buffer[1])
+			}
+			buffer = buffer[length:]
+
+			if reply == nil {
+				continue
+			}
+			if err := simulator.write(conn, reply, command, fan); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Handle the command at the start of buffer. Returns its reply, if any, and
+// its length, which is 0 for an incomplete command.
+func (simulator *Simulator) handle(buffer []byte) ([]byte, int) {
+	switch buffer[0] {
+	case 0xc0:
+		// Ping
+		return []byte{0x21}, 1
+
+	case 0x8a:
+		// Get speed
+		if len(buffer) < 2 {
+			return nil, 0
+		}
+		if !isValidFan(buffer[1]) {
+			log.Printf("WARNING get speed of bad fan: %d", buffer[1])
+			return nil, 2
+		}
+		speed := simulator.Speed(int(buffer[1]))
+		return []byte{0xc0, 0x00, 0x00, byte(speed >> 8), byte(speed)}, 2
+
+	case 0x84:
+		// Get duty
+		if len(buffer) < 2 {
+			return nil, 0
+		}
+		if !isValidFan(buffer[1]) {
+			log.Printf("WARNING get duty of bad fan: %d", buffer[1])
+			return nil, 2
+		}
+		simulator.mutex.Lock()
+		duty := simulator.duties[buffer[1]]
+		simulator.mutex.Unlock()
+		return []byte{0xc0, 0x00, 0x00, duty[0], duty[1]}, 2
+
+	case 0x44:
+		// Set speed
+		if len(buffer) < 7 {
+			return nil, 0
+		}
+		if !isValidFan(buffer[1]) {
+			log.Printf("WARNING set speed of bad fan: %d", buffer[1])
+			return nil, 7
+		}
+		simulator.mutex.Lock()
+		simulator.duties[buffer[1]] = [2]byte{buffer[5], buffer[6]}
+		simulator.mutex.Unlock()
+		log.Printf("INFO fan %d duty: %d", buffer[1],
+			simulator.Duty(int(buffer[1])))
+		return []byte{0x01}, 7
+
+	default:
+		log.Printf("WARNING unknown command: 0x%02x", buffer[0])
+		return nil, 1
+	}
+}
+
+// Write reply to a command to a fan after the latency, injecting faults
+func (simulator *Simulator) write(conn io.Writer, reply []byte,
+	command string, fan int) error {
+
+	delay := simulator.Latency
+
+	simulator.mutex.Lock()
+	drop := simulator.random.Intn(100) < simulator.DropPercent
+	corrupt := simulator.random.Intn(100) < simulator.CorruptPercent
+	index := simulator.random.Intn(len(reply))
+	truncate := false
+	for i := range simulator.Scenario.Faults {
+		fault := &simulator.Scenario.Faults[i]
+		if !fault.match(command, fan) {
+			continue
+		}
+
+		log.Printf("INFO fault %d: %s %s", i, fault.Action, command)
+		switch fault.Action {
+		case ActionDrop:
+			drop = true
+		case ActionCorrupt:
+			corrupt = true
+			index = fault.Byte % len(reply)
+		case ActionDelay:
+			delay += fault.Delay
+		case ActionTruncate:
+			truncate = true
+		}
+	}
+	simulator.mutex.Unlock()
+
+	time.Sleep(delay)
+
+	if drop {
+		log.Printf("INFO dropping reply: %v", reply)
+		return nil
+	}
+	if corrupt {
+		reply = append([]byte{}, reply...)
+		reply[index] ^= 0xff
+		log.Printf("INFO corrupting reply: %v", reply)
+	}
+	if truncate {
+		reply = reply[:len(reply)/2]
+		log.Printf("INFO truncating reply: %v", reply)
+	}
+
+	_, err := conn.Write(reply)
+	if err != nil {
+		return fmt.Errorf("write: %v", err)
+	}
+	return nil
+}
+
+// Name of a command, for faults
+func commandName(command byte) string {
+	switch command {
+	case 0xc0:
+		return CommandPing
+	case 0x8a:
+		return CommandGetSpeed
+	case 0x84:
+		return CommandGetDuty
+	case 0x44:
+		return CommandSetSpeed
+	default:
+		return CommandAny
+	}
+}
+
+// Check if a fan number is valid
+func isValidFan(fan byte) bool {
+	return fan >= 1 && fan <= simulatorFans
+}
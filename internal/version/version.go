@@ -0,0 +1,38 @@
+// Package version holds the build version, set with -ldflags at release.
+package version
+
+/*
+Copyright (C) 2018 Jan Kasiak
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build version, commit and date, set at build time with:
+//
+//	-ldflags "-X github.com/cybojanek/gridfan/internal/version.Version=v1.2.0"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// String of version, commit, date, and the Go version and platform
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s %s/%s)", Version, Commit,
+		Date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}